@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"photos/internal/config"
+	"photos/internal/handlers"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// The storage checker reconciles the files of the storage with the photos table, like the page of the admins, and
+// can also verify the checksums of the originals, which reads every one of them. It exits with a non-zero status
+// when problems are left unrepaired, so that it can be scheduled and alert.
+
+func main() {
+	var checksums, repair bool
+	flag.BoolVar(&checksums, "checksums", false, "Verify that the content of every original matches its hash")
+	flag.BoolVar(&repair, "repair", false, "Quarantine orphan and corrupted files, re-link or hide photos and regenerate missing derivatives")
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	zerolog.DurationFieldUnit = time.Millisecond
+	cfg := config.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	pingCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+	if err := cfg.DB.PingContext(pingCtx); err != nil {
+		cfg.Logger.Fatal().Err(err).Msg("failed to ping database")
+	}
+
+	problems, err := handlers.Config(cfg).CheckStorage(ctx, checksums, repair)
+	if err != nil {
+		cfg.Logger.Fatal().Err(err).Msg("storage check failed")
+	}
+	for _, problem := range problems {
+		cfg.Logger.Warn().
+			Str("kind", problem.Kind).
+			Str("key", problem.Key).
+			Uint32("photo_id", problem.PhotoID).
+			Str("detail", problem.Detail).
+			Str("repair", problem.Repair).
+			Msg("storage problem")
+	}
+	cfg.Logger.Info().Bool("checksums", checksums).Bool("repair", repair).Int("problems", len(problems)).Msg("storage check finished")
+	if len(problems) > 0 && !repair {
+		os.Exit(1)
+	}
+}
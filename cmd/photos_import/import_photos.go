@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"photos/internal/config"
+	"photos/internal/db/query"
+	"photos/internal/handlers"
+	"photos/internal/imaging"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// The importer ingests a directory tree into events: every directory becomes an event, nested under the event of
+// its parent directory, and the photos it holds are added to it like uploads. Events that already exist under the
+// same parent are reused, and photos already in their event are skipped as duplicates. Every file processed is
+// recorded in a journal, so that an interrupted import resumes without reading the files it already went through.
+// The derivatives of the imported photos are generated by the background jobs of the photos server.
+
+// photoExtensions are the extensions of the files imported, other files such as sidecars are ignored.
+var photoExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// importer holds the state of an import.
+type importer struct {
+	cfg     handlers.Config
+	root    string
+	dryRun  bool
+	journal *os.File        // Journal the processed files are appended to, nil in dry runs.
+	done    map[string]bool // Files processed by previous runs.
+
+	events  map[string]uint32 // Events of the directories of the tree, 0 for events that a dry run would create.
+	created int
+	added   int
+	skipped int
+	refused int
+}
+
+func main() {
+	var dir, journalPath string
+	var parentID int
+	var dryRun bool
+	flag.StringVar(&dir, "dir", "", "Directory tree to import (required)")
+	flag.IntVar(&parentID, "parent", 0, "ID of the event receiving the top-level directories and files (default: none)")
+	flag.BoolVar(&dryRun, "dry-run", false, "List the events and photos that would be imported without changing anything")
+	flag.StringVar(&journalPath, "journal", "photos_import.journal", "File recording the processed files, to resume an interrupted import")
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	zerolog.DurationFieldUnit = time.Millisecond
+	cfg := config.Load()
+	if dir == "" {
+		flag.Usage()
+		cfg.Logger.Fatal().Msg("The directory to import is required.")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	pingCtx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	defer cancel()
+	if err := cfg.DB.PingContext(pingCtx); err != nil {
+		cfg.Logger.Fatal().Err(err).Msg("failed to ping database")
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		cfg.Logger.Fatal().Err(err).Msg("failed to resolve the directory to import")
+	}
+	imp := &importer{cfg: handlers.Config(cfg), root: root, dryRun: dryRun, events: map[string]uint32{}}
+	if parentID != 0 {
+		events, err := cfg.DB.GetEventByID(ctx, uint32(parentID))
+		if err != nil {
+			cfg.Logger.Fatal().Err(err).Msg("failed to look up the parent event")
+		}
+		if len(events) == 0 {
+			cfg.Logger.Fatal().Int("parent", parentID).Msg("The parent event does not exist.")
+		}
+		imp.events[root] = events[0].EventID
+	}
+	imp.done, err = readJournal(journalPath)
+	if err != nil {
+		cfg.Logger.Fatal().Err(err).Msg("failed to read the journal")
+	}
+	if !dryRun {
+		imp.journal, err = os.OpenFile(journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			cfg.Logger.Fatal().Err(err).Msg("failed to open the journal")
+		}
+		defer imp.journal.Close()
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Hidden entries and the @eaDir folders of NAS indexers hold no photos
+		if path != root && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "@")) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			return imp.importDirectory(ctx, path, d)
+		}
+		if !photoExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		return imp.importFile(ctx, path)
+	})
+	logger := cfg.Logger.Info()
+	if err != nil {
+		logger = cfg.Logger.Error().Err(err)
+	}
+	logger.Bool("dry_run", dryRun).
+		Int("events_created", imp.created).
+		Int("photos_added", imp.added).
+		Int("photos_skipped", imp.skipped).
+		Int("photos_refused", imp.refused).
+		Msg("import finished")
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// importDirectory finds the event of a directory under the event of its parent, or creates it.
+func (imp *importer) importDirectory(ctx context.Context, path string, d fs.DirEntry) error {
+	var parent sql.NullInt32
+	parentID, ok := imp.events[filepath.Dir(path)]
+	if ok {
+		parent = sql.NullInt32{Int32: int32(parentID), Valid: true}
+	}
+	logger := imp.cfg.Logger.With().Str("directory", path).Logger()
+
+	// The children of events that a dry run would create do not exist either
+	if !ok || parentID != 0 {
+		event, err := imp.cfg.DB.GetEventByNameAndParentID(ctx, query.GetEventByNameAndParentIDParams{Name: d.Name(), ParentEventID: parent})
+		if err == nil {
+			imp.events[path] = event.EventID
+			logger.Info().Uint32("event_id", event.EventID).Msg("using existing event")
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+
+	imp.created++
+	if imp.dryRun {
+		imp.events[path] = 0
+		logger.Info().Msg("would create event")
+		return nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(imp.root, path)
+	if err != nil {
+		return err
+	}
+	err = imp.cfg.DB.CreateEvent(ctx, query.CreateEventParams{
+		Name:          d.Name(),
+		Description:   fmt.Sprintf("Importé depuis %s", filepath.ToSlash(rel)),
+		EventDate:     info.ModTime(),
+		ParentEventID: parent,
+	})
+	if err != nil {
+		return err
+	}
+	event, err := imp.cfg.DB.GetEventByNameAndParentID(ctx, query.GetEventByNameAndParentIDParams{Name: d.Name(), ParentEventID: parent})
+	if err != nil {
+		return err
+	}
+	imp.events[path] = event.EventID
+	logger.Info().Uint32("event_id", event.EventID).Msg("created event")
+	return nil
+}
+
+// importFile adds a photo to the event of its directory and records it in the journal.
+func (imp *importer) importFile(ctx context.Context, path string) error {
+	logger := imp.cfg.Logger.With().Str("file", path).Logger()
+	if imp.done[path] {
+		imp.skipped++
+		return nil
+	}
+	eventID, ok := imp.events[filepath.Dir(path)]
+	if !ok {
+		logger.Warn().Msg("file outside of any event, use -parent to import the top-level files")
+		imp.refused++
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if imp.dryRun {
+		reason, err := imp.checkFile(ctx, eventID, file)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			imp.refused++
+			logger.Info().Str("reason", reason).Msg("would not import photo")
+			return nil
+		}
+		imp.added++
+		logger.Info().Msg("would import photo")
+		return nil
+	}
+
+	added, reason, err := imp.cfg.ImportPhoto(ctx, eventID, filepath.Base(path), file, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	if added {
+		imp.added++
+		logger.Info().Uint32("event_id", eventID).Msg("imported photo")
+	} else {
+		imp.refused++
+		logger.Info().Str("reason", reason).Msg("photo not imported")
+	}
+	// A crash before this line only makes the next run find the photo as a duplicate
+	_, err = fmt.Fprintln(imp.journal, path)
+	return err
+}
+
+// checkFile tells why a dry run would not import a file, or returns an empty reason. The file is decoded like
+// uploads are, and files that are already in an existing event are reported as duplicates.
+func (imp *importer) checkFile(ctx context.Context, eventID uint32, file io.ReadSeeker) (string, error) {
+	if _, _, err := imaging.DecodeLimited(file, imp.cfg.Uploads.MaxPixels); err != nil {
+		return err.Error(), nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if eventID == 0 {
+		return "", nil
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	photo, err := imp.cfg.DB.GetPhotoByEventIDAndHash(ctx, query.GetPhotoByEventIDAndHashParams{EventID: eventID, PhotoHash: hex.EncodeToString(hasher.Sum(nil))})
+	if err == nil {
+		return fmt.Sprintf("identique à la photo %d", photo.PhotoID), nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return "", err
+}
+
+// readJournal returns the files recorded in the journal of previous runs. A missing journal is empty.
+func readJournal(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			done[line] = true
+		}
+	}
+	return done, scanner.Err()
+}
@@ -45,6 +45,8 @@ func main() {
 	}
 
 	serverCtx, serverCtxCancel := context.WithCancel(context.Background())
+	go handlers.Config(cfg).RunTrashPurge(serverCtx)
+	handlers.Config(cfg).StartJobs()
 	// Listen for syscall signals for process to interrupt/quit
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -66,6 +68,11 @@ func main() {
 		if err != nil {
 			cfg.Logger.Fatal().Err(err).Msg("failed to shut down server")
 		}
+		// Jobs in progress are finished before the database is closed, those cut short are retried on restart
+		err = cfg.Jobs.Drain(shutdownCtx)
+		if err != nil {
+			cfg.Logger.Error().Err(err).Msg("failed to drain background jobs")
+		}
 		err = cfg.DB.Close()
 		if err != nil {
 			cfg.Logger.Fatal().Err(err).Msg("failed to close database connection")
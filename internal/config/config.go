@@ -5,8 +5,15 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"os"
 	"photos/internal/db"
+	"photos/internal/jobs"
+	"photos/internal/metadata"
+	"photos/internal/storage"
+	"photos/internal/tus"
+	"photos/internal/urlsign"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,9 +34,63 @@ func defaultConfig() (Config, error) {
 	if err != nil {
 		return Config{}, err
 	}
+	s3, err := generateSecureHex(16)
+	if err != nil {
+		return Config{}, err
+	}
+	s4, err := generateSecureHex(16)
+	if err != nil {
+		return Config{}, err
+	}
 
 	defaultCfg := Config{
-		PhotosDir: "./photos_dir",
+		Storage: Storage{
+			Backend: "local",
+			Local: LocalStorage{
+				Directory: "./photos_dir",
+			},
+			S3: S3Storage{
+				Region: "us-east-1",
+				UseSSL: true,
+			},
+		},
+		Uploads: Uploads{
+			StagingDir: "./uploads_dir",
+			MaxSize:    200 << 20,
+			MaxPixels:  100_000_000,
+			ChunkSize:  4 << 20,
+			Expiration: 24 * time.Hour,
+		},
+		Derivatives: Derivatives{
+			ThumbnailSize: 400,
+			PreviewSize:   1600,
+			JPEGQuality:   82,
+		},
+		Trash: Trash{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Reports: Reports{
+			AutoHideThreshold: 3,
+			HistoryLength:     100,
+		},
+		Similarity: Similarity{
+			MaxDistance: 10,
+			Limit:       24,
+		},
+		Jobs: Jobs{
+			Workers:       4,
+			PollInterval:  5 * time.Second,
+			Timeout:       5 * time.Minute,
+			MaxAttempts:   5,
+			Backoff:       30 * time.Second,
+			MaxBackoff:    time.Hour,
+			HistoryLength: 100,
+		},
+		StorageCheck: StorageCheck{
+			GracePeriod: time.Hour,
+		},
+		MetadataPolicy: metadata.StripGPS,
 		DevMode: DevMode{
 			Enabled: true,
 		},
@@ -66,6 +127,22 @@ func defaultConfig() (Config, error) {
 				},
 				SecureCookie: securecookie.New(s2, nil),
 			},
+			EventUnlock: UnlockToken{
+				Token: Token{
+					Secret:         s4,
+					CookieName:     "event_unlock",
+					CookieMaxAge:   24 * time.Hour,
+					CookieSecure:   true,
+					CookieHTTPOnly: true,
+					CookieSameSite: http.SameSiteStrictMode,
+				},
+				SecureCookie: securecookie.New(s4, nil).MaxAge(int((24 * time.Hour).Seconds())),
+			},
+			PhotoURL: PhotoURLs{
+				Secret:     s3,
+				Expiration: 24 * time.Hour,
+				Signer:     urlsign.New(s3),
+			},
 		},
 		BaseURLs: BaseURLs{
 			Dev: BaseURL{
@@ -78,14 +155,41 @@ func defaultConfig() (Config, error) {
 			},
 		},
 		Routes: Routes{
-			Favicon:     "/favicon.ico",
-			Landing:     "/",
-			Login:       "/login",
-			CasCallback: "/cas",
-			Dashboard:   "/dashboard",
-			Logout:      "/logout",
-			Event:       "/event",
-			Photos:      "/photos",
+			Favicon:           "/favicon.ico",
+			Landing:           "/",
+			Login:             "/login",
+			CasCallback:       "/cas",
+			Dashboard:         "/dashboard",
+			Logout:            "/logout",
+			Event:             "/event",
+			EventArchive:      "/event/archive",
+			MetadataPolicy:    "/event-metadata-policy",
+			EventPassword:     "/event-password",
+			Trash:             "/trash",
+			HidePhoto:         "/photo/hide",
+			DeletePhoto:       "/photo/delete",
+			RestorePhoto:      "/photo/restore",
+			BulkPhotos:        "/photos/bulk",
+			Reports:           "/reports",
+			ReportPhoto:       "/photo/report",
+			Duplicates:        "/event/duplicates",
+			SimilarPhotos:     "/photo/similar",
+			Jobs:              "/jobs",
+			StorageCheck:      "/storage/check",
+			EventUnlock:       "/event/unlock",
+			Tag:               "/tag",
+			TagSuggestions:    "/tags/suggestions",
+			PhotoTags:         "/photo/tags",
+			Search:            "/search",
+			Folders:           "/folders",
+			Folder:            "/folder",
+			PhotoPeople:       "/photo/people",
+			UserSuggestions:   "/users/suggestions",
+			MyPhotos:          "/me/photos",
+			Photos:            "/photos",
+			PhotoFile:         "/photo",
+			OriginalPhotoFile: "/photo/original",
+			Uploads:           "/uploads",
 		},
 	}
 	return defaultCfg, nil
@@ -137,12 +241,40 @@ func Load() Config {
 		logger.Fatal().Err(err).Msg("Failed to read the config file.")
 	}
 
-	cfg := Config{}
+	// Settings missing from the file keep their default value, so that config files
+	// written by older versions still work when new settings are introduced.
+	cfg, err := defaultConfig()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to generate the default configuration.")
+	}
+	defaultDirectory := cfg.Storage.Local.Directory
 	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to parse the config file.")
 	}
-	cfg.Templates, err = template.ParseGlob("assets/templates/*.html")
+	if err = applyPhotosDir(&cfg, defaultDirectory); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid storage directory in the config file.")
+	}
+	if cfg.PhotosDir != "" {
+		logger.Warn().Str("path", cfgPath).Msg("photos_directory is deprecated, set storage.local.directory instead.")
+	}
+	// Secrets generated at each start would invalidate the cookies and the signed URLs of the previous run
+	data, err = addMissingSecrets(data, cfg.Security)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to add the missing secrets to the config file.")
+	}
+	if data != nil {
+		if err = os.WriteFile(cfgPath, data, 0600); err != nil {
+			logger.Fatal().Err(err).Msg("Failed to write the missing secrets to the config file.")
+		}
+		logger.Info().Str("path", cfgPath).Msg("Secrets missing from the config file were generated and added to it.")
+	}
+	_, err = metadata.ParsePolicy(string(cfg.MetadataPolicy))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid metadata policy in the config file.")
+	}
+	cfg.Security.PhotoURL.Signer = urlsign.New(cfg.Security.PhotoURL.Secret)
+	cfg.Templates, err = template.New("").Funcs(templateFuncs(cfg)).ParseGlob("assets/templates/*.html")
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to parse HTML templates.")
 	}
@@ -158,13 +290,147 @@ func Load() Config {
 			logger.Fatal().Err(err).Msg("Failed to establish a database connection.")
 		}
 	}
+	cfg.Storage.Storage, err = openStorage(cfg.Storage)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open the photo storage.")
+	}
+	cfg.Uploads.Staging, err = tus.NewStaging(cfg.Uploads.StagingDir)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open the upload staging directory.")
+	}
+	cfg.Jobs.Queue = jobs.New(cfg.DB.DB, jobs.Options{
+		Workers:      cfg.Jobs.Workers,
+		PollInterval: cfg.Jobs.PollInterval,
+		Timeout:      cfg.Jobs.Timeout,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+		Backoff:      cfg.Jobs.Backoff,
+		MaxBackoff:   cfg.Jobs.MaxBackoff,
+	}, logger)
 	cfg.HttpClient = newHTTPClient(6*time.Second, false, false, false, nil)
 	cfg.Security.Session.SecureCookie = securecookie.New(cfg.Security.Session.Secret, nil)
+	cfg.Security.EventUnlock.SecureCookie = securecookie.New(cfg.Security.EventUnlock.Secret, nil).MaxAge(int(cfg.Security.EventUnlock.CookieMaxAge.Seconds()))
 	cfg.Logger = logger
 
 	return cfg
 }
 
+// The templateFuncs function returns the functions available to the HTML templates.
+// photoURL and photoDownloadURL build signed URLs to the files of a photo, versioned with its hash.
+// Their expiry is rounded so that pages rendered close together share the same URLs, which browsers can then cache.
+func templateFuncs(cfg Config) template.FuncMap {
+	photoURL := func(photoID uint32, photoHash string, params url.Values) string {
+		expiration := cfg.Security.PhotoURL.Expiration
+		expires := time.Now().Truncate(expiration).Add(2 * expiration)
+		params.Set("photo_id", strconv.FormatUint(uint64(photoID), 10))
+		params.Set("v", photoHash)
+		return cfg.Security.PhotoURL.Sign(cfg.Routes.PhotoFile, params, expires)
+	}
+	return template.FuncMap{
+		"photoURL": func(photoID uint32, photoHash, size string) string {
+			return photoURL(photoID, photoHash, url.Values{"size": {size}})
+		},
+		"photoDownloadURL": func(photoID uint32, photoHash string) string {
+			return photoURL(photoID, photoHash, url.Values{"size": {"original"}, "download": {"1"}})
+		},
+		// Originals with their metadata are only served to admin sessions, so their URLs are not signed
+		"originalPhotoURL": func(photoID uint32, photoHash string) string {
+			params := url.Values{"photo_id": {strconv.FormatUint(uint64(photoID), 10)}, "v": {photoHash}}
+			return cfg.Routes.OriginalPhotoFile + "?" + params.Encode()
+		},
+	}
+}
+
+// The openStorage function opens the storage backend selected in the configuration.
+// It returns an error if the backend is unknown or cannot be opened.
+func openStorage(s Storage) (storage.Storage, error) {
+	switch s.Backend {
+	case "local":
+		return storage.NewLocal(s.Local.Directory)
+	case "s3":
+		return storage.NewS3(s.S3.Endpoint, s.S3.Region, s.S3.Bucket, s.S3.AccessKey, s.S3.SecretKey, s.S3.UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", s.Backend)
+	}
+}
+
+// The applyPhotosDir function moves the photos_directory setting of config files written before the storage
+// backends to the directory of the local storage. It returns an error if the file also sets another directory.
+func applyPhotosDir(cfg *Config, defaultDirectory string) error {
+	if cfg.PhotosDir == "" {
+		return nil
+	}
+	if cfg.Storage.Local.Directory != defaultDirectory && cfg.Storage.Local.Directory != cfg.PhotosDir {
+		return fmt.Errorf("photos_directory %q conflicts with storage.local.directory %q", cfg.PhotosDir, cfg.Storage.Local.Directory)
+	}
+	cfg.Storage.Local.Directory = cfg.PhotosDir
+	return nil
+}
+
+// The addMissingSecrets function adds to the YAML content of a config file the secrets of security that it does
+// not set, such as the ones introduced after the file was written. It returns the updated content,
+// or nil if the file already sets every secret.
+func addMissingSecrets(data []byte, security Security) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	added := false
+	for _, token := range []struct {
+		path   []string
+		secret secretKey
+	}{
+		{[]string{"security", "csrf", "token"}, security.Csrf.Secret},
+		{[]string{"security", "session", "token"}, security.Session.Secret},
+		{[]string{"security", "event_unlock", "token"}, security.EventUnlock.Secret},
+		{[]string{"security", "photo_url"}, security.PhotoURL.Secret},
+	} {
+		node := doc.Content[0]
+		for _, key := range token.path {
+			node = mappingValue(node, key)
+		}
+		if lookupMappingValue(node, "secret") != nil {
+			continue
+		}
+		var value yaml.Node
+		if err := value.Encode(token.secret); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "secret"}, &value)
+		added = true
+	}
+	if !added {
+		return nil, nil
+	}
+	return yaml.Marshal(&doc)
+}
+
+// The mappingValue function returns the mapping under a key of a YAML mapping. A missing or empty value is
+// replaced with an empty mapping.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	value := lookupMappingValue(mapping, key)
+	if value == nil {
+		value = &yaml.Node{}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	if value.Kind != yaml.MappingNode {
+		*value = yaml.Node{Kind: yaml.MappingNode}
+	}
+	return value
+}
+
+// The lookupMappingValue function returns the value of a key in a YAML mapping, or nil if the key is missing.
+func lookupMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
 // The createDefaultConfig function creates a default configuration file at the given path.
 // It serializes the default configuration settings into YAML format and writes them to the specified file.
 // If the file cannot be created or written to, the function returns an error.
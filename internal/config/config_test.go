@@ -1,11 +1,14 @@
 package config
 
 import (
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 // TestDefaultConfig ensures that defaultConfig generates a valid Config structure.
@@ -20,6 +23,8 @@ func TestDefaultConfig(t *testing.T) {
 	assert.True(t, cfg.DevMode.Enabled, "DevMode should be enabled by default")
 	assert.NotEmpty(t, cfg.Security.Csrf.Token.Secret, "CSRF Token Secret should be generated")
 	assert.NotEmpty(t, cfg.Security.Session.Token.Secret, "Session Token Secret should be generated")
+	assert.NotEmpty(t, cfg.Security.EventUnlock.Token.Secret, "Event Unlock Token Secret should be generated")
+	assert.NotEmpty(t, cfg.Security.PhotoURL.Secret, "Photo URL Secret should be generated")
 	assert.Equal(t, "/favicon.ico", cfg.Routes.Favicon, "Default favicon route should be set")
 }
 
@@ -40,3 +45,75 @@ func TestCreateDefaultConfig(t *testing.T) {
 	assert.NoError(t, err, "Reading the created config file should not return an error")
 	assert.Contains(t, string(data), "csrf_token", "Config file should contain CSRF token information")
 }
+
+// TestOpenStorage ensures that the storage backend is selected from the configuration.
+func TestOpenStorage(t *testing.T) {
+	s, err := openStorage(Storage{Backend: "local", Local: LocalStorage{Directory: t.TempDir()}})
+	assert.NoError(t, err, "openStorage should open the local backend")
+	assert.NotNil(t, s, "openStorage should return a storage")
+
+	_, err = openStorage(Storage{Backend: "ftp"})
+	assert.Error(t, err, "openStorage should reject unknown backends")
+}
+
+// TestTemplateFuncs ensures that the photo URLs of the templates are versioned, signed and valid for at least the expiration.
+func TestTemplateFuncs(t *testing.T) {
+	cfg, err := defaultConfig()
+	assert.NoError(t, err, "defaultConfig should not return an error")
+	funcs := templateFuncs(cfg)
+
+	u, err := url.Parse(funcs["photoURL"].(func(uint32, string, string) string)(42, "abcdef", "thumb"))
+	assert.NoError(t, err, "photoURL should return a valid URL")
+	assert.Equal(t, cfg.Routes.PhotoFile, u.Path, "photoURL should point to the photo route")
+	assert.Equal(t, "42", u.Query().Get("photo_id"), "photoURL should select the photo")
+	assert.Equal(t, "thumb", u.Query().Get("size"), "photoURL should select the size")
+	assert.Equal(t, "abcdef", u.Query().Get("v"), "photoURL should be versioned with the photo hash")
+	assert.NoError(t, cfg.Security.PhotoURL.Verify(u, time.Now().Add(cfg.Security.PhotoURL.Expiration)), "photoURL should be valid for the expiration")
+
+	u, err = url.Parse(funcs["photoDownloadURL"].(func(uint32, string) string)(42, "abcdef"))
+	assert.NoError(t, err, "photoDownloadURL should return a valid URL")
+	assert.Equal(t, "1", u.Query().Get("download"), "photoDownloadURL should ask for a download")
+	assert.NoError(t, cfg.Security.PhotoURL.Verify(u, time.Now()), "photoDownloadURL should be signed")
+
+	u, err = url.Parse(funcs["originalPhotoURL"].(func(uint32, string) string)(42, "abcdef"))
+	assert.NoError(t, err, "originalPhotoURL should return a valid URL")
+	assert.Equal(t, cfg.Routes.OriginalPhotoFile, u.Path, "originalPhotoURL should point to the original photo route")
+	assert.Equal(t, "42", u.Query().Get("photo_id"), "originalPhotoURL should select the photo")
+}
+
+// TestAddMissingSecrets ensures that the secrets missing from a config file are added to it, and that the ones it
+// sets are kept.
+func TestAddMissingSecrets(t *testing.T) {
+	cfg, err := defaultConfig()
+	assert.NoError(t, err, "defaultConfig should not return an error")
+	data := []byte("server:\n    port: 8080\nsecurity:\n    csrf:\n        token:\n            secret: \"12345678\"\n            cookie_name: csrf_token\n    session:\n        token:\n            secret: \"9abcdef0\"\n")
+
+	data, err = addMissingSecrets(data, cfg.Security)
+	assert.NoError(t, err, "addMissingSecrets should not return an error")
+	var updated Config
+	assert.NoError(t, yaml.Unmarshal(data, &updated), "The updated config file should be valid")
+	assert.Equal(t, 8080, updated.Server.Port, "Other settings should be kept")
+	assert.Equal(t, "csrf_token", updated.Security.Csrf.CookieName, "Other settings of the tokens should be kept")
+	assert.Equal(t, secretKey{0x12, 0x34, 0x56, 0x78}, updated.Security.Csrf.Secret, "Secrets set by the file should be kept")
+	assert.Equal(t, secretKey{0x9a, 0xbc, 0xde, 0xf0}, updated.Security.Session.Secret, "Secrets set by the file should be kept")
+	assert.Equal(t, cfg.Security.EventUnlock.Secret, updated.Security.EventUnlock.Secret, "Missing secrets should be added")
+	assert.Equal(t, cfg.Security.PhotoURL.Secret, updated.Security.PhotoURL.Secret, "Missing secrets should be added")
+
+	data, err = addMissingSecrets(data, cfg.Security)
+	assert.NoError(t, err, "addMissingSecrets should not return an error")
+	assert.Nil(t, data, "A config file setting every secret should be left unchanged")
+}
+
+// TestApplyPhotosDir ensures that the photos directory of older config files is used by the local storage.
+func TestApplyPhotosDir(t *testing.T) {
+	cfg := Config{PhotosDir: "/srv/photos", Storage: Storage{Local: LocalStorage{Directory: "./photos_dir"}}}
+	assert.NoError(t, applyPhotosDir(&cfg, "./photos_dir"), "photos_directory should be accepted alone")
+	assert.Equal(t, "/srv/photos", cfg.Storage.Local.Directory, "photos_directory should set the directory of the local storage")
+
+	cfg = Config{Storage: Storage{Local: LocalStorage{Directory: "/srv/storage"}}}
+	assert.NoError(t, applyPhotosDir(&cfg, "./photos_dir"), "Config files without photos_directory should be accepted")
+	assert.Equal(t, "/srv/storage", cfg.Storage.Local.Directory, "storage.local.directory should be kept without photos_directory")
+
+	cfg = Config{PhotosDir: "/srv/photos", Storage: Storage{Local: LocalStorage{Directory: "/srv/storage"}}}
+	assert.Error(t, applyPhotosDir(&cfg, "./photos_dir"), "photos_directory should not conflict with storage.local.directory")
+}
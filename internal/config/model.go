@@ -4,6 +4,11 @@ import (
 	"html/template"
 	"net/http"
 	"photos/internal/db"
+	"photos/internal/jobs"
+	"photos/internal/metadata"
+	"photos/internal/storage"
+	"photos/internal/tus"
+	"photos/internal/urlsign"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -13,19 +18,106 @@ import (
 // Config represents the main configuration structure for the application.
 // It includes settings for development mode, server, security, database, base URLs, and routes.
 type Config struct {
-	PhotosDir string   `yaml:"photos_directory"` // Path to the photos directory on the machine.
-	DevMode   DevMode  `yaml:"dev_mode"`         // Development mode settings.
-	Server    Server   `yaml:"server"`           // Server-related configuration.
-	Security  Security `yaml:"security"`         // Security settings such as CSRF and session tokens.
-	DB        DB       `yaml:"db"`               // Database connection details for development and production.
-	BaseURLs  BaseURLs `yaml:"base_urls"`        // URLs for different environments (Dev and Prod).
-	Routes    Routes   `yaml:"routes"`           // Application route paths.
+	Storage        Storage         `yaml:"storage"`         // Backend storing the files of the photos.
+	Uploads        Uploads         `yaml:"uploads"`         // Resumable uploads of photos.
+	Derivatives    Derivatives     `yaml:"derivatives"`     // Sizes of the thumbnails and previews generated on upload.
+	Trash          Trash           `yaml:"trash"`           // Retention of the deleted photos.
+	Reports        Reports         `yaml:"reports"`         // Moderation of the photos reported by users.
+	Similarity     Similarity      `yaml:"similarity"`      // Detection of the near-duplicate photos.
+	Jobs           Jobs            `yaml:"jobs"`            // Background processing of the uploaded photos.
+	StorageCheck   StorageCheck    `yaml:"storage_check"`   // Reconciliation of the storage with the photos table.
+	MetadataPolicy metadata.Policy `yaml:"metadata_policy"` // Metadata stripped from served originals when an event does not override it.
+	DevMode        DevMode         `yaml:"dev_mode"`        // Development mode settings.
+	Server         Server          `yaml:"server"`          // Server-related configuration.
+	Security       Security        `yaml:"security"`        // Security settings such as CSRF and session tokens.
+	DB             DB              `yaml:"db"`              // Database connection details for development and production.
+	BaseURLs       BaseURLs        `yaml:"base_urls"`       // URLs for different environments (Dev and Prod).
+	Routes         Routes          `yaml:"routes"`          // Application route paths.
+
+	PhotosDir string `yaml:"photos_directory,omitempty"` // Deprecated: directory of the local storage, set by older config files.
 
 	HttpClient *http.Client       `yaml:"-"` // HTTP client instance (excluded from YAML).
 	Templates  *template.Template `yaml:"-"` // Parsed HTML templates (excluded from YAML).
 	Logger     zerolog.Logger     `yaml:"-"` // Logger instance (excluded from YAML).
 }
 
+// Storage selects the backend storing the files of the photos and holds its settings.
+type Storage struct {
+	storage.Storage `yaml:"-"`   // Embedded backend opened from the settings (excluded from YAML).
+	Backend         string       `yaml:"backend"` // Either "local" or "s3".
+	Local           LocalStorage `yaml:"local"`   // Settings of the local backend.
+	S3              S3Storage    `yaml:"s3"`      // Settings of the S3 backend.
+}
+
+// LocalStorage holds the settings of the backend storing photos on the disk of the server.
+type LocalStorage struct {
+	Directory string `yaml:"directory"` // Path to the photos directory on the machine.
+}
+
+// S3Storage holds the settings of the backend storing photos in a bucket of an S3-compatible object storage.
+type S3Storage struct {
+	Endpoint  string `yaml:"endpoint"`   // Host and port of the server, without scheme.
+	Region    string `yaml:"region"`     // Region of the bucket.
+	Bucket    string `yaml:"bucket"`     // Name of the bucket, which must already exist.
+	AccessKey string `yaml:"access_key"` // Access key ID.
+	SecretKey string `yaml:"secret_key"` // Secret access key.
+	UseSSL    bool   `yaml:"use_ssl"`    // Whether to connect to the server with HTTPS.
+}
+
+// Uploads holds the configuration of the resumable uploads, which are staged on the local disk until they are complete.
+type Uploads struct {
+	*tus.Staging `yaml:"-"`    // Embedded staging area of the uploads in progress (excluded from YAML).
+	StagingDir   string        `yaml:"staging_directory"` // Path to the directory holding the uploads in progress.
+	MaxSize      int64         `yaml:"max_size"`          // Maximum size of an uploaded file in bytes.
+	MaxPixels    int           `yaml:"max_pixels"`        // Maximum number of pixels of an uploaded photo, larger ones are rejected before being decoded.
+	ChunkSize    int64         `yaml:"chunk_size"`        // Size of the chunks sent by the upload form, the data received from an interrupted chunk is kept.
+	Expiration   time.Duration `yaml:"expiration"`        // Duration after which unfinished uploads are discarded.
+}
+
+// Trash holds the configuration of the trash, where deleted photos are kept until they are purged.
+type Trash struct {
+	Retention     time.Duration `yaml:"retention"`      // Duration during which deleted photos can be restored.
+	PurgeInterval time.Duration `yaml:"purge_interval"` // Interval between two purges of the expired photos.
+}
+
+// Reports holds the configuration of the moderation of reported photos.
+type Reports struct {
+	AutoHideThreshold int64 `yaml:"auto_hide_threshold"` // Number of users reporting a photo for it to be hidden until moderated, 0 to never hide.
+	HistoryLength     int32 `yaml:"history_length"`      // Number of moderated reports listed in the history.
+}
+
+// Similarity holds the configuration of the detection of near-duplicate photos by their perceptual hashes.
+type Similarity struct {
+	MaxDistance int   `yaml:"max_distance"` // Number of bits by which the hashes of two photos may differ for them to be similar (0-64).
+	Limit       int32 `yaml:"limit"`        // Maximum number of similar photos listed for a photo.
+}
+
+// Jobs holds the configuration of the background jobs, which generate the derivatives, metadata and hashes
+// of the uploaded photos outside of the upload requests.
+type Jobs struct {
+	*jobs.Queue   `yaml:"-"`    // Embedded queue running the jobs (excluded from YAML).
+	Workers       int           `yaml:"workers"`        // Number of jobs processed concurrently.
+	PollInterval  time.Duration `yaml:"poll_interval"`  // Interval at which idle workers look for due jobs.
+	Timeout       time.Duration `yaml:"timeout"`        // Maximum duration of a job, after which it is attempted again.
+	MaxAttempts   uint32        `yaml:"max_attempts"`   // Number of attempts after which a failing job is given up.
+	Backoff       time.Duration `yaml:"backoff"`        // Delay before the first retry of a failed job, doubled at each attempt.
+	MaxBackoff    time.Duration `yaml:"max_backoff"`    // Maximum delay between two attempts of a job.
+	HistoryLength int32         `yaml:"history_length"` // Number of jobs listed on the page of the jobs.
+}
+
+// StorageCheck holds the configuration of the check reconciling the files of the storage with the photos table.
+type StorageCheck struct {
+	GracePeriod time.Duration `yaml:"grace_period"` // Age below which files and photos are not checked, their upload may be in progress.
+}
+
+// Derivatives holds the configuration of the resized copies generated for every uploaded photo.
+// Thumbnails are displayed in the galleries while previews are displayed when a photo is opened.
+type Derivatives struct {
+	ThumbnailSize int `yaml:"thumbnail_size"` // Maximum length in pixels of the longest side of thumbnails.
+	PreviewSize   int `yaml:"preview_size"`   // Maximum length in pixels of the longest side of previews.
+	JPEGQuality   int `yaml:"jpeg_quality"`   // JPEG quality (1-100) used to encode thumbnails and previews.
+}
+
 // DevMode contains the configuration for development mode.
 type DevMode struct {
 	Enabled bool `yaml:"enabled"` // Indicates if development mode is enabled.
@@ -65,10 +157,25 @@ type SessionToken struct {
 	SecureCookie *securecookie.SecureCookie `yaml:"-"` // SecureCookie instance for session handling (excluded from YAML).
 }
 
+// UnlockToken represents the configuration for the cookies remembering the password-protected events a user unlocked.
+type UnlockToken struct {
+	Token
+	SecureCookie *securecookie.SecureCookie `yaml:"-"` // SecureCookie instance for unlock cookies (excluded from YAML).
+}
+
+// PhotoURLs represents the configuration for the signed URLs of the photo files.
+type PhotoURLs struct {
+	Secret          secretKey     `yaml:"secret"`     // The secret key used to sign the URLs.
+	Expiration      time.Duration `yaml:"expiration"` // Minimum duration during which a signed URL stays valid.
+	*urlsign.Signer `yaml:"-"`    // Signer of the URLs (excluded from YAML).
+}
+
 // Security holds the security-related configurations such as CSRF and session tokens.
 type Security struct {
-	Csrf    CsrfToken    `yaml:"csrf"`    // CSRF token configuration.
-	Session SessionToken `yaml:"session"` // Session token configuration.
+	Csrf        CsrfToken    `yaml:"csrf"`         // CSRF token configuration.
+	Session     SessionToken `yaml:"session"`      // Session token configuration.
+	EventUnlock UnlockToken  `yaml:"event_unlock"` // Unlocked events cookie configuration.
+	PhotoURL    PhotoURLs    `yaml:"photo_url"`    // Signed photo URLs configuration.
 }
 
 // DSN represents the Data Source Name (DSN) configuration for database connections.
@@ -93,14 +200,41 @@ type DB struct {
 
 // Routes contains the paths for various application routes.
 type Routes struct {
-	Favicon     string `yaml:"favicon"`      // Path to the favicon.
-	Landing     string `yaml:"landing"`      // Path to the landing page.
-	Login       string `yaml:"login"`        // Path to the login page.
-	CasCallback string `yaml:"cas_callback"` // Path to the CAS callback.
-	Dashboard   string `yaml:"dashboard"`    // Path to the user dashboard.
-	Logout      string `yaml:"logout"`       // Path to the logout page.
-	Event       string `yaml:"event"`        // Path to the event page.
-	Photos      string `yaml:"photos"`       // Path to the photos page.
+	Favicon           string `yaml:"favicon"`             // Path to the favicon.
+	Landing           string `yaml:"landing"`             // Path to the landing page.
+	Login             string `yaml:"login"`               // Path to the login page.
+	CasCallback       string `yaml:"cas_callback"`        // Path to the CAS callback.
+	Dashboard         string `yaml:"dashboard"`           // Path to the user dashboard.
+	Logout            string `yaml:"logout"`              // Path to the logout page.
+	Event             string `yaml:"event"`               // Path to the event page.
+	EventArchive      string `yaml:"event_archive"`       // Path serving the photos of an event as a ZIP archive.
+	MetadataPolicy    string `yaml:"metadata_policy"`     // Path changing the metadata policy of an event.
+	EventPassword     string `yaml:"event_password"`      // Path setting or removing the password of an event.
+	Trash             string `yaml:"trash"`               // Path to the trash page of the admins.
+	HidePhoto         string `yaml:"hide_photo"`          // Path hiding or showing a photo.
+	DeletePhoto       string `yaml:"delete_photo"`        // Path moving a photo to the trash.
+	RestorePhoto      string `yaml:"restore_photo"`       // Path restoring a photo from the trash.
+	BulkPhotos        string `yaml:"bulk_photos"`         // Path applying an action to the photos selected in an event.
+	Reports           string `yaml:"reports"`             // Path to the moderation queue of the admins.
+	ReportPhoto       string `yaml:"report_photo"`        // Path receiving the reports of photos.
+	Duplicates        string `yaml:"duplicates"`          // Path listing the near-duplicate photos of an event.
+	SimilarPhotos     string `yaml:"similar_photos"`      // Path listing the photos similar to a photo.
+	Jobs              string `yaml:"jobs"`                // Path listing the background jobs to the admins.
+	StorageCheck      string `yaml:"storage_check"`       // Path listing the inconsistencies between the storage and the photos table.
+	EventUnlock       string `yaml:"event_unlock"`        // Path receiving the passwords of protected events.
+	Tag               string `yaml:"tag"`                 // Path listing the photos of a tag.
+	TagSuggestions    string `yaml:"tag_suggestions"`     // Path suggesting existing tags while a tag is typed.
+	PhotoTags         string `yaml:"photo_tags"`          // Path listing and adding the tags of a photo.
+	Search            string `yaml:"search"`              // Path searching events by their text and the tags of their photos.
+	Folders           string `yaml:"folders"`             // Path listing the personal folders of the user and those shared with them.
+	Folder            string `yaml:"folder"`              // Path to the page of a personal folder, also prefixing the paths changing it.
+	PhotoPeople       string `yaml:"photo_people"`        // Path listing and adding the users appearing in a photo.
+	UserSuggestions   string `yaml:"user_suggestions"`    // Path suggesting users while a name or an email address is typed.
+	MyPhotos          string `yaml:"my_photos"`           // Path listing the photos the user appears in.
+	Photos            string `yaml:"photos"`              // Path to the photos page.
+	PhotoFile         string `yaml:"photo_file"`          // Path serving the image files of a photo.
+	OriginalPhotoFile string `yaml:"original_photo_file"` // Path serving originals with their metadata to admins.
+	Uploads           string `yaml:"uploads"`             // Path of the resumable upload endpoint.
 }
 
 // BaseURL represents the configuration for a set of URLs.
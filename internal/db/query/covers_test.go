@@ -0,0 +1,112 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetEventCoversByParentID ensures that automatic covers skip the photos of protected sub-events and of the
+// events nested in them. It runs against an empty MySQL database whose DSN is read from PHOTOS_TEST_DSN, and
+// creates the tables of the schema in it.
+func TestGetEventCoversByParentID(t *testing.T) {
+	dsn := os.Getenv("PHOTOS_TEST_DSN")
+	if dsn == "" {
+		t.Skip("PHOTOS_TEST_DSN is not set")
+	}
+	ctx := context.Background()
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if !assert.NoError(t, err, "PHOTOS_TEST_DSN should be a valid DSN") {
+		return
+	}
+	mysqlCfg.ParseTime = true
+	db, err := sql.Open("mysql", mysqlCfg.FormatDSN())
+	if !assert.NoError(t, err, "Opening the test database should not fail") {
+		return
+	}
+	// Closed after the tables are dropped by the cleanup of createSchema
+	t.Cleanup(func() { db.Close() })
+	if !createSchema(t, db) {
+		return
+	}
+	q := New(db)
+
+	event := func(name string, parentID uint32, protected bool) uint32 {
+		t.Helper()
+		params := CreateEventParams{Name: name, EventDate: time.Now()}
+		if parentID != 0 {
+			params.ParentEventID = sql.NullInt32{Int32: int32(parentID), Valid: true}
+		}
+		assert.NoError(t, q.CreateEvent(ctx, params), "Creating an event should not fail")
+		e, err := q.GetEventByNameAndParentID(ctx, GetEventByNameAndParentIDParams{Name: name, ParentEventID: params.ParentEventID})
+		assert.NoError(t, err, "The created event should be found")
+		if protected {
+			err = q.UpdateEventPassword(ctx, UpdateEventPasswordParams{PasswordHash: sql.NullString{String: "hash", Valid: true}, EventID: e.EventID})
+			assert.NoError(t, err, "Protecting an event should not fail")
+		}
+		return e.EventID
+	}
+	photo := func(eventID uint32, name string) uint32 {
+		t.Helper()
+		id, err := q.CreatePhoto(ctx, CreatePhotoParams{PhotoHash: name, OriginalFilename: name + ".jpg", PathToPhoto: name, PathToThumbnail: name, PathToPreview: name, EventID: eventID})
+		assert.NoError(t, err, "Creating a photo should not fail")
+		return uint32(id)
+	}
+	covers := func(parentID sql.NullInt32) map[uint32]GetEventCoversByParentIDRow {
+		t.Helper()
+		rows, err := q.GetEventCoversByParentID(ctx, GetEventCoversByParentIDParams{ParentEventID: parentID})
+		assert.NoError(t, err, "GetEventCoversByParentID should not fail")
+		byEvent := make(map[uint32]GetEventCoversByParentIDRow, len(rows))
+		for _, row := range rows {
+			byEvent[row.EventID] = row
+		}
+		return byEvent
+	}
+
+	// The only photos of the gala are in a sub-event of a protected sub-event, which has no password of its own
+	gala := event("Gala", 0, false)
+	backstage := event("Coulisses", gala, true)
+	lockedPhoto := photo(event("Loges", backstage, false), "loges")
+	party := event("Soirée", 0, false)
+	publicPhoto := photo(event("Piste", event("Salle", party, false), false), "piste")
+
+	topLevel := covers(sql.NullInt32{})
+	assert.NotContains(t, topLevel, gala, "Photos nested under a protected sub-event should not become covers")
+	assert.Equal(t, publicPhoto, topLevel[party].PhotoID, "Photos nested in unprotected sub-events should become covers")
+
+	children := covers(sql.NullInt32{Int32: int32(gala), Valid: true})
+	assert.Equal(t, lockedPhoto, children[backstage].PhotoID, "A protected event should get a cover from its own sub-events")
+	assert.True(t, children[backstage].PasswordHash.Valid, "The password of a protected event should be returned for its cover to be hidden")
+}
+
+// createSchema creates the tables of the schema in the test database, and drops them at the end of the test.
+func createSchema(t *testing.T, db *sql.DB) bool {
+	schema, err := os.ReadFile("../../../schema.sql")
+	if !assert.NoError(t, err, "Reading the schema should not fail") {
+		return false
+	}
+	tables := regexp.MustCompile(`CREATE TABLE (\w+)`).FindAllStringSubmatch(string(schema), -1)
+	t.Cleanup(func() {
+		// Tables only reference the ones created before them
+		for i := len(tables) - 1; i >= 0; i-- {
+			_, err := db.Exec("DROP TABLE IF EXISTS " + tables[i][1])
+			assert.NoError(t, err, "Dropping the table %s should not fail", tables[i][1])
+		}
+	})
+	for _, statement := range strings.Split(string(schema), ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err = db.Exec(statement); !assert.NoError(t, err, "Creating the schema should not fail") {
+			return false
+		}
+	}
+	return true
+}
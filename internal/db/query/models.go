@@ -7,10 +7,185 @@ package query
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
+type EventsMetadataPolicy string
+
+const (
+	EventsMetadataPolicyAll  EventsMetadataPolicy = "all"
+	EventsMetadataPolicyGps  EventsMetadataPolicy = "gps"
+	EventsMetadataPolicyNone EventsMetadataPolicy = "none"
+)
+
+func (e *EventsMetadataPolicy) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = EventsMetadataPolicy(s)
+	case string:
+		*e = EventsMetadataPolicy(s)
+	default:
+		return fmt.Errorf("unsupported scan type for EventsMetadataPolicy: %T", src)
+	}
+	return nil
+}
+
+type NullEventsMetadataPolicy struct {
+	EventsMetadataPolicy EventsMetadataPolicy
+	Valid                bool // Valid is true if EventsMetadataPolicy is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullEventsMetadataPolicy) Scan(value interface{}) error {
+	if value == nil {
+		ns.EventsMetadataPolicy, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.EventsMetadataPolicy.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullEventsMetadataPolicy) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.EventsMetadataPolicy), nil
+}
+
+type JobsStatus string
+
+const (
+	JobsStatusPending   JobsStatus = "pending"
+	JobsStatusRunning   JobsStatus = "running"
+	JobsStatusSucceeded JobsStatus = "succeeded"
+	JobsStatusFailed    JobsStatus = "failed"
+)
+
+func (e *JobsStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = JobsStatus(s)
+	case string:
+		*e = JobsStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for JobsStatus: %T", src)
+	}
+	return nil
+}
+
+type NullJobsStatus struct {
+	JobsStatus JobsStatus
+	Valid      bool // Valid is true if JobsStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullJobsStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.JobsStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.JobsStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullJobsStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.JobsStatus), nil
+}
+
+type PhotoReportsReason string
+
+const (
+	PhotoReportsReasonInappropriate PhotoReportsReason = "inappropriate"
+	PhotoReportsReasonPrivacy       PhotoReportsReason = "privacy"
+	PhotoReportsReasonCopyright     PhotoReportsReason = "copyright"
+	PhotoReportsReasonOther         PhotoReportsReason = "other"
+)
+
+func (e *PhotoReportsReason) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PhotoReportsReason(s)
+	case string:
+		*e = PhotoReportsReason(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PhotoReportsReason: %T", src)
+	}
+	return nil
+}
+
+type NullPhotoReportsReason struct {
+	PhotoReportsReason PhotoReportsReason
+	Valid              bool // Valid is true if PhotoReportsReason is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPhotoReportsReason) Scan(value interface{}) error {
+	if value == nil {
+		ns.PhotoReportsReason, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PhotoReportsReason.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPhotoReportsReason) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PhotoReportsReason), nil
+}
+
+type PhotoReportsStatus string
+
+const (
+	PhotoReportsStatusOpen      PhotoReportsStatus = "open"
+	PhotoReportsStatusDismissed PhotoReportsStatus = "dismissed"
+	PhotoReportsStatusResolved  PhotoReportsStatus = "resolved"
+)
+
+func (e *PhotoReportsStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = PhotoReportsStatus(s)
+	case string:
+		*e = PhotoReportsStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for PhotoReportsStatus: %T", src)
+	}
+	return nil
+}
+
+type NullPhotoReportsStatus struct {
+	PhotoReportsStatus PhotoReportsStatus
+	Valid              bool // Valid is true if PhotoReportsStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullPhotoReportsStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.PhotoReportsStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.PhotoReportsStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullPhotoReportsStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.PhotoReportsStatus), nil
+}
+
 type UsersBusinessCategory string
 
 const (
@@ -54,25 +229,101 @@ func (ns NullUsersBusinessCategory) Value() (driver.Value, error) {
 }
 
 type Event struct {
-	EventID       uint32
-	Name          string
-	Description   string
-	EventDate     time.Time
-	CreationDate  time.Time
-	ParentEventID sql.NullInt32
+	EventID        uint32
+	Name           string
+	Description    string
+	EventDate      time.Time
+	CreationDate   time.Time
+	MetadataPolicy NullEventsMetadataPolicy
+	PasswordHash   sql.NullString
+	ParentEventID  sql.NullInt32
+}
+
+type EventCover struct {
+	EventID      uint32
+	PhotoID      uint32
+	CreationDate time.Time
+}
+
+type Job struct {
+	JobID        uint32
+	Kind         string
+	Payload      json.RawMessage
+	Status       JobsStatus
+	Attempts     uint32
+	LastError    sql.NullString
+	RunAfter     time.Time
+	CreationDate time.Time
+	FinishDate   sql.NullTime
+}
+
+type PerceptualHash struct {
+	PhotoHash    string
+	Dhash        uint64
+	CreationDate time.Time
 }
 
 type Photo struct {
+	PhotoID          uint32
+	PhotoHash        string
+	OriginalFilename string
+	PathToPhoto      string
+	PathToThumbnail  string
+	PathToPreview    string
+	CreationDate     time.Time
+	IsHidden         bool
+	DeletionDate     sql.NullTime
+	EventID          uint32
+}
+
+type PhotoMetadatum struct {
+	PhotoID      uint32
+	CaptureDate  sql.NullTime
+	CameraMake   sql.NullString
+	CameraModel  sql.NullString
+	LensModel    sql.NullString
+	Width        uint32
+	Height       uint32
+	Orientation  uint16
+	ExposureTime sql.NullString
+	FNumber      sql.NullFloat64
+	Iso          sql.NullInt32
+	FocalLength  sql.NullFloat64
+	GpsLatitude  sql.NullFloat64
+	GpsLongitude sql.NullFloat64
+	GpsAltitude  sql.NullFloat64
+}
+
+type PhotoReport struct {
+	ReportID       uint32
+	Reason         PhotoReportsReason
+	Comment        string
+	Status         PhotoReportsStatus
+	HidPhoto       bool
+	CreationDate   time.Time
+	ResolutionDate sql.NullTime
+	PhotoID        uint32
+	UserID         uint32
+	ModeratorID    sql.NullInt32
+}
+
+type PhotoTag struct {
 	PhotoID      uint32
-	PathToPhoto  string
+	TagID        uint32
 	CreationDate time.Time
-	EventID      uint32
+	UserID       uint32
 }
 
 type RecognizedUser struct {
 	RecognizedUserID uint32
+	BoxX             sql.NullFloat64
+	BoxY             sql.NullFloat64
+	BoxWidth         sql.NullFloat64
+	BoxHeight        sql.NullFloat64
+	CreationDate     time.Time
 	UserID           uint32
 	PhotoID          uint32
+	TaggedBy         uint32
 }
 
 type Session struct {
@@ -82,6 +333,22 @@ type Session struct {
 	SessionToken string
 }
 
+type Tag struct {
+	TagID        uint32
+	Name         string
+	IsCurated    bool
+	CreationDate time.Time
+}
+
+type Upload struct {
+	UploadID     string
+	Filename     string
+	UploadLength uint64
+	CreationDate time.Time
+	UserID       uint32
+	EventID      uint32
+}
+
 type User struct {
 	UserID           uint32
 	SignupDate       time.Time
@@ -104,3 +371,15 @@ type UserFolder struct {
 	UserID         uint32
 	ParentFolderID sql.NullInt32
 }
+
+type UserFolderPhoto struct {
+	UserFolderID uint32
+	PhotoID      uint32
+	CreationDate time.Time
+}
+
+type UserFolderShare struct {
+	UserFolderID uint32
+	UserID       uint32
+	CreationDate time.Time
+}
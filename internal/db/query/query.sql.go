@@ -8,9 +8,41 @@ package query
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+const addPhotoTag = `-- name: AddPhotoTag :exec
+INSERT IGNORE INTO photo_tags (photo_id, tag_id, user_id)
+VALUES (?, ?, ?)
+`
+
+type AddPhotoTagParams struct {
+	PhotoID uint32
+	TagID   uint32
+	UserID  uint32
+}
+
+func (q *Queries) AddPhotoTag(ctx context.Context, arg AddPhotoTagParams) error {
+	_, err := q.db.ExecContext(ctx, addPhotoTag, arg.PhotoID, arg.TagID, arg.UserID)
+	return err
+}
+
+const addPhotoToUserFolder = `-- name: AddPhotoToUserFolder :exec
+INSERT IGNORE INTO user_folder_photos (user_folder_id, photo_id)
+VALUES (?, ?)
+`
+
+type AddPhotoToUserFolderParams struct {
+	UserFolderID uint32
+	PhotoID      uint32
+}
+
+func (q *Queries) AddPhotoToUserFolder(ctx context.Context, arg AddPhotoToUserFolderParams) error {
+	_, err := q.db.ExecContext(ctx, addPhotoToUserFolder, arg.UserFolderID, arg.PhotoID)
+	return err
+}
+
 const attemptCreatingUser = `-- name: AttemptCreatingUser :exec
 INSERT INTO users (email, full_name, business_category, department_number)
 VALUES (?, ?, ?, ?)
@@ -34,16 +66,175 @@ func (q *Queries) AttemptCreatingUser(ctx context.Context, arg AttemptCreatingUs
 	return err
 }
 
+const closePhotoReports = `-- name: ClosePhotoReports :exec
+UPDATE photo_reports
+SET status = ?, resolution_date = CURRENT_TIMESTAMP, moderator_id = ?
+WHERE photo_id = ? AND status = 'open'
+`
+
+type ClosePhotoReportsParams struct {
+	Status      PhotoReportsStatus
+	ModeratorID sql.NullInt32
+	PhotoID     uint32
+}
+
+func (q *Queries) ClosePhotoReports(ctx context.Context, arg ClosePhotoReportsParams) error {
+	_, err := q.db.ExecContext(ctx, closePhotoReports, arg.Status, arg.ModeratorID, arg.PhotoID)
+	return err
+}
+
+const completeJob = `-- name: CompleteJob :exec
+UPDATE jobs
+SET status = 'succeeded', finish_date = CURRENT_TIMESTAMP
+WHERE job_id = ?
+`
+
+func (q *Queries) CompleteJob(ctx context.Context, jobID uint32) error {
+	_, err := q.db.ExecContext(ctx, completeJob, jobID)
+	return err
+}
+
+const copyPhotoTags = `-- name: CopyPhotoTags :exec
+INSERT IGNORE INTO photo_tags (photo_id, tag_id, user_id)
+SELECT p.photo_id, pt.tag_id, pt.user_id
+FROM photo_tags pt
+JOIN photos p ON p.photo_id = ?
+WHERE pt.photo_id = ?
+`
+
+type CopyPhotoTagsParams struct {
+	NewPhotoID uint32
+	PhotoID    uint32
+}
+
+func (q *Queries) CopyPhotoTags(ctx context.Context, arg CopyPhotoTagsParams) error {
+	_, err := q.db.ExecContext(ctx, copyPhotoTags, arg.NewPhotoID, arg.PhotoID)
+	return err
+}
+
+const copyPhotoUserFolders = `-- name: CopyPhotoUserFolders :exec
+INSERT IGNORE INTO user_folder_photos (user_folder_id, photo_id, creation_date)
+SELECT fp.user_folder_id, p.photo_id, fp.creation_date
+FROM user_folder_photos fp
+JOIN photos p ON p.photo_id = ?
+WHERE fp.photo_id = ?
+`
+
+type CopyPhotoUserFoldersParams struct {
+	NewPhotoID uint32
+	PhotoID    uint32
+}
+
+func (q *Queries) CopyPhotoUserFolders(ctx context.Context, arg CopyPhotoUserFoldersParams) error {
+	_, err := q.db.ExecContext(ctx, copyPhotoUserFolders, arg.NewPhotoID, arg.PhotoID)
+	return err
+}
+
+const copyRecognizedUsers = `-- name: CopyRecognizedUsers :exec
+INSERT IGNORE INTO recognized_users (box_x, box_y, box_width, box_height, creation_date, user_id, photo_id, tagged_by)
+SELECT r.box_x, r.box_y, r.box_width, r.box_height, r.creation_date, r.user_id, p.photo_id, r.tagged_by
+FROM recognized_users r
+JOIN photos p ON p.photo_id = ?
+WHERE r.photo_id = ?
+`
+
+type CopyRecognizedUsersParams struct {
+	NewPhotoID uint32
+	PhotoID    uint32
+}
+
+func (q *Queries) CopyRecognizedUsers(ctx context.Context, arg CopyRecognizedUsersParams) error {
+	_, err := q.db.ExecContext(ctx, copyRecognizedUsers, arg.NewPhotoID, arg.PhotoID)
+	return err
+}
+
+const countJobsByStatus = `-- name: CountJobsByStatus :many
+SELECT status, COUNT(*) AS count
+FROM jobs
+GROUP BY status
+`
+
+type CountJobsByStatusRow struct {
+	Status JobsStatus
+	Count  int64
+}
+
+func (q *Queries) CountJobsByStatus(ctx context.Context) ([]CountJobsByStatusRow, error) {
+	rows, err := q.db.QueryContext(ctx, countJobsByStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountJobsByStatusRow
+	for rows.Next() {
+		var i CountJobsByStatusRow
+		if err := rows.Scan(
+			&i.Status,
+			&i.Count,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countPhotoReporters = `-- name: CountPhotoReporters :one
+SELECT COUNT(DISTINCT user_id) FROM photo_reports WHERE photo_id = ? AND status = 'open'
+`
+
+func (q *Queries) CountPhotoReporters(ctx context.Context, photoID uint32) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPhotoReporters, photoID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPhotosByHash = `-- name: CountPhotosByHash :one
+SELECT COUNT(*) FROM photos WHERE photo_hash = ?
+FOR UPDATE
+`
+
+func (q *Queries) CountPhotosByHash(ctx context.Context, photoHash string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPhotosByHash, photoHash)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUserFolderShares = `-- name: CountUserFolderShares :one
+SELECT COUNT(*) FROM user_folder_shares WHERE user_folder_id = ? AND user_id = ?
+`
+
+type CountUserFolderSharesParams struct {
+	UserFolderID uint32
+	UserID       uint32
+}
+
+func (q *Queries) CountUserFolderShares(ctx context.Context, arg CountUserFolderSharesParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUserFolderShares, arg.UserFolderID, arg.UserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createEvent = `-- name: CreateEvent :exec
-INSERT INTO events (name, description, event_date, parent_event_id)
-VALUES (?, ?, ?, ?)
+INSERT INTO events (name, description, event_date, metadata_policy, parent_event_id)
+VALUES (?, ?, ?, ?, ?)
 `
 
 type CreateEventParams struct {
-	Name          string
-	Description   string
-	EventDate     time.Time
-	ParentEventID sql.NullInt32
+	Name           string
+	Description    string
+	EventDate      time.Time
+	MetadataPolicy NullEventsMetadataPolicy
+	ParentEventID  sql.NullInt32
 }
 
 func (q *Queries) CreateEvent(ctx context.Context, arg CreateEventParams) error {
@@ -51,23 +242,138 @@ func (q *Queries) CreateEvent(ctx context.Context, arg CreateEventParams) error
 		arg.Name,
 		arg.Description,
 		arg.EventDate,
+		arg.MetadataPolicy,
 		arg.ParentEventID,
 	)
 	return err
 }
 
-const createPhoto = `-- name: CreatePhoto :exec
-INSERT INTO photos (path_to_photo, event_id)
+const createJob = `-- name: CreateJob :exec
+INSERT INTO jobs (kind, payload, run_after)
+VALUES (?, ?, ?)
+`
+
+type CreateJobParams struct {
+	Kind     string
+	Payload  json.RawMessage
+	RunAfter time.Time
+}
+
+func (q *Queries) CreateJob(ctx context.Context, arg CreateJobParams) error {
+	_, err := q.db.ExecContext(ctx, createJob, arg.Kind, arg.Payload, arg.RunAfter)
+	return err
+}
+
+const createPerceptualHash = `-- name: CreatePerceptualHash :exec
+INSERT IGNORE INTO perceptual_hashes (photo_hash, dhash)
 VALUES (?, ?)
 `
 
+type CreatePerceptualHashParams struct {
+	PhotoHash string
+	Dhash     uint64
+}
+
+func (q *Queries) CreatePerceptualHash(ctx context.Context, arg CreatePerceptualHashParams) error {
+	_, err := q.db.ExecContext(ctx, createPerceptualHash, arg.PhotoHash, arg.Dhash)
+	return err
+}
+
+const createPhoto = `-- name: CreatePhoto :execlastid
+INSERT INTO photos (photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, event_id)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
 type CreatePhotoParams struct {
-	PathToPhoto string
-	EventID     uint32
+	PhotoHash        string
+	OriginalFilename string
+	PathToPhoto      string
+	PathToThumbnail  string
+	PathToPreview    string
+	EventID          uint32
+}
+
+func (q *Queries) CreatePhoto(ctx context.Context, arg CreatePhotoParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createPhoto,
+		arg.PhotoHash,
+		arg.OriginalFilename,
+		arg.PathToPhoto,
+		arg.PathToThumbnail,
+		arg.PathToPreview,
+		arg.EventID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const createPhotoMetadata = `-- name: CreatePhotoMetadata :exec
+INSERT INTO photo_metadata (
+    photo_id, capture_date, camera_make, camera_model, lens_model, width, height, orientation,
+    exposure_time, f_number, iso, focal_length, gps_latitude, gps_longitude, gps_altitude
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+type CreatePhotoMetadataParams struct {
+	PhotoID      uint32
+	CaptureDate  sql.NullTime
+	CameraMake   sql.NullString
+	CameraModel  sql.NullString
+	LensModel    sql.NullString
+	Width        uint32
+	Height       uint32
+	Orientation  uint16
+	ExposureTime sql.NullString
+	FNumber      sql.NullFloat64
+	Iso          sql.NullInt32
+	FocalLength  sql.NullFloat64
+	GpsLatitude  sql.NullFloat64
+	GpsLongitude sql.NullFloat64
+	GpsAltitude  sql.NullFloat64
+}
+
+func (q *Queries) CreatePhotoMetadata(ctx context.Context, arg CreatePhotoMetadataParams) error {
+	_, err := q.db.ExecContext(ctx, createPhotoMetadata,
+		arg.PhotoID,
+		arg.CaptureDate,
+		arg.CameraMake,
+		arg.CameraModel,
+		arg.LensModel,
+		arg.Width,
+		arg.Height,
+		arg.Orientation,
+		arg.ExposureTime,
+		arg.FNumber,
+		arg.Iso,
+		arg.FocalLength,
+		arg.GpsLatitude,
+		arg.GpsLongitude,
+		arg.GpsAltitude,
+	)
+	return err
+}
+
+const createPhotoReport = `-- name: CreatePhotoReport :exec
+INSERT INTO photo_reports (reason, comment, photo_id, user_id)
+VALUES (?, ?, ?, ?)
+`
+
+type CreatePhotoReportParams struct {
+	Reason  PhotoReportsReason
+	Comment string
+	PhotoID uint32
+	UserID  uint32
 }
 
-func (q *Queries) CreatePhoto(ctx context.Context, arg CreatePhotoParams) error {
-	_, err := q.db.ExecContext(ctx, createPhoto, arg.PathToPhoto, arg.EventID)
+func (q *Queries) CreatePhotoReport(ctx context.Context, arg CreatePhotoReportParams) error {
+	_, err := q.db.ExecContext(ctx, createPhotoReport,
+		arg.Reason,
+		arg.Comment,
+		arg.PhotoID,
+		arg.UserID,
+	)
 	return err
 }
 
@@ -86,6 +392,72 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) er
 	return err
 }
 
+const createTag = `-- name: CreateTag :exec
+INSERT IGNORE INTO tags (name, is_curated)
+VALUES (?, ?)
+`
+
+type CreateTagParams struct {
+	Name      string
+	IsCurated bool
+}
+
+func (q *Queries) CreateTag(ctx context.Context, arg CreateTagParams) error {
+	_, err := q.db.ExecContext(ctx, createTag, arg.Name, arg.IsCurated)
+	return err
+}
+
+const createUpload = `-- name: CreateUpload :exec
+INSERT INTO uploads (upload_id, filename, upload_length, user_id, event_id)
+VALUES (?, ?, ?, ?, ?)
+`
+
+type CreateUploadParams struct {
+	UploadID     string
+	Filename     string
+	UploadLength uint64
+	UserID       uint32
+	EventID      uint32
+}
+
+func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) error {
+	_, err := q.db.ExecContext(ctx, createUpload,
+		arg.UploadID,
+		arg.Filename,
+		arg.UploadLength,
+		arg.UserID,
+		arg.EventID,
+	)
+	return err
+}
+
+const createUserFolder = `-- name: CreateUserFolder :execlastid
+INSERT INTO user_folders (is_sub_folder, name, description, user_id, parent_folder_id)
+VALUES (?, ?, ?, ?, ?)
+`
+
+type CreateUserFolderParams struct {
+	IsSubFolder    sql.NullBool
+	Name           string
+	Description    string
+	UserID         uint32
+	ParentFolderID sql.NullInt32
+}
+
+func (q *Queries) CreateUserFolder(ctx context.Context, arg CreateUserFolderParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createUserFolder,
+		arg.IsSubFolder,
+		arg.Name,
+		arg.Description,
+		arg.UserID,
+		arg.ParentFolderID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
 const deleteEvent = `-- name: DeleteEvent :exec
 DELETE FROM events WHERE event_id = ?
 `
@@ -95,6 +467,15 @@ func (q *Queries) DeleteEvent(ctx context.Context, eventID uint32) error {
 	return err
 }
 
+const deleteEventCover = `-- name: DeleteEventCover :exec
+DELETE FROM event_covers WHERE event_id = ?
+`
+
+func (q *Queries) DeleteEventCover(ctx context.Context, eventID uint32) error {
+	_, err := q.db.ExecContext(ctx, deleteEventCover, eventID)
+	return err
+}
+
 const deletePhoto = `-- name: DeletePhoto :exec
 DELETE FROM photos WHERE photo_id = ?
 `
@@ -113,26 +494,64 @@ func (q *Queries) DeleteSessionWithToken(ctx context.Context, sessionToken strin
 	return err
 }
 
-const getEventByID = `-- name: GetEventByID :many
-SELECT event_id, name, description, event_date, creation_date, parent_event_id FROM events WHERE event_id = ?
+const deleteUpload = `-- name: DeleteUpload :exec
+DELETE FROM uploads WHERE upload_id = ?
 `
 
-func (q *Queries) GetEventByID(ctx context.Context, eventID uint32) ([]Event, error) {
-	rows, err := q.db.QueryContext(ctx, getEventByID, eventID)
+func (q *Queries) DeleteUpload(ctx context.Context, uploadID string) error {
+	_, err := q.db.ExecContext(ctx, deleteUpload, uploadID)
+	return err
+}
+
+const deleteUserFolder = `-- name: DeleteUserFolder :exec
+DELETE FROM user_folders WHERE user_folder_id = ?
+`
+
+func (q *Queries) DeleteUserFolder(ctx context.Context, userFolderID uint32) error {
+	_, err := q.db.ExecContext(ctx, deleteUserFolder, userFolderID)
+	return err
+}
+
+const failJob = `-- name: FailJob :exec
+UPDATE jobs
+SET status = 'failed', last_error = ?, finish_date = CURRENT_TIMESTAMP
+WHERE job_id = ?
+`
+
+type FailJobParams struct {
+	LastError sql.NullString
+	JobID     uint32
+}
+
+func (q *Queries) FailJob(ctx context.Context, arg FailJobParams) error {
+	_, err := q.db.ExecContext(ctx, failJob, arg.LastError, arg.JobID)
+	return err
+}
+
+const getAllPhotosByEventID = `-- name: GetAllPhotosByEventID :many
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE event_id = ?
+`
+
+func (q *Queries) GetAllPhotosByEventID(ctx context.Context, eventID uint32) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getAllPhotosByEventID, eventID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Event
+	var items []Photo
 	for rows.Next() {
-		var i Event
+		var i Photo
 		if err := rows.Scan(
-			&i.EventID,
-			&i.Name,
-			&i.Description,
-			&i.EventDate,
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
 			&i.CreationDate,
-			&i.ParentEventID,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
 		); err != nil {
 			return nil, err
 		}
@@ -147,27 +566,65 @@ func (q *Queries) GetEventByID(ctx context.Context, eventID uint32) ([]Event, er
 	return items, nil
 }
 
-const getEvents = `-- name: GetEvents :many
-SELECT event_id, name, description, event_date, creation_date, parent_event_id
-FROM events
+const getChildEventsWithPhotoCounts = `-- name: GetChildEventsWithPhotoCounts :many
+WITH RECURSIVE subtrees AS (
+    SELECT event_id AS child_id, event_id FROM events WHERE parent_event_id = ?
+    UNION
+    SELECT s.child_id, e.event_id
+    FROM events e
+    JOIN subtrees s ON e.parent_event_id = s.event_id
+)
+SELECT
+    e.event_id, e.name, e.description, e.event_date, e.creation_date, e.metadata_policy, e.password_hash, e.parent_event_id,
+    COUNT(p.photo_id) AS photo_count,
+    MAX(p.creation_date) AS latest_photo_date
+FROM events e
+JOIN subtrees s ON s.child_id = e.event_id
+LEFT JOIN photos p ON p.event_id = s.event_id
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+GROUP BY e.event_id
+ORDER BY e.event_date ASC, e.event_id ASC
 `
 
-func (q *Queries) GetEvents(ctx context.Context) ([]Event, error) {
-	rows, err := q.db.QueryContext(ctx, getEvents)
+type GetChildEventsWithPhotoCountsParams struct {
+	ParentEventID sql.NullInt32
+	IncludeHidden bool
+}
+
+type GetChildEventsWithPhotoCountsRow struct {
+	EventID         uint32
+	Name            string
+	Description     string
+	EventDate       time.Time
+	CreationDate    time.Time
+	MetadataPolicy  NullEventsMetadataPolicy
+	PasswordHash    sql.NullString
+	ParentEventID   sql.NullInt32
+	PhotoCount      int64
+	LatestPhotoDate sql.NullTime
+}
+
+func (q *Queries) GetChildEventsWithPhotoCounts(ctx context.Context, arg GetChildEventsWithPhotoCountsParams) ([]GetChildEventsWithPhotoCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChildEventsWithPhotoCounts, arg.ParentEventID, arg.IncludeHidden)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Event
+	var items []GetChildEventsWithPhotoCountsRow
 	for rows.Next() {
-		var i Event
+		var i GetChildEventsWithPhotoCountsRow
 		if err := rows.Scan(
 			&i.EventID,
 			&i.Name,
 			&i.Description,
 			&i.EventDate,
 			&i.CreationDate,
+			&i.MetadataPolicy,
+			&i.PasswordHash,
 			&i.ParentEventID,
+			&i.PhotoCount,
+			&i.LatestPhotoDate,
 		); err != nil {
 			return nil, err
 		}
@@ -182,40 +639,24 @@ func (q *Queries) GetEvents(ctx context.Context) ([]Event, error) {
 	return items, nil
 }
 
-const getPhoto = `-- name: GetPhoto :one
-SELECT photo_id, path_to_photo, creation_date, event_id FROM photos WHERE photo_id = ?
-`
-
-func (q *Queries) GetPhoto(ctx context.Context, photoID uint32) (Photo, error) {
-	row := q.db.QueryRowContext(ctx, getPhoto, photoID)
-	var i Photo
-	err := row.Scan(
-		&i.PhotoID,
-		&i.PathToPhoto,
-		&i.CreationDate,
-		&i.EventID,
-	)
-	return i, err
-}
-
-const getPhotosByEventID = `-- name: GetPhotosByEventID :many
-SELECT photo_id, path_to_photo, creation_date, event_id FROM photos WHERE event_id = ?
+const getCuratedTags = `-- name: GetCuratedTags :many
+SELECT tag_id, name, is_curated, creation_date FROM tags WHERE is_curated = true ORDER BY name
 `
 
-func (q *Queries) GetPhotosByEventID(ctx context.Context, eventID uint32) ([]Photo, error) {
-	rows, err := q.db.QueryContext(ctx, getPhotosByEventID, eventID)
+func (q *Queries) GetCuratedTags(ctx context.Context) ([]Tag, error) {
+	rows, err := q.db.QueryContext(ctx, getCuratedTags)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Photo
+	var items []Tag
 	for rows.Next() {
-		var i Photo
+		var i Tag
 		if err := rows.Scan(
-			&i.PhotoID,
-			&i.PathToPhoto,
+			&i.TagID,
+			&i.Name,
+			&i.IsCurated,
 			&i.CreationDate,
-			&i.EventID,
 		); err != nil {
 			return nil, err
 		}
@@ -230,44 +671,947 @@ func (q *Queries) GetPhotosByEventID(ctx context.Context, eventID uint32) ([]Pho
 	return items, nil
 }
 
-const getPhotosByEventIDWithPagination = `-- name: GetPhotosByEventIDWithPagination :many
-SELECT
-    photo_id,
-    path_to_photo,
-    creation_date,
-    event_id
-FROM
-    photos
+const getDueJob = `-- name: GetDueJob :one
+SELECT job_id, kind, payload, status, attempts, last_error, run_after, creation_date, finish_date FROM jobs
 WHERE
-    event_id = ?
-ORDER BY
-    creation_date ASC
-LIMIT ? OFFSET ?
+    status IN ('pending', 'running')
+    AND run_after <= ?
+ORDER BY run_after, job_id
+LIMIT 1
+FOR UPDATE SKIP LOCKED
 `
 
-type GetPhotosByEventIDWithPaginationParams struct {
-	EventID uint32
-	Limit   int32
-	Offset  int32
+func (q *Queries) GetDueJob(ctx context.Context, runAfter time.Time) (Job, error) {
+	row := q.db.QueryRowContext(ctx, getDueJob, runAfter)
+	var i Job
+	err := row.Scan(
+		&i.JobID,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.RunAfter,
+		&i.CreationDate,
+		&i.FinishDate,
+	)
+	return i, err
 }
 
-func (q *Queries) GetPhotosByEventIDWithPagination(ctx context.Context, arg GetPhotosByEventIDWithPaginationParams) ([]Photo, error) {
-	rows, err := q.db.QueryContext(ctx, getPhotosByEventIDWithPagination, arg.EventID, arg.Limit, arg.Offset)
+const getEventAncestors = `-- name: GetEventAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT e.*, 0 AS depth FROM events e WHERE e.event_id = ?
+    UNION ALL
+    SELECT e.*, a.depth + 1
+    FROM events e
+    JOIN ancestors a ON e.event_id = a.parent_event_id
+    WHERE a.depth < 100
+)
+SELECT event_id, name, description, event_date, creation_date, metadata_policy, password_hash, parent_event_id
+FROM ancestors
+WHERE depth > 0
+ORDER BY depth DESC
+`
+
+func (q *Queries) GetEventAncestors(ctx context.Context, eventID uint32) ([]Event, error) {
+	rows, err := q.db.QueryContext(ctx, getEventAncestors, eventID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Photo
+	var items []Event
 	for rows.Next() {
-		var i Photo
+		var i Event
 		if err := rows.Scan(
-			&i.PhotoID,
-			&i.PathToPhoto,
-			&i.CreationDate,
 			&i.EventID,
-		); err != nil {
-			return nil, err
-		}
+			&i.Name,
+			&i.Description,
+			&i.EventDate,
+			&i.CreationDate,
+			&i.MetadataPolicy,
+			&i.PasswordHash,
+			&i.ParentEventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEventByID = `-- name: GetEventByID :many
+SELECT event_id, name, description, event_date, creation_date, metadata_policy, password_hash, parent_event_id FROM events WHERE event_id = ?
+`
+
+func (q *Queries) GetEventByID(ctx context.Context, eventID uint32) ([]Event, error) {
+	rows, err := q.db.QueryContext(ctx, getEventByID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Event
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.EventID,
+			&i.Name,
+			&i.Description,
+			&i.EventDate,
+			&i.CreationDate,
+			&i.MetadataPolicy,
+			&i.PasswordHash,
+			&i.ParentEventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEventByNameAndParentID = `-- name: GetEventByNameAndParentID :one
+SELECT event_id, name, description, event_date, creation_date, metadata_policy, password_hash, parent_event_id FROM events
+WHERE name = ? AND parent_event_id <=> ?
+ORDER BY event_id
+LIMIT 1
+`
+
+type GetEventByNameAndParentIDParams struct {
+	Name          string
+	ParentEventID sql.NullInt32
+}
+
+func (q *Queries) GetEventByNameAndParentID(ctx context.Context, arg GetEventByNameAndParentIDParams) (Event, error) {
+	row := q.db.QueryRowContext(ctx, getEventByNameAndParentID, arg.Name, arg.ParentEventID)
+	var i Event
+	err := row.Scan(
+		&i.EventID,
+		&i.Name,
+		&i.Description,
+		&i.EventDate,
+		&i.CreationDate,
+		&i.MetadataPolicy,
+		&i.PasswordHash,
+		&i.ParentEventID,
+	)
+	return i, err
+}
+
+const getEventCover = `-- name: GetEventCover :one
+SELECT event_id, photo_id, creation_date FROM event_covers WHERE event_id = ?
+`
+
+func (q *Queries) GetEventCover(ctx context.Context, eventID uint32) (EventCover, error) {
+	row := q.db.QueryRowContext(ctx, getEventCover, eventID)
+	var i EventCover
+	err := row.Scan(
+		&i.EventID,
+		&i.PhotoID,
+		&i.CreationDate,
+	)
+	return i, err
+}
+
+const getEventCoversByParentID = `-- name: GetEventCoversByParentID :many
+WITH RECURSIVE subtrees AS (
+    SELECT event_id AS child_id, event_id, 0 AS depth, false AS locked FROM events WHERE parent_event_id <=> ?
+    UNION ALL
+    SELECT s.child_id, e.event_id, s.depth + 1, s.locked OR e.password_hash IS NOT NULL
+    FROM events e
+    JOIN subtrees s ON e.parent_event_id = s.event_id
+    WHERE s.depth < 100
+), ranked AS (
+    SELECT
+        s.child_id,
+        p.photo_id,
+        ROW_NUMBER() OVER (
+            PARTITION BY s.child_id
+            ORDER BY c.photo_id IS NULL, s.depth, COALESCE(m.capture_date, p.creation_date), p.photo_id
+        ) AS cover_rank
+    FROM subtrees s
+    JOIN photos p ON p.event_id = s.event_id
+    LEFT JOIN event_covers c ON c.event_id = s.child_id AND c.photo_id = p.photo_id
+    LEFT JOIN photo_metadata m ON m.photo_id = p.photo_id
+    WHERE
+        p.deletion_date IS NULL
+        AND (p.is_hidden = false OR p.is_hidden = ?)
+        AND NOT s.locked
+)
+SELECT e.event_id, e.password_hash, p.photo_id, p.photo_hash
+FROM ranked r
+JOIN events e ON e.event_id = r.child_id
+JOIN photos p ON p.photo_id = r.photo_id
+WHERE r.cover_rank = 1
+`
+
+type GetEventCoversByParentIDParams struct {
+	ParentEventID sql.NullInt32
+	IncludeHidden bool
+}
+
+type GetEventCoversByParentIDRow struct {
+	EventID      uint32
+	PasswordHash sql.NullString
+	PhotoID      uint32
+	PhotoHash    string
+}
+
+func (q *Queries) GetEventCoversByParentID(ctx context.Context, arg GetEventCoversByParentIDParams) ([]GetEventCoversByParentIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getEventCoversByParentID, arg.ParentEventID, arg.IncludeHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetEventCoversByParentIDRow
+	for rows.Next() {
+		var i GetEventCoversByParentIDRow
+		if err := rows.Scan(
+			&i.EventID,
+			&i.PasswordHash,
+			&i.PhotoID,
+			&i.PhotoHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEventDescendantIDs = `-- name: GetEventDescendantIDs :many
+WITH RECURSIVE descendants AS (
+    SELECT event_id FROM events WHERE parent_event_id = ?
+    UNION
+    SELECT e.event_id
+    FROM events e
+    JOIN descendants d ON e.parent_event_id = d.event_id
+)
+SELECT event_id FROM descendants
+`
+
+func (q *Queries) GetEventDescendantIDs(ctx context.Context, parentEventID sql.NullInt32) ([]uint32, error) {
+	rows, err := q.db.QueryContext(ctx, getEventDescendantIDs, parentEventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uint32
+	for rows.Next() {
+		var event_id uint32
+		if err := rows.Scan(&event_id); err != nil {
+			return nil, err
+		}
+		items = append(items, event_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEvents = `-- name: GetEvents :many
+SELECT event_id, name, description, event_date, creation_date, metadata_policy, password_hash, parent_event_id
+FROM events
+`
+
+func (q *Queries) GetEvents(ctx context.Context) ([]Event, error) {
+	rows, err := q.db.QueryContext(ctx, getEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Event
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.EventID,
+			&i.Name,
+			&i.Description,
+			&i.EventDate,
+			&i.CreationDate,
+			&i.MetadataPolicy,
+			&i.PasswordHash,
+			&i.ParentEventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpiredTrashedPhotos = `-- name: GetExpiredTrashedPhotos :many
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE deletion_date < ?
+`
+
+func (q *Queries) GetExpiredTrashedPhotos(ctx context.Context, deletionDate sql.NullTime) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredTrashedPhotos, deletionDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpiredUploads = `-- name: GetExpiredUploads :many
+SELECT upload_id, filename, upload_length, creation_date, user_id, event_id FROM uploads WHERE creation_date < ?
+`
+
+func (q *Queries) GetExpiredUploads(ctx context.Context, creationDate time.Time) ([]Upload, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredUploads, creationDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Upload
+	for rows.Next() {
+		var i Upload
+		if err := rows.Scan(
+			&i.UploadID,
+			&i.Filename,
+			&i.UploadLength,
+			&i.CreationDate,
+			&i.UserID,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getJobs = `-- name: GetJobs :many
+SELECT job_id, kind, payload, status, attempts, last_error, run_after, creation_date, finish_date FROM jobs
+WHERE ? IS NULL OR status = ?
+ORDER BY job_id DESC
+LIMIT ?
+`
+
+type GetJobsParams struct {
+	Status NullJobsStatus
+	Limit  int32
+}
+
+func (q *Queries) GetJobs(ctx context.Context, arg GetJobsParams) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, getJobs, arg.Status, arg.Status, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.JobID,
+			&i.Kind,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.RunAfter,
+			&i.CreationDate,
+			&i.FinishDate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPerceptualHash = `-- name: GetPerceptualHash :one
+SELECT dhash FROM perceptual_hashes WHERE photo_hash = ?
+`
+
+func (q *Queries) GetPerceptualHash(ctx context.Context, photoHash string) (uint64, error) {
+	row := q.db.QueryRowContext(ctx, getPerceptualHash, photoHash)
+	var dhash uint64
+	err := row.Scan(&dhash)
+	return dhash, err
+}
+
+const getPerceptualHashesByEventID = `-- name: GetPerceptualHashesByEventID :many
+SELECT p.photo_id, h.dhash
+FROM photos p
+JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+ORDER BY p.photo_id
+`
+
+type GetPerceptualHashesByEventIDRow struct {
+	PhotoID uint32
+	Dhash   uint64
+}
+
+func (q *Queries) GetPerceptualHashesByEventID(ctx context.Context, eventID uint32) ([]GetPerceptualHashesByEventIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPerceptualHashesByEventID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPerceptualHashesByEventIDRow
+	for rows.Next() {
+		var i GetPerceptualHashesByEventIDRow
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.Dhash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhoto = `-- name: GetPhoto :one
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE photo_id = ?
+`
+
+func (q *Queries) GetPhoto(ctx context.Context, photoID uint32) (Photo, error) {
+	row := q.db.QueryRowContext(ctx, getPhoto, photoID)
+	var i Photo
+	err := row.Scan(
+		&i.PhotoID,
+		&i.PhotoHash,
+		&i.OriginalFilename,
+		&i.PathToPhoto,
+		&i.PathToThumbnail,
+		&i.PathToPreview,
+		&i.CreationDate,
+		&i.IsHidden,
+		&i.DeletionDate,
+		&i.EventID,
+	)
+	return i, err
+}
+
+const getPhotoByEventIDAndHash = `-- name: GetPhotoByEventIDAndHash :one
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE event_id = ? AND photo_hash = ?
+`
+
+type GetPhotoByEventIDAndHashParams struct {
+	EventID   uint32
+	PhotoHash string
+}
+
+func (q *Queries) GetPhotoByEventIDAndHash(ctx context.Context, arg GetPhotoByEventIDAndHashParams) (Photo, error) {
+	row := q.db.QueryRowContext(ctx, getPhotoByEventIDAndHash, arg.EventID, arg.PhotoHash)
+	var i Photo
+	err := row.Scan(
+		&i.PhotoID,
+		&i.PhotoHash,
+		&i.OriginalFilename,
+		&i.PathToPhoto,
+		&i.PathToThumbnail,
+		&i.PathToPreview,
+		&i.CreationDate,
+		&i.IsHidden,
+		&i.DeletionDate,
+		&i.EventID,
+	)
+	return i, err
+}
+
+const getPhotoByHash = `-- name: GetPhotoByHash :one
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE photo_hash = ? LIMIT 1
+FOR UPDATE
+`
+
+func (q *Queries) GetPhotoByHash(ctx context.Context, photoHash string) (Photo, error) {
+	row := q.db.QueryRowContext(ctx, getPhotoByHash, photoHash)
+	var i Photo
+	err := row.Scan(
+		&i.PhotoID,
+		&i.PhotoHash,
+		&i.OriginalFilename,
+		&i.PathToPhoto,
+		&i.PathToThumbnail,
+		&i.PathToPreview,
+		&i.CreationDate,
+		&i.IsHidden,
+		&i.DeletionDate,
+		&i.EventID,
+	)
+	return i, err
+}
+
+const getPhotoMetadata = `-- name: GetPhotoMetadata :one
+SELECT photo_id, capture_date, camera_make, camera_model, lens_model, width, height, orientation, exposure_time, f_number, iso, focal_length, gps_latitude, gps_longitude, gps_altitude FROM photo_metadata WHERE photo_id = ?
+`
+
+func (q *Queries) GetPhotoMetadata(ctx context.Context, photoID uint32) (PhotoMetadatum, error) {
+	row := q.db.QueryRowContext(ctx, getPhotoMetadata, photoID)
+	var i PhotoMetadatum
+	err := row.Scan(
+		&i.PhotoID,
+		&i.CaptureDate,
+		&i.CameraMake,
+		&i.CameraModel,
+		&i.LensModel,
+		&i.Width,
+		&i.Height,
+		&i.Orientation,
+		&i.ExposureTime,
+		&i.FNumber,
+		&i.Iso,
+		&i.FocalLength,
+		&i.GpsLatitude,
+		&i.GpsLongitude,
+		&i.GpsAltitude,
+	)
+	return i, err
+}
+
+const getPhotoReports = `-- name: GetPhotoReports :many
+SELECT
+    r.report_id,
+    r.reason,
+    r.comment,
+    r.status,
+    r.creation_date,
+    r.resolution_date,
+    r.photo_id,
+    p.photo_hash,
+    p.is_hidden,
+    EXISTS(SELECT 1 FROM photo_reports h WHERE h.photo_id = r.photo_id AND h.status = 'open' AND h.hid_photo) AS hidden_by_reports,
+    p.deletion_date,
+    p.event_id,
+    u.full_name AS reporter_name,
+    m.full_name AS moderator_name
+FROM
+    photo_reports r
+JOIN
+    photos p ON p.photo_id = r.photo_id
+JOIN
+    users u ON u.user_id = r.user_id
+LEFT JOIN
+    users m ON m.user_id = r.moderator_id
+WHERE
+    (r.status = 'open') = ?
+ORDER BY
+    r.creation_date DESC
+LIMIT ?
+`
+
+type GetPhotoReportsParams struct {
+	Open  bool
+	Limit int32
+}
+
+type GetPhotoReportsRow struct {
+	ReportID        uint32
+	Reason          PhotoReportsReason
+	Comment         string
+	Status          PhotoReportsStatus
+	CreationDate    time.Time
+	ResolutionDate  sql.NullTime
+	PhotoID         uint32
+	PhotoHash       string
+	IsHidden        bool
+	HiddenByReports bool
+	DeletionDate    sql.NullTime
+	EventID         uint32
+	ReporterName    string
+	ModeratorName   sql.NullString
+}
+
+func (q *Queries) GetPhotoReports(ctx context.Context, arg GetPhotoReportsParams) ([]GetPhotoReportsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotoReports, arg.Open, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPhotoReportsRow
+	for rows.Next() {
+		var i GetPhotoReportsRow
+		if err := rows.Scan(
+			&i.ReportID,
+			&i.Reason,
+			&i.Comment,
+			&i.Status,
+			&i.CreationDate,
+			&i.ResolutionDate,
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.IsHidden,
+			&i.HiddenByReports,
+			&i.DeletionDate,
+			&i.EventID,
+			&i.ReporterName,
+			&i.ModeratorName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosByEventID = `-- name: GetPhotosByEventID :many
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE event_id = ? AND deletion_date IS NULL
+`
+
+func (q *Queries) GetPhotosByEventID(ctx context.Context, eventID uint32) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosByEventID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosByEventIDWithPagination = `-- name: GetPhotosByEventIDWithPagination :many
+SELECT
+    p.photo_id,
+    p.photo_hash,
+    p.path_to_photo,
+    p.path_to_thumbnail,
+    p.path_to_preview,
+    p.creation_date,
+    p.is_hidden,
+    p.event_id,
+    m.capture_date,
+    m.camera_make,
+    m.camera_model,
+    m.lens_model,
+    m.width,
+    m.height,
+    m.exposure_time,
+    m.f_number,
+    m.iso,
+    m.focal_length
+FROM
+    photos p
+LEFT JOIN
+    photo_metadata m ON m.photo_id = p.photo_id
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+ORDER BY
+    COALESCE(m.capture_date, p.creation_date) ASC,
+    p.photo_id ASC
+LIMIT ? OFFSET ?
+`
+
+type GetPhotosByEventIDWithPaginationParams struct {
+	EventID       uint32
+	IncludeHidden bool
+	Limit         int32
+	Offset        int32
+}
+
+type GetPhotosByEventIDWithPaginationRow struct {
+	PhotoID         uint32
+	PhotoHash       string
+	PathToPhoto     string
+	PathToThumbnail string
+	PathToPreview   string
+	CreationDate    time.Time
+	IsHidden        bool
+	EventID         uint32
+	CaptureDate     sql.NullTime
+	CameraMake      sql.NullString
+	CameraModel     sql.NullString
+	LensModel       sql.NullString
+	Width           sql.NullInt32
+	Height          sql.NullInt32
+	ExposureTime    sql.NullString
+	FNumber         sql.NullFloat64
+	Iso             sql.NullInt32
+	FocalLength     sql.NullFloat64
+}
+
+func (q *Queries) GetPhotosByEventIDWithPagination(ctx context.Context, arg GetPhotosByEventIDWithPaginationParams) ([]GetPhotosByEventIDWithPaginationRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosByEventIDWithPagination,
+		arg.EventID,
+		arg.IncludeHidden,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPhotosByEventIDWithPaginationRow
+	for rows.Next() {
+		var i GetPhotosByEventIDWithPaginationRow
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.EventID,
+			&i.CaptureDate,
+			&i.CameraMake,
+			&i.CameraModel,
+			&i.LensModel,
+			&i.Width,
+			&i.Height,
+			&i.ExposureTime,
+			&i.FNumber,
+			&i.Iso,
+			&i.FocalLength,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosByTagID = `-- name: GetPhotosByTagID :many
+SELECT p.photo_id, p.photo_hash, p.original_filename, p.path_to_photo, p.path_to_thumbnail, p.path_to_preview, p.creation_date, p.is_hidden, p.deletion_date, p.event_id
+FROM photos p
+JOIN photo_tags pt ON pt.photo_id = p.photo_id
+WHERE
+    pt.tag_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+ORDER BY p.creation_date DESC
+`
+
+type GetPhotosByTagIDParams struct {
+	TagID         uint32
+	IncludeHidden bool
+}
+
+func (q *Queries) GetPhotosByTagID(ctx context.Context, arg GetPhotosByTagIDParams) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosByTagID, arg.TagID, arg.IncludeHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosByUserFolderID = `-- name: GetPhotosByUserFolderID :many
+SELECT p.photo_id, p.photo_hash, p.original_filename, p.path_to_photo, p.path_to_thumbnail, p.path_to_preview, p.creation_date, p.is_hidden, p.deletion_date, p.event_id
+FROM photos p
+JOIN user_folder_photos fp ON fp.photo_id = p.photo_id
+WHERE
+    fp.user_folder_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+ORDER BY fp.creation_date ASC
+`
+
+type GetPhotosByUserFolderIDParams struct {
+	UserFolderID  uint32
+	IncludeHidden bool
+}
+
+func (q *Queries) GetPhotosByUserFolderID(ctx context.Context, arg GetPhotosByUserFolderIDParams) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosByUserFolderID, arg.UserFolderID, arg.IncludeHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPhotosOfUser = `-- name: GetPhotosOfUser :many
+SELECT p.photo_id, p.photo_hash, p.original_filename, p.path_to_photo, p.path_to_thumbnail, p.path_to_preview, p.creation_date, p.is_hidden, p.deletion_date, p.event_id
+FROM photos p
+JOIN recognized_users r ON r.photo_id = p.photo_id
+WHERE
+    r.user_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+ORDER BY p.creation_date DESC
+`
+
+type GetPhotosOfUserParams struct {
+	UserID        uint32
+	IncludeHidden bool
+}
+
+func (q *Queries) GetPhotosOfUser(ctx context.Context, arg GetPhotosOfUserParams) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosOfUser, arg.UserID, arg.IncludeHidden)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
 		items = append(items, i)
 	}
 	if err := rows.Close(); err != nil {
@@ -280,7 +1624,7 @@ func (q *Queries) GetPhotosByEventIDWithPagination(ctx context.Context, arg GetP
 }
 
 const getPhotosSortedByDate = `-- name: GetPhotosSortedByDate :many
-SELECT photo_id, path_to_photo, creation_date, event_id FROM photos ORDER BY creation_date DESC
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos ORDER BY creation_date DESC
 `
 
 func (q *Queries) GetPhotosSortedByDate(ctx context.Context) ([]Photo, error) {
@@ -294,8 +1638,14 @@ func (q *Queries) GetPhotosSortedByDate(ctx context.Context) ([]Photo, error) {
 		var i Photo
 		if err := rows.Scan(
 			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
 			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
 			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
 			&i.EventID,
 		); err != nil {
 			return nil, err
@@ -311,6 +1661,113 @@ func (q *Queries) GetPhotosSortedByDate(ctx context.Context) ([]Photo, error) {
 	return items, nil
 }
 
+const getPhotosWithoutPerceptualHash = `-- name: GetPhotosWithoutPerceptualHash :many
+SELECT p.photo_id, p.photo_hash, p.original_filename, p.path_to_photo, p.path_to_thumbnail, p.path_to_preview, p.creation_date, p.is_hidden, p.deletion_date, p.event_id
+FROM photos p
+LEFT JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+    AND h.photo_hash IS NULL
+`
+
+func (q *Queries) GetPhotosWithoutPerceptualHash(ctx context.Context, eventID uint32) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getPhotosWithoutPerceptualHash, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecognizedUsersByPhotoID = `-- name: GetRecognizedUsersByPhotoID :many
+SELECT
+    r.recognized_user_id,
+    r.box_x,
+    r.box_y,
+    r.box_width,
+    r.box_height,
+    r.user_id,
+    r.tagged_by,
+    u.full_name
+FROM
+    recognized_users r
+JOIN
+    users u ON u.user_id = r.user_id
+WHERE
+    r.photo_id = ?
+ORDER BY
+    u.full_name
+`
+
+type GetRecognizedUsersByPhotoIDRow struct {
+	RecognizedUserID uint32
+	BoxX             sql.NullFloat64
+	BoxY             sql.NullFloat64
+	BoxWidth         sql.NullFloat64
+	BoxHeight        sql.NullFloat64
+	UserID           uint32
+	TaggedBy         uint32
+	FullName         string
+}
+
+func (q *Queries) GetRecognizedUsersByPhotoID(ctx context.Context, photoID uint32) ([]GetRecognizedUsersByPhotoIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecognizedUsersByPhotoID, photoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecognizedUsersByPhotoIDRow
+	for rows.Next() {
+		var i GetRecognizedUsersByPhotoIDRow
+		if err := rows.Scan(
+			&i.RecognizedUserID,
+			&i.BoxX,
+			&i.BoxY,
+			&i.BoxWidth,
+			&i.BoxHeight,
+			&i.UserID,
+			&i.TaggedBy,
+			&i.FullName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getSessionWithToken = `-- name: GetSessionWithToken :one
 SELECT session_id, user_id, creation_date, session_token
 FROM sessions
@@ -329,6 +1786,266 @@ func (q *Queries) GetSessionWithToken(ctx context.Context, sessionToken string)
 	return i, err
 }
 
+const getSharedUserFolders = `-- name: GetSharedUserFolders :many
+SELECT f.user_folder_id, f.is_sub_folder, f.name, f.description, f.creation_date, f.user_id, f.parent_folder_id
+FROM user_folders f
+JOIN user_folder_shares s ON s.user_folder_id = f.user_folder_id
+WHERE s.user_id = ?
+ORDER BY f.name
+`
+
+func (q *Queries) GetSharedUserFolders(ctx context.Context, userID uint32) ([]UserFolder, error) {
+	rows, err := q.db.QueryContext(ctx, getSharedUserFolders, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserFolder
+	for rows.Next() {
+		var i UserFolder
+		if err := rows.Scan(
+			&i.UserFolderID,
+			&i.IsSubFolder,
+			&i.Name,
+			&i.Description,
+			&i.CreationDate,
+			&i.UserID,
+			&i.ParentFolderID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSimilarPhotos = `-- name: GetSimilarPhotos :many
+SELECT p.photo_id, p.photo_hash, p.original_filename, p.path_to_photo, p.path_to_thumbnail, p.path_to_preview, p.creation_date, p.is_hidden, p.deletion_date, p.event_id
+FROM photos p
+JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    BIT_COUNT(h.dhash ^ ?) <= ?
+    AND p.photo_id != ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = ?)
+ORDER BY BIT_COUNT(h.dhash ^ ?), p.photo_id
+LIMIT ?
+`
+
+type GetSimilarPhotosParams struct {
+	Dhash         uint64
+	MaxDistance   int64
+	PhotoID       uint32
+	IncludeHidden bool
+	Limit         int32
+}
+
+func (q *Queries) GetSimilarPhotos(ctx context.Context, arg GetSimilarPhotosParams) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getSimilarPhotos,
+		arg.Dhash,
+		arg.MaxDistance,
+		arg.PhotoID,
+		arg.IncludeHidden,
+		arg.Dhash,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubFolders = `-- name: GetSubFolders :many
+SELECT user_folder_id, is_sub_folder, name, description, creation_date, user_id, parent_folder_id FROM user_folders WHERE parent_folder_id = ? ORDER BY name
+`
+
+func (q *Queries) GetSubFolders(ctx context.Context, parentFolderID sql.NullInt32) ([]UserFolder, error) {
+	rows, err := q.db.QueryContext(ctx, getSubFolders, parentFolderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserFolder
+	for rows.Next() {
+		var i UserFolder
+		if err := rows.Scan(
+			&i.UserFolderID,
+			&i.IsSubFolder,
+			&i.Name,
+			&i.Description,
+			&i.CreationDate,
+			&i.UserID,
+			&i.ParentFolderID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTag = `-- name: GetTag :one
+SELECT tag_id, name, is_curated, creation_date FROM tags WHERE tag_id = ?
+`
+
+func (q *Queries) GetTag(ctx context.Context, tagID uint32) (Tag, error) {
+	row := q.db.QueryRowContext(ctx, getTag, tagID)
+	var i Tag
+	err := row.Scan(
+		&i.TagID,
+		&i.Name,
+		&i.IsCurated,
+		&i.CreationDate,
+	)
+	return i, err
+}
+
+const getTagByName = `-- name: GetTagByName :one
+SELECT tag_id, name, is_curated, creation_date FROM tags WHERE name = ?
+`
+
+func (q *Queries) GetTagByName(ctx context.Context, name string) (Tag, error) {
+	row := q.db.QueryRowContext(ctx, getTagByName, name)
+	var i Tag
+	err := row.Scan(
+		&i.TagID,
+		&i.Name,
+		&i.IsCurated,
+		&i.CreationDate,
+	)
+	return i, err
+}
+
+const getTagsByPhotoID = `-- name: GetTagsByPhotoID :many
+SELECT t.tag_id, t.name, t.is_curated, t.creation_date
+FROM tags t
+JOIN photo_tags pt ON pt.tag_id = t.tag_id
+WHERE pt.photo_id = ?
+ORDER BY t.name
+`
+
+func (q *Queries) GetTagsByPhotoID(ctx context.Context, photoID uint32) ([]Tag, error) {
+	rows, err := q.db.QueryContext(ctx, getTagsByPhotoID, photoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Tag
+	for rows.Next() {
+		var i Tag
+		if err := rows.Scan(
+			&i.TagID,
+			&i.Name,
+			&i.IsCurated,
+			&i.CreationDate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrashedPhotos = `-- name: GetTrashedPhotos :many
+SELECT photo_id, photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, creation_date, is_hidden, deletion_date, event_id FROM photos WHERE deletion_date IS NOT NULL ORDER BY deletion_date DESC
+`
+
+func (q *Queries) GetTrashedPhotos(ctx context.Context) ([]Photo, error) {
+	rows, err := q.db.QueryContext(ctx, getTrashedPhotos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Photo
+	for rows.Next() {
+		var i Photo
+		if err := rows.Scan(
+			&i.PhotoID,
+			&i.PhotoHash,
+			&i.OriginalFilename,
+			&i.PathToPhoto,
+			&i.PathToThumbnail,
+			&i.PathToPreview,
+			&i.CreationDate,
+			&i.IsHidden,
+			&i.DeletionDate,
+			&i.EventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUpload = `-- name: GetUpload :one
+SELECT upload_id, filename, upload_length, creation_date, user_id, event_id FROM uploads WHERE upload_id = ?
+`
+
+func (q *Queries) GetUpload(ctx context.Context, uploadID string) (Upload, error) {
+	row := q.db.QueryRowContext(ctx, getUpload, uploadID)
+	var i Upload
+	err := row.Scan(
+		&i.UploadID,
+		&i.Filename,
+		&i.UploadLength,
+		&i.CreationDate,
+		&i.UserID,
+		&i.EventID,
+	)
+	return i, err
+}
+
 const getUser = `-- name: GetUser :one
 SELECT user_id, signup_date, last_signin_date, signin_locked, signin_locked_date, is_admin, email, full_name, business_category, department_number
 FROM users
@@ -353,6 +2070,102 @@ func (q *Queries) GetUser(ctx context.Context, userID uint32) (User, error) {
 	return i, err
 }
 
+const getUserFolder = `-- name: GetUserFolder :one
+SELECT user_folder_id, is_sub_folder, name, description, creation_date, user_id, parent_folder_id FROM user_folders WHERE user_folder_id = ?
+`
+
+func (q *Queries) GetUserFolder(ctx context.Context, userFolderID uint32) (UserFolder, error) {
+	row := q.db.QueryRowContext(ctx, getUserFolder, userFolderID)
+	var i UserFolder
+	err := row.Scan(
+		&i.UserFolderID,
+		&i.IsSubFolder,
+		&i.Name,
+		&i.Description,
+		&i.CreationDate,
+		&i.UserID,
+		&i.ParentFolderID,
+	)
+	return i, err
+}
+
+const getUserFoldersByUserID = `-- name: GetUserFoldersByUserID :many
+SELECT user_folder_id, is_sub_folder, name, description, creation_date, user_id, parent_folder_id FROM user_folders WHERE user_id = ? ORDER BY name
+`
+
+func (q *Queries) GetUserFoldersByUserID(ctx context.Context, userID uint32) ([]UserFolder, error) {
+	rows, err := q.db.QueryContext(ctx, getUserFoldersByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserFolder
+	for rows.Next() {
+		var i UserFolder
+		if err := rows.Scan(
+			&i.UserFolderID,
+			&i.IsSubFolder,
+			&i.Name,
+			&i.Description,
+			&i.CreationDate,
+			&i.UserID,
+			&i.ParentFolderID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserFolderShares = `-- name: GetUserFolderShares :many
+SELECT u.user_id, u.signup_date, u.last_signin_date, u.signin_locked, u.signin_locked_date, u.is_admin, u.email, u.full_name, u.business_category, u.department_number
+FROM users u
+JOIN user_folder_shares s ON s.user_id = u.user_id
+WHERE s.user_folder_id = ?
+ORDER BY u.full_name
+`
+
+func (q *Queries) GetUserFolderShares(ctx context.Context, userFolderID uint32) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUserFolderShares, userFolderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SignupDate,
+			&i.LastSigninDate,
+			&i.SigninLocked,
+			&i.SigninLockedDate,
+			&i.IsAdmin,
+			&i.Email,
+			&i.FullName,
+			&i.BusinessCategory,
+			&i.DepartmentNumber,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserLastInsertID = `-- name: GetUserLastInsertID :one
 SELECT user_id, signup_date, last_signin_date, signin_locked, signin_locked_date, is_admin, email, full_name, business_category, department_number FROM users WHERE user_id = LAST_INSERT_ID()
 `
@@ -425,6 +2238,403 @@ func (q *Queries) GetUserWithSession(ctx context.Context, sessionToken string) (
 	return i, err
 }
 
+const isPhotoHiddenByReports = `-- name: IsPhotoHiddenByReports :one
+SELECT EXISTS(SELECT 1 FROM photo_reports WHERE photo_id = ? AND status = 'open' AND hid_photo)
+`
+
+func (q *Queries) IsPhotoHiddenByReports(ctx context.Context, photoID uint32) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isPhotoHiddenByReports, photoID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const markPhotoHiddenByReports = `-- name: MarkPhotoHiddenByReports :exec
+UPDATE photo_reports SET hid_photo = true WHERE photo_id = ? AND status = 'open'
+`
+
+func (q *Queries) MarkPhotoHiddenByReports(ctx context.Context, photoID uint32) error {
+	_, err := q.db.ExecContext(ctx, markPhotoHiddenByReports, photoID)
+	return err
+}
+
+const removePhotoFromUserFolder = `-- name: RemovePhotoFromUserFolder :exec
+DELETE FROM user_folder_photos WHERE user_folder_id = ? AND photo_id = ?
+`
+
+type RemovePhotoFromUserFolderParams struct {
+	UserFolderID uint32
+	PhotoID      uint32
+}
+
+func (q *Queries) RemovePhotoFromUserFolder(ctx context.Context, arg RemovePhotoFromUserFolderParams) error {
+	_, err := q.db.ExecContext(ctx, removePhotoFromUserFolder, arg.UserFolderID, arg.PhotoID)
+	return err
+}
+
+const removePhotoTag = `-- name: RemovePhotoTag :exec
+DELETE FROM photo_tags WHERE photo_id = ? AND tag_id = ?
+`
+
+type RemovePhotoTagParams struct {
+	PhotoID uint32
+	TagID   uint32
+}
+
+func (q *Queries) RemovePhotoTag(ctx context.Context, arg RemovePhotoTagParams) error {
+	_, err := q.db.ExecContext(ctx, removePhotoTag, arg.PhotoID, arg.TagID)
+	return err
+}
+
+const removeRecognizedUser = `-- name: RemoveRecognizedUser :exec
+DELETE FROM recognized_users WHERE photo_id = ? AND user_id = ?
+`
+
+type RemoveRecognizedUserParams struct {
+	PhotoID uint32
+	UserID  uint32
+}
+
+func (q *Queries) RemoveRecognizedUser(ctx context.Context, arg RemoveRecognizedUserParams) error {
+	_, err := q.db.ExecContext(ctx, removeRecognizedUser, arg.PhotoID, arg.UserID)
+	return err
+}
+
+const requeueFailedJob = `-- name: RequeueFailedJob :exec
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_after = ?, finish_date = NULL
+WHERE job_id = ? AND status = 'failed'
+`
+
+type RequeueFailedJobParams struct {
+	RunAfter time.Time
+	JobID    uint32
+}
+
+func (q *Queries) RequeueFailedJob(ctx context.Context, arg RequeueFailedJobParams) error {
+	_, err := q.db.ExecContext(ctx, requeueFailedJob, arg.RunAfter, arg.JobID)
+	return err
+}
+
+const restorePhoto = `-- name: RestorePhoto :exec
+UPDATE photos
+SET deletion_date = NULL
+WHERE photo_id = ?
+`
+
+func (q *Queries) RestorePhoto(ctx context.Context, photoID uint32) error {
+	_, err := q.db.ExecContext(ctx, restorePhoto, photoID)
+	return err
+}
+
+const retryJob = `-- name: RetryJob :exec
+UPDATE jobs
+SET status = 'pending', last_error = ?, run_after = ?
+WHERE job_id = ?
+`
+
+type RetryJobParams struct {
+	LastError sql.NullString
+	RunAfter  time.Time
+	JobID     uint32
+}
+
+func (q *Queries) RetryJob(ctx context.Context, arg RetryJobParams) error {
+	_, err := q.db.ExecContext(ctx, retryJob, arg.LastError, arg.RunAfter, arg.JobID)
+	return err
+}
+
+const searchEvents = `-- name: SearchEvents :many
+SELECT e.event_id, e.name, e.description, e.event_date, e.creation_date, e.metadata_policy, e.password_hash, e.parent_event_id
+FROM events e
+LEFT JOIN (
+    SELECT p.event_id, MAX(MATCH(t.name) AGAINST (? IN NATURAL LANGUAGE MODE)) AS score
+    FROM tags t
+    JOIN photo_tags pt ON pt.tag_id = t.tag_id
+    JOIN photos p ON p.photo_id = pt.photo_id
+    WHERE
+        MATCH(t.name) AGAINST (? IN NATURAL LANGUAGE MODE)
+        AND p.deletion_date IS NULL
+        AND (p.is_hidden = false OR p.is_hidden = ?)
+    GROUP BY p.event_id
+) tm ON tm.event_id = e.event_id
+WHERE
+    (MATCH(e.name, e.description) AGAINST (? IN NATURAL LANGUAGE MODE) OR tm.score IS NOT NULL)
+    AND (? IS NULL OR e.event_date >= ?)
+    AND (? IS NULL OR e.event_date < ?)
+ORDER BY
+    MATCH(e.name, e.description) AGAINST (? IN NATURAL LANGUAGE MODE) + COALESCE(tm.score, 0) DESC,
+    e.event_date DESC
+LIMIT ? OFFSET ?
+`
+
+type SearchEventsParams struct {
+	Search        string
+	IncludeHidden bool
+	FromDate      sql.NullTime
+	ToDate        sql.NullTime
+	Limit         int32
+	Offset        int32
+}
+
+func (q *Queries) SearchEvents(ctx context.Context, arg SearchEventsParams) ([]Event, error) {
+	rows, err := q.db.QueryContext(ctx, searchEvents,
+		arg.Search,
+		arg.Search,
+		arg.IncludeHidden,
+		arg.Search,
+		arg.FromDate,
+		arg.FromDate,
+		arg.ToDate,
+		arg.ToDate,
+		arg.Search,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Event
+	for rows.Next() {
+		var i Event
+		if err := rows.Scan(
+			&i.EventID,
+			&i.Name,
+			&i.Description,
+			&i.EventDate,
+			&i.CreationDate,
+			&i.MetadataPolicy,
+			&i.PasswordHash,
+			&i.ParentEventID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchTags = `-- name: SearchTags :many
+SELECT tag_id, name, is_curated, creation_date FROM tags WHERE name LIKE ? ORDER BY is_curated DESC, name LIMIT 10
+`
+
+func (q *Queries) SearchTags(ctx context.Context, name string) ([]Tag, error) {
+	rows, err := q.db.QueryContext(ctx, searchTags, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Tag
+	for rows.Next() {
+		var i Tag
+		if err := rows.Scan(
+			&i.TagID,
+			&i.Name,
+			&i.IsCurated,
+			&i.CreationDate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT user_id, signup_date, last_signin_date, signin_locked, signin_locked_date, is_admin, email, full_name, business_category, department_number
+FROM users
+WHERE full_name LIKE ? OR email LIKE ?
+ORDER BY full_name
+LIMIT 10
+`
+
+func (q *Queries) SearchUsers(ctx context.Context, search string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, search, search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.SignupDate,
+			&i.LastSigninDate,
+			&i.SigninLocked,
+			&i.SigninLockedDate,
+			&i.IsAdmin,
+			&i.Email,
+			&i.FullName,
+			&i.BusinessCategory,
+			&i.DepartmentNumber,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setEventCover = `-- name: SetEventCover :exec
+INSERT INTO event_covers (event_id, photo_id)
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE
+    photo_id = VALUES(photo_id),
+    creation_date = CURRENT_TIMESTAMP
+`
+
+type SetEventCoverParams struct {
+	EventID uint32
+	PhotoID uint32
+}
+
+func (q *Queries) SetEventCover(ctx context.Context, arg SetEventCoverParams) error {
+	_, err := q.db.ExecContext(ctx, setEventCover, arg.EventID, arg.PhotoID)
+	return err
+}
+
+const setPhotoHidden = `-- name: SetPhotoHidden :exec
+UPDATE photos
+SET is_hidden = ?
+WHERE photo_id = ?
+`
+
+type SetPhotoHiddenParams struct {
+	IsHidden bool
+	PhotoID  uint32
+}
+
+func (q *Queries) SetPhotoHidden(ctx context.Context, arg SetPhotoHiddenParams) error {
+	_, err := q.db.ExecContext(ctx, setPhotoHidden, arg.IsHidden, arg.PhotoID)
+	return err
+}
+
+const setTagCurated = `-- name: SetTagCurated :exec
+UPDATE tags
+SET is_curated = ?
+WHERE tag_id = ?
+`
+
+type SetTagCuratedParams struct {
+	IsCurated bool
+	TagID     uint32
+}
+
+func (q *Queries) SetTagCurated(ctx context.Context, arg SetTagCuratedParams) error {
+	_, err := q.db.ExecContext(ctx, setTagCurated, arg.IsCurated, arg.TagID)
+	return err
+}
+
+const shareUserFolder = `-- name: ShareUserFolder :exec
+INSERT IGNORE INTO user_folder_shares (user_folder_id, user_id)
+VALUES (?, ?)
+`
+
+type ShareUserFolderParams struct {
+	UserFolderID uint32
+	UserID       uint32
+}
+
+func (q *Queries) ShareUserFolder(ctx context.Context, arg ShareUserFolderParams) error {
+	_, err := q.db.ExecContext(ctx, shareUserFolder, arg.UserFolderID, arg.UserID)
+	return err
+}
+
+const startJob = `-- name: StartJob :exec
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, run_after = ?
+WHERE job_id = ?
+`
+
+type StartJobParams struct {
+	RunAfter time.Time
+	JobID    uint32
+}
+
+func (q *Queries) StartJob(ctx context.Context, arg StartJobParams) error {
+	_, err := q.db.ExecContext(ctx, startJob, arg.RunAfter, arg.JobID)
+	return err
+}
+
+const tagUserInPhoto = `-- name: TagUserInPhoto :exec
+INSERT INTO recognized_users (box_x, box_y, box_width, box_height, user_id, photo_id, tagged_by)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+    box_x = VALUES(box_x),
+    box_y = VALUES(box_y),
+    box_width = VALUES(box_width),
+    box_height = VALUES(box_height),
+    tagged_by = VALUES(tagged_by)
+`
+
+type TagUserInPhotoParams struct {
+	BoxX      sql.NullFloat64
+	BoxY      sql.NullFloat64
+	BoxWidth  sql.NullFloat64
+	BoxHeight sql.NullFloat64
+	UserID    uint32
+	PhotoID   uint32
+	TaggedBy  uint32
+}
+
+func (q *Queries) TagUserInPhoto(ctx context.Context, arg TagUserInPhotoParams) error {
+	_, err := q.db.ExecContext(ctx, tagUserInPhoto,
+		arg.BoxX,
+		arg.BoxY,
+		arg.BoxWidth,
+		arg.BoxHeight,
+		arg.UserID,
+		arg.PhotoID,
+		arg.TaggedBy,
+	)
+	return err
+}
+
+const trashPhoto = `-- name: TrashPhoto :exec
+UPDATE photos
+SET deletion_date = CURRENT_TIMESTAMP
+WHERE photo_id = ? AND deletion_date IS NULL
+`
+
+func (q *Queries) TrashPhoto(ctx context.Context, photoID uint32) error {
+	_, err := q.db.ExecContext(ctx, trashPhoto, photoID)
+	return err
+}
+
+const unshareUserFolder = `-- name: UnshareUserFolder :exec
+DELETE FROM user_folder_shares WHERE user_folder_id = ? AND user_id = ?
+`
+
+type UnshareUserFolderParams struct {
+	UserFolderID uint32
+	UserID       uint32
+}
+
+func (q *Queries) UnshareUserFolder(ctx context.Context, arg UnshareUserFolderParams) error {
+	_, err := q.db.ExecContext(ctx, unshareUserFolder, arg.UserFolderID, arg.UserID)
+	return err
+}
+
 const updateEvent = `-- name: UpdateEvent :exec
 UPDATE events
 SET name = ?, description = ?, event_date = ?, parent_event_id = ?
@@ -450,6 +2660,54 @@ func (q *Queries) UpdateEvent(ctx context.Context, arg UpdateEventParams) error
 	return err
 }
 
+const updateEventMetadataPolicy = `-- name: UpdateEventMetadataPolicy :exec
+UPDATE events
+SET metadata_policy = ?
+WHERE event_id = ?
+`
+
+type UpdateEventMetadataPolicyParams struct {
+	MetadataPolicy NullEventsMetadataPolicy
+	EventID        uint32
+}
+
+func (q *Queries) UpdateEventMetadataPolicy(ctx context.Context, arg UpdateEventMetadataPolicyParams) error {
+	_, err := q.db.ExecContext(ctx, updateEventMetadataPolicy, arg.MetadataPolicy, arg.EventID)
+	return err
+}
+
+const updateEventPassword = `-- name: UpdateEventPassword :exec
+UPDATE events
+SET password_hash = ?
+WHERE event_id = ?
+`
+
+type UpdateEventPasswordParams struct {
+	PasswordHash sql.NullString
+	EventID      uint32
+}
+
+func (q *Queries) UpdateEventPassword(ctx context.Context, arg UpdateEventPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateEventPassword, arg.PasswordHash, arg.EventID)
+	return err
+}
+
+const updatePhotoEvent = `-- name: UpdatePhotoEvent :exec
+UPDATE photos
+SET event_id = ?
+WHERE photo_id = ?
+`
+
+type UpdatePhotoEventParams struct {
+	EventID uint32
+	PhotoID uint32
+}
+
+func (q *Queries) UpdatePhotoEvent(ctx context.Context, arg UpdatePhotoEventParams) error {
+	_, err := q.db.ExecContext(ctx, updatePhotoEvent, arg.EventID, arg.PhotoID)
+	return err
+}
+
 const updatePhotoPath = `-- name: UpdatePhotoPath :exec
 UPDATE photos
 SET path_to_photo = ?
@@ -465,3 +2723,28 @@ func (q *Queries) UpdatePhotoPath(ctx context.Context, arg UpdatePhotoPathParams
 	_, err := q.db.ExecContext(ctx, updatePhotoPath, arg.PathToPhoto, arg.PhotoID)
 	return err
 }
+
+const updateUserFolder = `-- name: UpdateUserFolder :exec
+UPDATE user_folders
+SET is_sub_folder = ?, name = ?, description = ?, parent_folder_id = ?
+WHERE user_folder_id = ?
+`
+
+type UpdateUserFolderParams struct {
+	IsSubFolder    sql.NullBool
+	Name           string
+	Description    string
+	ParentFolderID sql.NullInt32
+	UserFolderID   uint32
+}
+
+func (q *Queries) UpdateUserFolder(ctx context.Context, arg UpdateUserFolderParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserFolder,
+		arg.IsSubFolder,
+		arg.Name,
+		arg.Description,
+		arg.ParentFolderID,
+		arg.UserFolderID,
+	)
+	return err
+}
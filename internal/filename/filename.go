@@ -0,0 +1,56 @@
+package filename
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the maximum length in bytes of a sanitized filename.
+const MaxLength = 100
+
+// fallback replaces names that are empty once sanitized.
+const fallback = "photo"
+
+// Sanitize reduces a filename sent by a client to a safe form: directories are dropped, control characters and
+// characters reserved by common filesystems are replaced, leading dots are removed so that the file is never hidden,
+// and the name is truncated to MaxLength bytes, keeping its extension.
+func Sanitize(name string) string {
+	// Browsers on Windows may send the full path of the file
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return fallback
+	}
+
+	if len(name) > MaxLength {
+		ext := path.Ext(name)
+		if len(ext) > MaxLength/4 {
+			ext = ""
+		}
+		name = truncate(strings.TrimSuffix(name, ext), MaxLength-len(ext)) + ext
+	}
+	return name
+}
+
+// truncate cuts a string to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
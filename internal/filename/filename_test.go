@@ -0,0 +1,23 @@
+package filename
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSanitize ensures that unsafe filenames are reduced to a safe form.
+func TestSanitize(t *testing.T) {
+	assert.Equal(t, "gala 2024.jpg", Sanitize("gala 2024.jpg"), "Safe names should be kept")
+	assert.Equal(t, "passwd", Sanitize("../../etc/passwd"), "Directories should be dropped")
+	assert.Equal(t, "IMG_0001.JPG", Sanitize(`C:\Users\bde\IMG_0001.JPG`), "Windows paths should be dropped")
+	assert.Equal(t, "htaccess", Sanitize(".htaccess"), "Leading dots should be removed")
+	assert.Equal(t, "a_b_c.png", Sanitize("a\x00b|c.png"), "Control and reserved characters should be replaced")
+	assert.Equal(t, "photo", Sanitize("..."), "Empty names should be replaced")
+	assert.Equal(t, "été.jpg", Sanitize("été.jpg"), "Accented characters should be kept")
+
+	long := Sanitize(strings.Repeat("é", 200) + ".jpeg")
+	assert.LessOrEqual(t, len(long), MaxLength, "Long names should be truncated")
+	assert.True(t, strings.HasSuffix(long, "é.jpeg"), "Truncation should keep the extension and whole characters")
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"photos/internal/db/query"
+	"photos/internal/filename"
+	"photos/internal/metadata"
+	"photos/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveFolder is an event whose photos are written to a folder of an archive.
+type archiveFolder struct {
+	event query.Event
+	path  string // Path of the folder in the archive, empty for the requested event.
+}
+
+// EventArchiveHandler streams a ZIP archive of the original photos of an event. With the "sub_events" query parameter,
+// the photos of its sub-events are added in nested folders. The originals are stripped of their metadata as they are
+// by PhotoHandler, and the archive is written while it is sent, without being built in memory or on disk first.
+func (cfg Config) EventArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	eventID, err := strconv.Atoi(r.URL.Query().Get("event_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse event_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	withSubEvents := r.URL.Query().Get("sub_events") != ""
+	userInfo := ctx.Value("userInfo").(query.User)
+
+	events, err := cfg.DB.GetEvents(ctx)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	folders := archiveFolders(events, uint32(eventID), withSubEvents)
+	if len(folders) == 0 {
+		RespondWithMessage(w, "event_id does not correspond to any existing event", http.StatusNotFound)
+		return
+	}
+	if _, isLocked, err := cfg.lockedEvent(r, folders[0].event.EventID); err != nil || isLocked {
+		respondWithLockError(w, err)
+		return
+	}
+
+	// Large events take longer to send than the write timeout of the server
+	if err = http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		cfg.Logger.Warn().Err(err).Uint32("event_id", uint32(eventID)).Msg("could not clear the write deadline of an archive")
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename.Sanitize(folders[0].event.Name) + ".zip"}))
+
+	// Once the archive has started, errors can only be reported by cutting it short
+	zw := zip.NewWriter(w)
+	usedNames := map[string]bool{}
+	for _, folder := range folders {
+		// Sub-events with a password of their own are left out until they are unlocked
+		_, isLocked, err := cfg.lockedEvent(r, folder.event.EventID)
+		if err != nil {
+			cfg.Logger.Error().Err(err).Uint32("event_id", uint32(eventID)).Msg("could not write the archive of an event")
+			return
+		}
+		if isLocked {
+			continue
+		}
+		if err = cfg.writeArchiveFolder(ctx, zw, folder, userInfo.IsAdmin, usedNames); err != nil {
+			cfg.Logger.Error().Err(err).Uint32("event_id", uint32(eventID)).Msg("could not write the archive of an event")
+			return
+		}
+	}
+	if err = zw.Close(); err != nil {
+		cfg.Logger.Error().Err(err).Uint32("event_id", uint32(eventID)).Msg("could not write the archive of an event")
+	}
+}
+
+// archiveFolders lists the event and, if requested, its sub-events with the path of their folder in the archive.
+// Events are listed parents first. The list is empty if the event does not exist.
+func archiveFolders(events []query.Event, eventID uint32, withSubEvents bool) []archiveFolder {
+	var folders []archiveFolder
+	children := map[uint32][]query.Event{}
+	for _, e := range events {
+		if e.EventID == eventID {
+			folders = append(folders, archiveFolder{event: e})
+		}
+		if e.ParentEventID.Valid {
+			parentID := uint32(e.ParentEventID.Int32)
+			children[parentID] = append(children[parentID], e)
+		}
+	}
+	if len(folders) == 0 || !withSubEvents {
+		return folders
+	}
+
+	// The visited events guard against cycles in the event tree
+	visited := map[uint32]bool{eventID: true}
+	for i := 0; i < len(folders); i++ {
+		usedNames := map[string]bool{}
+		for _, child := range children[folders[i].event.EventID] {
+			if visited[child.EventID] {
+				continue
+			}
+			visited[child.EventID] = true
+			name := uniqueName(usedNames, filename.Sanitize(child.Name))
+			folders = append(folders, archiveFolder{event: child, path: path.Join(folders[i].path, name)})
+		}
+	}
+	return folders
+}
+
+// writeArchiveFolder adds the photos of an event to the archive. Photos whose file is missing are skipped,
+// as are hidden photos unless includeHidden is set.
+func (cfg Config) writeArchiveFolder(ctx context.Context, zw *zip.Writer, folder archiveFolder, includeHidden bool, usedNames map[string]bool) error {
+	photos, err := cfg.DB.GetPhotosByEventID(ctx, folder.event.EventID)
+	if err != nil {
+		return err
+	}
+	policy, err := cfg.eventMetadataPolicy(ctx, folder.event.EventID)
+	if err != nil {
+		return err
+	}
+	if folder.path != "" {
+		if _, err = zw.Create(folder.path + "/"); err != nil {
+			return err
+		}
+	}
+
+	for _, photo := range photos {
+		if photo.IsHidden && !includeHidden {
+			continue
+		}
+		name := photoName(photo)
+		file, err := cfg.Storage.Get(ctx, photo.PathToPhoto)
+		if errors.Is(err, storage.ErrNotExist) {
+			cfg.Logger.Warn().Uint32("event_id", folder.event.EventID).Uint32("photo_id", photo.PhotoID).Msg("photo missing from the storage, left out of the archive")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Photos are already compressed, they are stored as is
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     uniqueName(usedNames, path.Join(folder.path, name)),
+			Method:   zip.Store,
+			Modified: photo.CreationDate,
+		})
+		if err == nil {
+			err = metadata.Strip(entry, file, policy)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueName returns name, or name with a number before its extension if it is already used, and marks it as used.
+// Several photos can share a name since they come from different uploads.
+func uniqueName(usedNames map[string]bool, name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	unique := name
+	for i := 2; usedNames[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	usedNames[unique] = true
+	return unique
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"photos/internal/db/query"
+	"photos/internal/jobs"
+	"photos/internal/tags"
+	"strconv"
+	"strings"
+)
+
+// Bulk operations apply an action to a selection of photos in a single transaction: if the server fails on one
+// photo, none of them is changed. Photos that cannot be processed are reported in the results instead.
+
+// Actions of a bulk operation.
+const (
+	bulkMove   = "move"
+	bulkCopy   = "copy"
+	bulkHide   = "hide"
+	bulkShow   = "show"
+	bulkDelete = "delete"
+	bulkTag    = "tag"
+)
+
+// Statuses of the photos of a bulk operation.
+const (
+	resultMoved   = "déplacée"
+	resultCopied  = "copiée"
+	resultHidden  = "masquée"
+	resultShown   = "affichée"
+	resultDeleted = "supprimée"
+	resultTagged  = "étiquetée"
+)
+
+// bulkOperation is an action of a bulk operation with its parameters.
+type bulkOperation struct {
+	Action        string
+	TargetEventID uint32    // Event receiving the photos that are moved or copied.
+	Tag           query.Tag // Tag added to the photos.
+	UserID        uint32    // User applying the operation.
+}
+
+// BulkPhotosHandler applies an action to the photos selected by the photo_id values of the form. Moving and copying
+// require the target_event_id of the event receiving the photos. Tagging requires the tag to add to them.
+// The per-photo results are returned as JSON when the client accepts it, and on the results page otherwise.
+func (cfg Config) BulkPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	if err := r.ParseForm(); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to parse form data: %s", err), http.StatusBadRequest)
+		return
+	}
+	op := bulkOperation{Action: r.FormValue("action"), UserID: userInfo.UserID}
+	switch op.Action {
+	case bulkMove, bulkCopy, bulkHide, bulkShow, bulkDelete, bulkTag:
+	default:
+		RespondWithMessage(w, fmt.Sprintf("Unknown action %q", op.Action), http.StatusBadRequest)
+		return
+	}
+	photoIDs := make([]uint32, 0, len(r.Form["photo_id"]))
+	for _, value := range r.Form["photo_id"] {
+		photoID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse photo_id param: %s", err), http.StatusBadRequest)
+			return
+		}
+		photoIDs = append(photoIDs, uint32(photoID))
+	}
+	if len(photoIDs) == 0 {
+		RespondWithMessage(w, "No photos selected", http.StatusBadRequest)
+		return
+	}
+
+	if op.Action == bulkMove || op.Action == bulkCopy {
+		eventID, err := strconv.Atoi(r.FormValue("target_event_id"))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse target_event_id param: %s", err), http.StatusBadRequest)
+			return
+		}
+		events, err := cfg.DB.GetEventByID(ctx, uint32(eventID))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if len(events) == 0 {
+			RespondWithMessage(w, "target_event_id does not correspond to any existing event", http.StatusNotFound)
+			return
+		}
+		op.TargetEventID = events[0].EventID
+	}
+	if op.Action == bulkTag {
+		if _, err := tags.Normalize(r.FormValue("tag")); err != nil {
+			RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+	if op.Action == bulkTag {
+		op.Tag, err = findOrCreateTag(ctx, qtx, r.FormValue("tag"), userInfo.IsAdmin)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	results := make([]fileResult, 0, len(photoIDs))
+	for _, photoID := range photoIDs {
+		result, err := bulkPhoto(ctx, qtx, op, photoID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure on photo %d: %s", photoID, err), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, result)
+	}
+	if err = tx.Commit(); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cfg.Jobs.Wake()
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(map[string]interface{}{"results": results}); err != nil {
+			RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	backURL := cfg.Routes.Dashboard
+	if eventID := r.FormValue("event_id"); eventID != "" {
+		backURL = fmt.Sprintf("%s?event_id=%s", cfg.Routes.Event, eventID)
+	}
+	renderTemplate(w, cfg.Templates, "results.html", map[string]interface{}{
+		"Title":   "Résultat de l'opération",
+		"BackURL": backURL,
+		"Results": results,
+	})
+}
+
+// bulkPhoto applies a bulk operation to one photo. Missing photos, deleted photos that would be
+// moved or copied, and photos whose content is already in the target event are reported in the result.
+func bulkPhoto(ctx context.Context, qtx *query.Queries, op bulkOperation, photoID uint32) (fileResult, error) {
+	photo, err := qtx.GetPhoto(ctx, photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fileResult{PhotoID: photoID, Name: fmt.Sprintf("Photo %d", photoID), Status: resultRejected, Reason: "photo introuvable"}, nil
+	}
+	if err != nil {
+		return fileResult{}, err
+	}
+	result := fileResult{PhotoID: photoID, Name: photoName(photo)}
+
+	switch op.Action {
+	case bulkHide, bulkShow:
+		result.Status = resultShown
+		if op.Action == bulkHide {
+			result.Status = resultHidden
+		}
+		return result, qtx.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: op.Action == bulkHide, PhotoID: photoID})
+	case bulkDelete:
+		result.Status = resultDeleted
+		return result, qtx.TrashPhoto(ctx, photoID)
+	case bulkTag:
+		result.Status, result.Reason = resultTagged, op.Tag.Name
+		return result, qtx.AddPhotoTag(ctx, query.AddPhotoTagParams{PhotoID: photoID, TagID: op.Tag.TagID, UserID: op.UserID})
+	}
+
+	if photo.DeletionDate.Valid {
+		result.Status, result.Reason = resultRejected, "photo dans la corbeille"
+		return result, nil
+	}
+	if photo.EventID == op.TargetEventID {
+		result.Status, result.Reason = resultRejected, "déjà dans cet évènement"
+		return result, nil
+	}
+	// An event cannot hold the same content twice
+	duplicate, err := qtx.GetPhotoByEventIDAndHash(ctx, query.GetPhotoByEventIDAndHashParams{EventID: op.TargetEventID, PhotoHash: photo.PhotoHash})
+	if err == nil {
+		result.Status, result.Reason = resultDuplicate, fmt.Sprintf("identique à la photo %d", duplicate.PhotoID)
+		return result, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fileResult{}, err
+	}
+
+	if op.Action == bulkMove {
+		result.Status = resultMoved
+		return result, qtx.UpdatePhotoEvent(ctx, query.UpdatePhotoEventParams{EventID: op.TargetEventID, PhotoID: photoID})
+	}
+	copyID, err := copyPhoto(ctx, qtx, photo, op.TargetEventID)
+	if err != nil {
+		return fileResult{}, err
+	}
+	result.Status, result.Reason = resultCopied, fmt.Sprintf("nouvelle photo %d", copyID)
+	return result, nil
+}
+
+// copyPhoto adds a photo to another event, with its metadata, its tags and its hidden state. The copy shares the stored
+// files of the photo, which are only purged once no photo uses them.
+func copyPhoto(ctx context.Context, qtx *query.Queries, photo query.Photo, eventID uint32) (uint32, error) {
+	copyID, err := qtx.CreatePhoto(ctx, query.CreatePhotoParams{
+		PhotoHash:        photo.PhotoHash,
+		OriginalFilename: photo.OriginalFilename,
+		PathToPhoto:      photo.PathToPhoto,
+		PathToThumbnail:  photo.PathToThumbnail,
+		PathToPreview:    photo.PathToPreview,
+		EventID:          eventID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if photo.IsHidden {
+		if err = qtx.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: true, PhotoID: uint32(copyID)}); err != nil {
+			return 0, err
+		}
+	}
+
+	err = qtx.CopyPhotoTags(ctx, query.CopyPhotoTagsParams{NewPhotoID: uint32(copyID), PhotoID: photo.PhotoID})
+	if err != nil {
+		return 0, err
+	}
+
+	// Photos whose metadata job has not run yet have none, the copy gets its own job
+	md, err := qtx.GetPhotoMetadata(ctx, photo.PhotoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uint32(copyID), jobs.Enqueue(ctx, qtx, jobMetadata, photoJob{PhotoID: uint32(copyID)})
+	}
+	if err != nil {
+		return 0, err
+	}
+	params := query.CreatePhotoMetadataParams(md)
+	params.PhotoID = uint32(copyID)
+	return uint32(copyID), qtx.CreatePhotoMetadata(ctx, params)
+}
+
+// photoName returns the name under which a photo was uploaded, or the name of its file for older photos.
+func photoName(photo query.Photo) string {
+	if photo.OriginalFilename != "" {
+		return photo.OriginalFilename
+	}
+	return path.Base(photo.PathToPhoto)
+}
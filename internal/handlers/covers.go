@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"strconv"
+)
+
+// The tiles of the events show a cover photo: the photo picked by an admin, or else the first photo of the event
+// and then of its sub-events. Photos of protected sub-events, and of the events nested in them, are never picked
+// automatically, and the covers of protected events are only shown once they are unlocked, so that tiles do not
+// reveal their photos.
+
+// eventCovers returns the cover photos of the children of an event, or of the top-level events when parent is
+// NULL, by event ID. Events without any visible photo have no cover.
+func (cfg Config) eventCovers(r *http.Request, parent sql.NullInt32) (map[uint32]query.GetEventCoversByParentIDRow, error) {
+	userInfo := r.Context().Value("userInfo").(query.User)
+	rows, err := cfg.DB.GetEventCoversByParentID(r.Context(), query.GetEventCoversByParentIDParams{
+		ParentEventID: parent,
+		IncludeHidden: userInfo.IsAdmin,
+	})
+	if err != nil {
+		return nil, err
+	}
+	covers := make(map[uint32]query.GetEventCoversByParentIDRow, len(rows))
+	for _, row := range rows {
+		event := query.Event{EventID: row.EventID, PasswordHash: row.PasswordHash}
+		if row.PasswordHash.Valid && !userInfo.IsAdmin && !cfg.isUnlocked(r, event, userInfo.UserID) {
+			continue
+		}
+		covers[row.EventID] = row
+	}
+	return covers, nil
+}
+
+// SetEventCoverHandler makes the photo of photo_id, which must belong to the event of event_id, the cover of the
+// event. Without photo_id, the event goes back to the automatic cover.
+func (cfg Config) SetEventCoverHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, ok := cfg.formEvent(w, r)
+	if !ok {
+		return
+	}
+	if r.FormValue("photo_id") == "" {
+		if err := cfg.DB.DeleteEventCover(ctx, event.EventID); err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, event.EventID), http.StatusSeeOther)
+		return
+	}
+
+	photoID, err := strconv.Atoi(r.FormValue("photo_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse photo_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	photo, err := cfg.DB.GetPhoto(ctx, uint32(photoID))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (photo.EventID != event.EventID || photo.DeletionDate.Valid)) {
+		RespondWithMessage(w, "photo_id does not correspond to any photo of the event", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if err = cfg.DB.SetEventCover(ctx, query.SetEventCoverParams{EventID: event.EventID, PhotoID: photo.PhotoID}); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, event.EventID), http.StatusSeeOther)
+}
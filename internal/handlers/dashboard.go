@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"photos/internal/db/query"
@@ -18,11 +19,21 @@ func (cfg Config) ServeDashboardHandler(w http.ResponseWriter, r *http.Request)
 		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
 		return
 	}
+	covers, err := cfg.eventCovers(r, sql.NullInt32{})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	curatedTags, err := cfg.DB.GetCuratedTags(ctx)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
 	csrfToken := csrf.Token(r)
 	now := time.Now()
 	defaultDate := now.Format("2006-01-02T15:04") // Proper datetime-local format
 	w.Header().Set("Content-Type", "text/html")
-	err = cfg.Templates.ExecuteTemplate(w, "dashboard.html", map[string]interface{}{"Events": events, "UserInfo": userInfo, "CSRF_TOKEN": csrfToken, "DefaultDate": defaultDate})
+	err = cfg.Templates.ExecuteTemplate(w, "dashboard.html", map[string]interface{}{"Events": events, "Covers": covers, "UserInfo": userInfo, "CSRF_TOKEN": csrfToken, "DefaultDate": defaultDate, "TrashURL": cfg.Routes.Trash, "ReportsURL": cfg.Routes.Reports, "JobsURL": cfg.Routes.Jobs, "StorageCheckURL": cfg.Routes.StorageCheck, "Tags": curatedTags, "TagURL": cfg.Routes.Tag, "SearchURL": cfg.Routes.Search, "FoldersURL": cfg.Routes.Folders, "MyPhotosURL": cfg.Routes.MyPhotos})
 	if err != nil {
 		RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
 		return
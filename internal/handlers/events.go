@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"photos/internal/db/query"
+	"photos/internal/metadata"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/csrf"
@@ -19,34 +23,28 @@ func (cfg Config) ServeEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	events, err := cfg.DB.DB.GetEvents(ctx)
+	csrfToken := csrf.Token(r)
+	userInfo := ctx.Value("userInfo").(query.User)
+	events, err := cfg.DB.GetEventByID(ctx, uint32(eventID))
 	if err != nil {
 		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
 		return
 	}
-
-	csrfToken := csrf.Token(r)
-	userInfo := ctx.Value("userInfo").(query.User)
-	// Filter the main event and its child events
-	var mainEvent query.Event
-	childEvents := make([]query.Event, 0)
-	eventExists := false
-
-	for _, e := range events {
-		if e.EventID == uint32(eventID) {
-			mainEvent = e
-			eventExists = true
-		}
-		if e.ParentEventID.Valid && e.ParentEventID.Int32 == int32(eventID) {
-			childEvents = append(childEvents, e)
-		}
-	}
-
 	// If the main event doesn't exist, respond with an error
-	if !eventExists {
+	if len(events) == 0 {
 		RespondWithMessage(w, "event_id does not correspond to any existing event", http.StatusBadRequest)
 		return
 	}
+	mainEvent := events[0]
+	locked, isLocked, err := cfg.lockedEvent(r, mainEvent.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if isLocked {
+		cfg.renderUnlock(w, r, locked, mainEvent.EventID, "", http.StatusOK)
+		return
+	}
 
 	photos, err := cfg.DB.DB.GetPhotosByEventID(ctx, mainEvent.EventID)
 	if err != nil {
@@ -54,17 +52,86 @@ func (cfg Config) ServeEventHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userFolders, err := cfg.DB.GetUserFoldersByUserID(ctx, userInfo.UserID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// The breadcrumbs lead back to the root of the tree, and the tiles of the sub-events count the photos of their
+	// whole sub-tree
+	ancestors, err := cfg.DB.GetEventAncestors(ctx, mainEvent.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	childEvents, err := cfg.DB.GetChildEventsWithPhotoCounts(ctx, query.GetChildEventsWithPhotoCountsParams{
+		ParentEventID: sql.NullInt32{Int32: int32(mainEvent.EventID), Valid: true},
+		IncludeHidden: userInfo.IsAdmin,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	covers, err := cfg.eventCovers(r, sql.NullInt32{Int32: int32(mainEvent.EventID), Valid: true})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	// Only the forms of the admins list the other events, and show the cover picked for the event
+	var cover query.EventCover
+	var allEvents []query.Event
+	var subEvents map[uint32]bool
+	if userInfo.IsAdmin {
+		if allEvents, err = cfg.DB.GetEvents(ctx); err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if subEvents, err = cfg.subEventIDs(ctx, mainEvent.EventID); err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		cover, err = cfg.DB.GetEventCover(ctx, mainEvent.EventID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	now := time.Now()
 	defaultDate := now.Format("2006-01-02T15:04") // Proper datetime-local format
 	// Prepare the data for the template
 	data := map[string]interface{}{
-		"Event":       mainEvent,
-		"ChildEvents": childEvents,
-		"Photos":      photos,
-		"UserInfo":    userInfo,
-		"CSRF_TOKEN":  csrfToken,
-		"DefaultDate": defaultDate,
-		"ParentID":    eventID,
+		"Event":             mainEvent,
+		"Ancestors":         ancestors,
+		"ChildEvents":       childEvents,
+		"Covers":            covers,
+		"Cover":             cover,
+		"Events":            allEvents,
+		"Photos":            photos,
+		"UserInfo":          userInfo,
+		"CSRF_TOKEN":        csrfToken,
+		"DefaultDate":       defaultDate,
+		"ParentID":          eventID,
+		"UploadsURL":        cfg.Routes.Uploads,
+		"ArchiveURL":        cfg.Routes.EventArchive,
+		"MetadataPolicyURL": cfg.Routes.MetadataPolicy,
+		"EventPasswordURL":  cfg.Routes.EventPassword,
+		"HidePhotoURL":      cfg.Routes.HidePhoto,
+		"DeletePhotoURL":    cfg.Routes.DeletePhoto,
+		"BulkPhotosURL":     cfg.Routes.BulkPhotos,
+		"ChunkSize":         cfg.Uploads.ChunkSize,
+		"PhotoTagsURL":      cfg.Routes.PhotoTags,
+		"TagSuggestionsURL": cfg.Routes.TagSuggestions,
+		"ReportPhotoURL":    cfg.Routes.ReportPhoto,
+		"UserFolders":       userFolders,
+		"FolderURL":         cfg.Routes.Folder,
+		"PhotoPeopleURL":    cfg.Routes.PhotoPeople,
+		"SimilarPhotosURL":  cfg.Routes.SimilarPhotos,
+		"DuplicatesURL":     cfg.Routes.Duplicates,
+		"EventURL":          cfg.Routes.Event,
+		"SubEventIDs":       subEvents,
+		"DashboardURL":      cfg.Routes.Dashboard,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -88,6 +155,11 @@ func (cfg *Config) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 	eventDescription := r.FormValue("event_description")
 	eventDate := r.FormValue("event_date")
 	eventParentID := r.FormValue("event_parentID")
+	eventMetadataPolicy, err := parseEventMetadataPolicy(r.FormValue("event_metadata_policy"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	isEventParentIDNotNil := false
 	var eventParentIDConverted int
@@ -113,9 +185,10 @@ func (cfg *Config) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = cfg.DB.DB.CreateEvent(ctx, query.CreateEventParams{
-		Name:        eventName,
-		Description: eventDescription,
-		EventDate:   parsedEventDate,
+		Name:           eventName,
+		Description:    eventDescription,
+		EventDate:      parsedEventDate,
+		MetadataPolicy: eventMetadataPolicy,
 		ParentEventID: sql.NullInt32{
 			Valid: isEventParentIDNotNil,
 			Int32: int32(eventParentIDConverted),
@@ -132,3 +205,267 @@ func (cfg *Config) CreateEventHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 	}
 }
+
+// UpdateEventMetadataPolicyHandler changes the metadata stripped from the originals of an event.
+// An empty policy makes the event inherit the policy of its parent, or the default of the configuration.
+func (cfg Config) UpdateEventMetadataPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.FormValue("event_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse event_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	policy, err := parseEventMetadataPolicy(r.FormValue("event_metadata_policy"))
+	if err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = cfg.DB.UpdateEventMetadataPolicy(r.Context(), query.UpdateEventMetadataPolicyParams{
+		MetadataPolicy: policy,
+		EventID:        uint32(eventID),
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, eventID), http.StatusSeeOther)
+}
+
+// parseEventMetadataPolicy validates the metadata policy submitted in an event form.
+// An empty value is stored as NULL so that the event inherits the policy.
+func parseEventMetadataPolicy(value string) (query.NullEventsMetadataPolicy, error) {
+	if value == "" {
+		return query.NullEventsMetadataPolicy{}, nil
+	}
+	policy, err := metadata.ParsePolicy(value)
+	if err != nil {
+		return query.NullEventsMetadataPolicy{}, err
+	}
+	return query.NullEventsMetadataPolicy{EventsMetadataPolicy: query.EventsMetadataPolicy(policy), Valid: true}, nil
+}
+
+// eventMetadataPolicy returns the metadata policy applied to the photos of an event.
+// Events without a policy inherit the one of their closest ancestor, and the default
+// of the configuration applies when no ancestor sets one.
+func (cfg Config) eventMetadataPolicy(ctx context.Context, eventID uint32) (metadata.Policy, error) {
+	events, err := cfg.DB.GetEventByID(ctx, eventID)
+	if err != nil {
+		return "", err
+	}
+	ancestors, err := cfg.DB.GetEventAncestors(ctx, eventID)
+	if err != nil {
+		return "", err
+	}
+	// The ancestors come from the root, so the policy of the closest event that sets one is kept
+	policy := cfg.MetadataPolicy
+	for _, event := range append(ancestors, events...) {
+		if event.MetadataPolicy.Valid {
+			policy = metadata.Policy(event.MetadataPolicy.EventsMetadataPolicy)
+		}
+	}
+	return policy, nil
+}
+
+// Actions applied to the photos of a deleted event and of its sub-events.
+const (
+	deletedEventMove   = "move"   // Photos are moved to another event.
+	deletedEventDelete = "delete" // Photos are deleted with their files.
+)
+
+// UpdateEventHandler changes the name, the description, the date and the parent of an event. An empty
+// event_parentID makes it a top-level event. An event cannot be moved under itself or one of its sub-events.
+func (cfg Config) UpdateEventHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, ok := cfg.formEvent(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("event_name"))
+	description := strings.TrimSpace(r.FormValue("event_description"))
+	if name == "" || description == "" {
+		RespondWithMessage(w, "All fields are required", http.StatusBadRequest)
+		return
+	}
+	eventDate, err := time.Parse("2006-01-02T15:04", r.FormValue("event_date"))
+	if err != nil {
+		RespondWithMessage(w, "Invalid event date format", http.StatusBadRequest)
+		return
+	}
+
+	var parent sql.NullInt32
+	if value := r.FormValue("event_parentID"); value != "" {
+		parentID, err := strconv.Atoi(value)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse event_parentID param: %s", err), http.StatusBadRequest)
+			return
+		}
+		parents, err := cfg.DB.GetEventByID(ctx, uint32(parentID))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if len(parents) == 0 {
+			RespondWithMessage(w, "event_parentID does not correspond to any existing event", http.StatusNotFound)
+			return
+		}
+		subEvents, err := cfg.subEventIDs(ctx, event.EventID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if uint32(parentID) == event.EventID || subEvents[uint32(parentID)] {
+			RespondWithMessage(w, "An event cannot be moved under itself or one of its sub-events", http.StatusBadRequest)
+			return
+		}
+		parent = sql.NullInt32{Int32: int32(parentID), Valid: true}
+	}
+
+	err = cfg.DB.UpdateEvent(ctx, query.UpdateEventParams{
+		Name:          name,
+		Description:   description,
+		EventDate:     eventDate,
+		ParentEventID: parent,
+		EventID:       event.EventID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, event.EventID), http.StatusSeeOther)
+}
+
+// DeleteEventHandler deletes an event with its sub-events. The "photos" field tells what happens to their photos,
+// trashed ones included: they are either moved to the event of target_event_id, outside of the deleted events, or
+// deleted with their files. Moved photos whose content is already in the target event are merged into the photo
+// of the target event, which receives their tags, their places in personal folders and the users marked in them.
+func (cfg Config) DeleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, ok := cfg.formEvent(w, r)
+	if !ok {
+		return
+	}
+	action := r.FormValue("photos")
+	if action != deletedEventMove && action != deletedEventDelete {
+		RespondWithMessage(w, fmt.Sprintf("Unknown action %q for the photos", action), http.StatusBadRequest)
+		return
+	}
+	deleted, err := cfg.subEventIDs(ctx, event.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	deleted[event.EventID] = true
+
+	var targetID uint32
+	if action == deletedEventMove {
+		value, err := strconv.Atoi(r.FormValue("target_event_id"))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse target_event_id param: %s", err), http.StatusBadRequest)
+			return
+		}
+		targetID = uint32(value)
+		targets, err := cfg.DB.GetEventByID(ctx, targetID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if len(targets) == 0 {
+			RespondWithMessage(w, "target_event_id does not correspond to any existing event", http.StatusNotFound)
+			return
+		}
+		if deleted[targetID] {
+			RespondWithMessage(w, "Photos cannot be moved to an event that is deleted", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+	var deletedPhotos []query.Photo
+	for eventID := range deleted {
+		photos, err := qtx.GetAllPhotosByEventID(ctx, eventID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		for _, photo := range photos {
+			if action == deletedEventDelete {
+				err = qtx.DeletePhoto(ctx, photo.PhotoID)
+				deletedPhotos = append(deletedPhotos, photo)
+			} else {
+				err = movePhotoOfDeletedEvent(ctx, qtx, photo, targetID)
+			}
+			if err != nil {
+				RespondWithMessage(w, fmt.Sprintf("DB Failure on photo %d: %s", photo.PhotoID, err), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	// The sub-events are deleted by the cascade of their parent_event_id
+	if err = qtx.DeleteEvent(ctx, event.EventID); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	// The files are deleted before the commit so that uploads of the same content cannot reuse them meanwhile.
+	// Files left behind by a failure, or photos left without files by a failed commit, are found by the storage check.
+	for _, photo := range deletedPhotos {
+		if _, err = cfg.deleteUnusedFiles(ctx, qtx, photo); err != nil {
+			cfg.Logger.Error().Err(err).Uint32("photo_id", photo.PhotoID).Msg("failed to delete the files of a photo")
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if event.ParentEventID.Valid {
+		http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, event.ParentEventID.Int32), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, cfg.Routes.Dashboard, http.StatusSeeOther)
+}
+
+// movePhotoOfDeletedEvent moves a photo of a deleted event to the target event. A photo whose content is already
+// in the target event is deleted instead, after giving its tags, folders and marked users to the photo of the
+// target event. Its reports are dropped with it.
+func movePhotoOfDeletedEvent(ctx context.Context, qtx *query.Queries, photo query.Photo, targetID uint32) error {
+	duplicate, err := qtx.GetPhotoByEventIDAndHash(ctx, query.GetPhotoByEventIDAndHashParams{EventID: targetID, PhotoHash: photo.PhotoHash})
+	if errors.Is(err, sql.ErrNoRows) {
+		return qtx.UpdatePhotoEvent(ctx, query.UpdatePhotoEventParams{EventID: targetID, PhotoID: photo.PhotoID})
+	}
+	if err != nil {
+		return err
+	}
+	err = qtx.CopyPhotoTags(ctx, query.CopyPhotoTagsParams{NewPhotoID: duplicate.PhotoID, PhotoID: photo.PhotoID})
+	if err != nil {
+		return err
+	}
+	err = qtx.CopyPhotoUserFolders(ctx, query.CopyPhotoUserFoldersParams{NewPhotoID: duplicate.PhotoID, PhotoID: photo.PhotoID})
+	if err != nil {
+		return err
+	}
+	err = qtx.CopyRecognizedUsers(ctx, query.CopyRecognizedUsersParams{NewPhotoID: duplicate.PhotoID, PhotoID: photo.PhotoID})
+	if err != nil {
+		return err
+	}
+	return qtx.DeletePhoto(ctx, photo.PhotoID)
+}
+
+// subEventIDs returns the IDs of the sub-events of an event, at any depth. The event itself is not included.
+func (cfg Config) subEventIDs(ctx context.Context, eventID uint32) (map[uint32]bool, error) {
+	descendants, err := cfg.DB.GetEventDescendantIDs(ctx, sql.NullInt32{Int32: int32(eventID), Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[uint32]bool, len(descendants))
+	for _, id := range descendants {
+		if id != eventID {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/csrf"
+)
+
+// Personal folders let users gather the photos they like from any event, and nest folders in one another.
+// A folder can be shared read-only with other users, which also shares its sub-folders.
+// Folders only hold references to photos: photos the viewer cannot see are left out of them.
+
+// ServeFoldersHandler lists the top-level folders of the user and the folders shared with them.
+func (cfg Config) ServeFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	folders, err := cfg.DB.GetUserFoldersByUserID(ctx, userInfo.UserID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	rootFolders := make([]query.UserFolder, 0, len(folders))
+	for _, folder := range folders {
+		if !folder.ParentFolderID.Valid {
+			rootFolders = append(rootFolders, folder)
+		}
+	}
+	shared, err := cfg.DB.GetSharedUserFolders(ctx, userInfo.UserID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "folders.html", map[string]interface{}{
+		"Folders":      rootFolders,
+		"Shared":       shared,
+		"FolderURL":    cfg.Routes.Folder,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	})
+}
+
+// ServeFolderHandler shows a folder with its sub-folders and photos. Owners also get the forms changing it.
+func (cfg Config) ServeFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	path, owned, ok := cfg.formFolder(w, r)
+	if !ok {
+		return
+	}
+	folder := path[len(path)-1]
+
+	subFolders, err := cfg.DB.GetSubFolders(ctx, sql.NullInt32{Int32: int32(folder.UserFolderID), Valid: true})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	photos, err := cfg.DB.GetPhotosByUserFolderID(ctx, query.GetPhotosByUserFolderIDParams{
+		UserFolderID:  folder.UserFolderID,
+		IncludeHidden: userInfo.IsAdmin,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if photos, err = cfg.unlockedPhotos(r, photos); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Folder":       folder,
+		"Path":         path[:len(path)-1],
+		"SubFolders":   subFolders,
+		"Photos":       photos,
+		"Owned":        owned,
+		"FolderURL":    cfg.Routes.Folder,
+		"FoldersURL":   cfg.Routes.Folders,
+		"EventURL":     cfg.Routes.Event,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	}
+	if owned {
+		shares, err := cfg.DB.GetUserFolderShares(ctx, folder.UserFolderID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		folders, err := cfg.DB.GetUserFoldersByUserID(ctx, userInfo.UserID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		data["Shares"] = shares
+		data["Folders"] = folders
+	}
+	renderTemplate(w, cfg.Templates, "folder.html", data)
+}
+
+// CreateFolderHandler creates a folder of the user, inside the folder of parent_folder_id when it is set.
+func (cfg Config) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		RespondWithMessage(w, "The name of the folder cannot be empty", http.StatusBadRequest)
+		return
+	}
+	parentFolderID, ok := cfg.formParentFolder(w, r, userInfo, 0)
+	if !ok {
+		return
+	}
+	folderID, err := cfg.DB.CreateUserFolder(ctx, query.CreateUserFolderParams{
+		IsSubFolder:    sql.NullBool{Bool: parentFolderID.Valid, Valid: true},
+		Name:           name,
+		Description:    strings.TrimSpace(r.FormValue("description")),
+		UserID:         userInfo.UserID,
+		ParentFolderID: parentFolderID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folderID), http.StatusSeeOther)
+}
+
+// UpdateFolderHandler renames a folder of the user, changes its description and moves it to another parent.
+func (cfg Config) UpdateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	userInfo := r.Context().Value("userInfo").(query.User)
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		RespondWithMessage(w, "The name of the folder cannot be empty", http.StatusBadRequest)
+		return
+	}
+	parentFolderID, ok := cfg.formParentFolder(w, r, userInfo, folder.UserFolderID)
+	if !ok {
+		return
+	}
+	err := cfg.DB.UpdateUserFolder(r.Context(), query.UpdateUserFolderParams{
+		IsSubFolder:    sql.NullBool{Bool: parentFolderID.Valid, Valid: true},
+		Name:           name,
+		Description:    strings.TrimSpace(r.FormValue("description")),
+		ParentFolderID: parentFolderID,
+		UserFolderID:   folder.UserFolderID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folder.UserFolderID), http.StatusSeeOther)
+}
+
+// DeleteFolderHandler deletes a folder of the user with its sub-folders. The photos themselves are kept.
+func (cfg Config) DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.DeleteUserFolder(r.Context(), folder.UserFolderID); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	backURL := cfg.Routes.Folders
+	if folder.ParentFolderID.Valid {
+		backURL = fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folder.ParentFolderID.Int32)
+	}
+	http.Redirect(w, r, backURL, http.StatusSeeOther)
+}
+
+// AddPhotoToFolderHandler adds a photo the user can see to one of their folders.
+func (cfg Config) AddPhotoToFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.DB.AddPhotoToUserFolder(r.Context(), query.AddPhotoToUserFolderParams{UserFolderID: folder.UserFolderID, PhotoID: photo.PhotoID})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+}
+
+// RemovePhotoFromFolderHandler removes a photo from a folder of the user.
+func (cfg Config) RemovePhotoFromFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	photoID, err := strconv.Atoi(r.FormValue("photo_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse photo_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.RemovePhotoFromUserFolder(r.Context(), query.RemovePhotoFromUserFolderParams{UserFolderID: folder.UserFolderID, PhotoID: uint32(photoID)})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folder.UserFolderID), http.StatusSeeOther)
+}
+
+// ShareFolderHandler shares a folder of the user, read-only, with the user of the email address of the form.
+func (cfg Config) ShareFolderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	user, err := cfg.DB.GetUserWithEmail(ctx, strings.TrimSpace(r.FormValue("email")))
+	if errors.Is(err, sql.ErrNoRows) {
+		RespondWithMessage(w, "email does not correspond to any user who signed in", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if user.UserID != userInfo.UserID {
+		err = cfg.DB.ShareUserFolder(ctx, query.ShareUserFolderParams{UserFolderID: folder.UserFolderID, UserID: user.UserID})
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folder.UserFolderID), http.StatusSeeOther)
+}
+
+// UnshareFolderHandler stops sharing a folder of the user with the user of user_id.
+func (cfg Config) UnshareFolderHandler(w http.ResponseWriter, r *http.Request) {
+	folder, ok := cfg.formOwnedFolder(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse user_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.UnshareUserFolder(r.Context(), query.UnshareUserFolderParams{UserFolderID: folder.UserFolderID, UserID: uint32(userID)})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?folder_id=%d", cfg.Routes.Folder, folder.UserFolderID), http.StatusSeeOther)
+}
+
+// formFolder looks up the folder of the folder_id field if the user can see it. It returns the path to the
+// folder, ending with the folder itself and starting at the outermost folder the user can see, and whether the
+// user owns the folder.
+func (cfg Config) formFolder(w http.ResponseWriter, r *http.Request) (path []query.UserFolder, owned bool, ok bool) {
+	folderID, err := strconv.Atoi(r.FormValue("folder_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse folder_id param: %s", err), http.StatusBadRequest)
+		return nil, false, false
+	}
+	userInfo := r.Context().Value("userInfo").(query.User)
+	path, owned, err = cfg.folderPath(r.Context(), uint32(folderID), userInfo.UserID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return nil, false, false
+	}
+	if len(path) == 0 {
+		RespondWithMessage(w, "folder_id does not correspond to any folder you can see", http.StatusNotFound)
+		return nil, false, false
+	}
+	return path, owned, true
+}
+
+// formOwnedFolder looks up the folder of the folder_id field, which the user must own.
+func (cfg Config) formOwnedFolder(w http.ResponseWriter, r *http.Request) (query.UserFolder, bool) {
+	path, owned, ok := cfg.formFolder(w, r)
+	if !ok {
+		return query.UserFolder{}, false
+	}
+	if !owned {
+		RespondWithMessage(w, "The folder is shared with you read-only", http.StatusForbidden)
+		return query.UserFolder{}, false
+	}
+	return path[len(path)-1], true
+}
+
+// formParentFolder reads the parent_folder_id field, which is empty for top-level folders. The parent must be a
+// folder of the user, and cannot be folderID, the folder being moved, or one of its sub-folders.
+func (cfg Config) formParentFolder(w http.ResponseWriter, r *http.Request, userInfo query.User, folderID uint32) (sql.NullInt32, bool) {
+	value := r.FormValue("parent_folder_id")
+	if value == "" {
+		return sql.NullInt32{}, true
+	}
+	parentFolderID, err := strconv.Atoi(value)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse parent_folder_id param: %s", err), http.StatusBadRequest)
+		return sql.NullInt32{}, false
+	}
+	path, owned, err := cfg.folderPath(r.Context(), uint32(parentFolderID), userInfo.UserID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return sql.NullInt32{}, false
+	}
+	if !owned {
+		RespondWithMessage(w, "parent_folder_id does not correspond to any of your folders", http.StatusNotFound)
+		return sql.NullInt32{}, false
+	}
+	for _, ancestor := range path {
+		if ancestor.UserFolderID == folderID {
+			RespondWithMessage(w, "A folder cannot be moved into itself or one of its sub-folders", http.StatusBadRequest)
+			return sql.NullInt32{}, false
+		}
+	}
+	return sql.NullInt32{Int32: int32(parentFolderID), Valid: true}, true
+}
+
+// folderPath returns the path to a folder from the outermost folder userID can see, and whether userID owns it.
+// Owners see the whole path, while users a folder is shared with see it from the outermost shared folder.
+// The path is empty when userID cannot see the folder.
+func (cfg Config) folderPath(ctx context.Context, folderID, userID uint32) ([]query.UserFolder, bool, error) {
+	var ancestors []query.UserFolder // From the folder up to the top-level folder.
+	visited := make(map[uint32]bool)
+	for !visited[folderID] {
+		visited[folderID] = true
+		folder, err := cfg.DB.GetUserFolder(ctx, folderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		ancestors = append(ancestors, folder)
+		if !folder.ParentFolderID.Valid {
+			break
+		}
+		folderID = uint32(folder.ParentFolderID.Int32)
+	}
+	if len(ancestors) == 0 {
+		return nil, false, nil
+	}
+
+	owned := ancestors[0].UserID == userID
+	visible := 0
+	if owned {
+		visible = len(ancestors)
+	} else {
+		for i, ancestor := range ancestors {
+			shares, err := cfg.DB.CountUserFolderShares(ctx, query.CountUserFolderSharesParams{UserFolderID: ancestor.UserFolderID, UserID: userID})
+			if err != nil {
+				return nil, false, err
+			}
+			if shares > 0 {
+				visible = i + 1
+			}
+		}
+	}
+
+	path := make([]query.UserFolder, 0, visible)
+	for i := visible - 1; i >= 0; i-- {
+		path = append(path, ancestors[i])
+	}
+	return path, owned, nil
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"photos/internal/db/query"
+	"photos/internal/imaging"
+	"photos/internal/jobs"
+	"photos/internal/storage"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+)
+
+// The storage check reconciles the files of the storage with the rows of the photos table. Files may be left without
+// a row by uploads that failed after storing them, and rows may point at files removed by hand or at events deleted
+// while the foreign keys were disabled. Repairs never delete anything: orphan files are moved to the quarantine,
+// where an admin can inspect them, and photos whose original is lost are hidden.
+
+// quarantineDir is the prefix of the storage keys of the files moved aside by the repairs of the storage check.
+const quarantineDir = "quarantine"
+
+// lostEventName is the name of the top-level event receiving the photos whose event no longer exists.
+const lostEventName = "Photos retrouvées"
+
+// Kinds of the problems found by the storage check.
+const (
+	problemOrphanFile        = "orphan_file"        // File that no photo uses.
+	problemMissingFile       = "missing_file"       // Original of a photo missing from the storage.
+	problemMissingDerivative = "missing_derivative" // Thumbnail or preview of a photo missing from the storage.
+	problemCorruptedFile     = "corrupted_file"     // File whose size or checksum does not match its photo.
+	problemMissingEvent      = "missing_event"      // Photo whose event no longer exists.
+)
+
+// problemLabels are the labels of the kinds of problems found by the storage check.
+var problemLabels = map[string]string{
+	problemOrphanFile:        "Fichier orphelin",
+	problemMissingFile:       "Fichier manquant",
+	problemMissingDerivative: "Miniature manquante",
+	problemCorruptedFile:     "Fichier corrompu",
+	problemMissingEvent:      "Événement supprimé",
+}
+
+// StorageProblem is an inconsistency between the storage and the photos table found by the storage check.
+type StorageProblem struct {
+	Kind    string // Kind of the problem, one of the problem constants.
+	Key     string // Storage key of the file concerned.
+	PhotoID uint32 // Photo concerned, 0 for orphan files.
+	Detail  string // Description of the problem.
+	Repair  string // Repair applied, empty when the check does not repair.
+}
+
+// storageCheck holds the state of a run of the storage check.
+type storageCheck struct {
+	cfg       Config
+	checksums bool
+	repair    bool
+	before    time.Time // Files and photos more recent are left alone, their upload or jobs may be in progress.
+
+	objects    map[string]storage.Info // Files of the storage outside of the quarantine.
+	referenced map[string]bool         // Keys used by photos, even when their file is missing.
+	relinked   map[string]string       // Keys of the files re-linked to the photos of missing originals.
+	verified   map[string]string       // Outcome of the verification of the originals already checked, "" when sound.
+	problems   []StorageProblem
+}
+
+// CheckStorage finds the orphan files, the missing files, the corrupted files and the photos of deleted events.
+// The checksums of the originals are only verified on request, since every original is read. In repair mode,
+// orphan and corrupted files are quarantined, rows are re-linked to a file of the same content when one exists,
+// missing derivatives are regenerated by jobs, photos whose original is lost are hidden and photos whose event
+// was deleted are moved to the event of the lost photos.
+func (cfg Config) CheckStorage(ctx context.Context, checksums, repair bool) ([]StorageProblem, error) {
+	check := &storageCheck{
+		cfg:        cfg,
+		checksums:  checksums,
+		repair:     repair,
+		before:     time.Now().Add(-cfg.StorageCheck.GracePeriod),
+		objects:    map[string]storage.Info{},
+		referenced: map[string]bool{},
+		relinked:   map[string]string{},
+		verified:   map[string]string{},
+	}
+	err := cfg.Storage.List(ctx, "", func(info storage.Info) error {
+		if !strings.HasPrefix(info.Key, quarantineDir+"/") {
+			check.objects[info.Key] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the storage: %w", err)
+	}
+	photos, err := cfg.DB.GetPhotosSortedByDate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	events, err := cfg.DB.GetEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	eventIDs := make(map[uint32]bool, len(events))
+	for _, event := range events {
+		eventIDs[event.EventID] = true
+	}
+
+	for _, photo := range photos {
+		check.referenced[photo.PathToPhoto] = true
+		check.referenced[photo.PathToThumbnail] = true
+		check.referenced[photo.PathToPreview] = true
+	}
+	derivativesChecked := map[string]bool{}
+	for _, photo := range photos {
+		if !eventIDs[photo.EventID] {
+			if err = check.relocatePhoto(ctx, photo); err != nil {
+				return nil, err
+			}
+		}
+		if photo.CreationDate.After(check.before) {
+			continue
+		}
+		sound, err := check.checkOriginal(ctx, &photo)
+		if err != nil {
+			return nil, err
+		}
+		if sound && !derivativesChecked[photo.PathToThumbnail] {
+			derivativesChecked[photo.PathToThumbnail] = true
+			if err = check.checkDerivatives(ctx, photo); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	orphans := make([]string, 0, len(check.objects))
+	for key, info := range check.objects {
+		if !check.referenced[key] && info.ModTime.Before(check.before) {
+			orphans = append(orphans, key)
+		}
+	}
+	sort.Strings(orphans)
+	for _, key := range orphans {
+		info := check.objects[key]
+		problem := StorageProblem{Kind: problemOrphanFile, Key: key, Detail: fmt.Sprintf("%d octets, aucune photo ne l'utilise", info.Size)}
+		if repair {
+			if err = check.quarantine(ctx, key); err != nil {
+				return nil, err
+			}
+			problem.Repair = "mis en quarantaine"
+		}
+		check.problems = append(check.problems, problem)
+	}
+	return check.problems, nil
+}
+
+// checkOriginal checks that the original of a photo is stored with the content of its hash, and reports whether it
+// is sound. A missing original is re-linked to an orphan file of the same content when repairing.
+func (check *storageCheck) checkOriginal(ctx context.Context, photo *query.Photo) (bool, error) {
+	info, ok := check.objects[photo.PathToPhoto]
+	if !ok {
+		problem := StorageProblem{Kind: problemMissingFile, Key: photo.PathToPhoto, PhotoID: photo.PhotoID, Detail: "l'original n'est plus dans le stockage"}
+		if !check.repair {
+			check.problems = append(check.problems, problem)
+			return false, nil
+		}
+		// The photos sharing the missing original are re-linked to the same file
+		key, ok := check.relinked[photo.PathToPhoto]
+		if !ok {
+			key = check.findOriginal(photo.PhotoHash)
+		}
+		if key != "" {
+			if err := check.cfg.DB.UpdatePhotoPath(ctx, query.UpdatePhotoPathParams{PathToPhoto: key, PhotoID: photo.PhotoID}); err != nil {
+				return false, err
+			}
+			check.referenced[key] = true
+			check.relinked[photo.PathToPhoto] = key
+			photo.PathToPhoto = key
+			problem.Repair = fmt.Sprintf("relié à %s", key)
+			check.problems = append(check.problems, problem)
+			return check.checkOriginal(ctx, photo)
+		}
+		if err := check.hidePhoto(ctx, *photo, &problem); err != nil {
+			return false, err
+		}
+		check.problems = append(check.problems, problem)
+		return false, nil
+	}
+
+	detail, verified := check.verified[photo.PathToPhoto]
+	if !verified {
+		switch {
+		case info.Size == 0:
+			detail = "fichier vide"
+		case check.checksums:
+			hash, err := check.hashObject(ctx, photo.PathToPhoto)
+			if err != nil {
+				return false, err
+			}
+			if hash != photo.PhotoHash {
+				detail = fmt.Sprintf("somme de contrôle %s au lieu de %s", hash, photo.PhotoHash)
+			}
+		}
+		check.verified[photo.PathToPhoto] = detail
+	}
+	if detail == "" {
+		return true, nil
+	}
+	problem := StorageProblem{Kind: problemCorruptedFile, Key: photo.PathToPhoto, PhotoID: photo.PhotoID, Detail: detail}
+	if check.repair {
+		// The file is only moved once, the other photos sharing it are hidden like the first one
+		if !verified {
+			if err := check.quarantine(ctx, photo.PathToPhoto); err != nil {
+				return false, err
+			}
+		}
+		if err := check.hidePhoto(ctx, *photo, &problem); err != nil {
+			return false, err
+		}
+	}
+	check.problems = append(check.problems, problem)
+	return false, nil
+}
+
+// checkDerivatives checks that the thumbnail and the preview of a photo are stored. Missing or empty derivatives
+// are generated again from the original by a job when repairing.
+func (check *storageCheck) checkDerivatives(ctx context.Context, photo query.Photo) error {
+	var missing []string
+	for _, key := range []string{photo.PathToThumbnail, photo.PathToPreview} {
+		if info, ok := check.objects[key]; !ok || info.Size == 0 {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	problem := StorageProblem{Kind: problemMissingDerivative, Key: strings.Join(missing, ", "), PhotoID: photo.PhotoID, Detail: "miniature ou aperçu absent ou vide"}
+	if check.repair {
+		// Empty derivatives would be kept by the job, which does not replace existing files
+		for _, key := range missing {
+			if err := check.cfg.Storage.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		if err := jobs.Enqueue(ctx, check.cfg.DB.Queries, jobDerivatives, photoJob{PhotoID: photo.PhotoID, PhotoHash: photo.PhotoHash}); err != nil {
+			return err
+		}
+		check.cfg.Jobs.Wake()
+		problem.Repair = "régénération programmée"
+	}
+	check.problems = append(check.problems, problem)
+	return nil
+}
+
+// relocatePhoto reports a photo whose event no longer exists, and moves it to the event of the lost photos when
+// repairing. Photos whose content is already in that event are hidden instead.
+func (check *storageCheck) relocatePhoto(ctx context.Context, photo query.Photo) error {
+	problem := StorageProblem{Kind: problemMissingEvent, Key: photo.PathToPhoto, PhotoID: photo.PhotoID, Detail: fmt.Sprintf("l'événement %d n'existe plus", photo.EventID)}
+	if !check.repair {
+		check.problems = append(check.problems, problem)
+		return nil
+	}
+	event, err := check.lostEvent(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = check.cfg.DB.GetPhotoByEventIDAndHash(ctx, query.GetPhotoByEventIDAndHashParams{EventID: event.EventID, PhotoHash: photo.PhotoHash})
+	switch {
+	case err == nil:
+		err = check.hidePhoto(ctx, photo, &problem)
+	case errors.Is(err, sql.ErrNoRows):
+		err = check.cfg.DB.UpdatePhotoEvent(ctx, query.UpdatePhotoEventParams{EventID: event.EventID, PhotoID: photo.PhotoID})
+		problem.Repair = fmt.Sprintf("déplacée dans « %s »", lostEventName)
+	}
+	if err != nil {
+		return err
+	}
+	check.problems = append(check.problems, problem)
+	return nil
+}
+
+// lostEvent returns the top-level event of the lost photos, created the first time it is needed.
+func (check *storageCheck) lostEvent(ctx context.Context) (query.Event, error) {
+	params := query.GetEventByNameAndParentIDParams{Name: lostEventName}
+	event, err := check.cfg.DB.GetEventByNameAndParentID(ctx, params)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return event, err
+	}
+	err = check.cfg.DB.CreateEvent(ctx, query.CreateEventParams{
+		Name:        lostEventName,
+		Description: "Photos dont l'événement a été supprimé, retrouvées par la vérification du stockage.",
+		EventDate:   time.Now(),
+	})
+	if err != nil {
+		return query.Event{}, err
+	}
+	return check.cfg.DB.GetEventByNameAndParentID(ctx, params)
+}
+
+// findOriginal returns an unused file of the storage holding the original of a content hash, or an empty key.
+// Originals are named after their hash, only their extension may differ from the key of the photo.
+func (check *storageCheck) findOriginal(hash string) string {
+	for _, format := range []string{"jpeg", "png", "gif", "webp"} {
+		key := contentKey("", hash, imaging.Extension(format))
+		if _, ok := check.objects[key]; ok && !check.referenced[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+// hidePhoto hides a photo that cannot be displayed any more, and records it as the repair of a problem.
+func (check *storageCheck) hidePhoto(ctx context.Context, photo query.Photo, problem *StorageProblem) error {
+	problem.Repair = "photo masquée"
+	if photo.IsHidden {
+		return nil
+	}
+	return check.cfg.DB.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: true, PhotoID: photo.PhotoID})
+}
+
+// quarantine moves a file of the storage under the quarantine prefix, keeping its key below it.
+func (check *storageCheck) quarantine(ctx context.Context, key string) error {
+	file, err := check.cfg.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = check.cfg.Storage.Put(ctx, path.Join(quarantineDir, key), file, check.objects[key].Size); err != nil {
+		return err
+	}
+	return check.cfg.Storage.Delete(ctx, key)
+}
+
+// hashObject returns the hex-encoded SHA-256 digest of a file of the storage.
+func (check *storageCheck) hashObject(ctx context.Context, key string) (string, error) {
+	file, err := check.cfg.Storage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// ServeStorageCheckHandler lists the problems of the storage found without verifying the checksums, which is left
+// to the photos_fsck command since every original is read.
+func (cfg Config) ServeStorageCheckHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.renderStorageCheck(w, r, false)
+}
+
+// RepairStorageHandler repairs the problems of the storage found without verifying the checksums, and lists them
+// with the repairs applied.
+func (cfg Config) RepairStorageHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.renderStorageCheck(w, r, true)
+}
+
+// renderStorageCheck runs the storage check and renders its problems.
+func (cfg Config) renderStorageCheck(w http.ResponseWriter, r *http.Request, repair bool) {
+	problems, err := cfg.CheckStorage(r.Context(), false, repair)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Storage check failed: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "storage_check.html", map[string]interface{}{
+		"Problems":        problems,
+		"Repaired":        repair,
+		"ProblemLabels":   problemLabels,
+		"StorageCheckURL": cfg.Routes.StorageCheck,
+		"DashboardURL":    cfg.Routes.Dashboard,
+		"CSRF_TOKEN":      csrf.Token(r),
+	})
+}
@@ -10,6 +10,14 @@ import (
 
 type Config config.Config
 
+// fileResult is the outcome of an operation on one file or photo of a batch, listed on the results page.
+type fileResult struct {
+	PhotoID uint32 `json:"photo_id,omitempty"` // ID of the photo, for operations on existing photos.
+	Name    string `json:"name"`               // Name of the file or photo.
+	Status  string `json:"status"`             // Outcome of the operation.
+	Reason  string `json:"reason,omitempty"`   // Details on the outcome, if any.
+}
+
 func RespondWithMessage(w http.ResponseWriter, error string, status int) {
 	if status >= 500 {
 		log.Printf("5xx error: %s", error)
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"photos/internal/jobs"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/csrf"
+)
+
+// Uploads only store the original of the photos, the rest of their processing is left to background jobs so that
+// requests end quickly whatever the size of the photos.
+
+// Kinds of the jobs processing the uploaded photos.
+const (
+	jobDerivatives    = "derivatives"     // Generates the thumbnail and the preview, then enqueues the hashing.
+	jobMetadata       = "metadata"        // Extracts the metadata of the original.
+	jobPerceptualHash = "perceptual_hash" // Computes the perceptual hash from the thumbnail.
+)
+
+// jobStatusLabels are the labels of the statuses of the jobs.
+var jobStatusLabels = map[query.JobsStatus]string{
+	query.JobsStatusPending:   "En attente",
+	query.JobsStatusRunning:   "En cours",
+	query.JobsStatusSucceeded: "Terminée",
+	query.JobsStatusFailed:    "Échouée",
+}
+
+// photoJob is the payload of the jobs processing a photo. The jobs processing the stored files, which photos with
+// the same content share, also carry the hash of the content.
+type photoJob struct {
+	PhotoID   uint32 `json:"photo_id"`
+	PhotoHash string `json:"photo_hash,omitempty"`
+}
+
+// StartJobs registers the handlers of the background jobs and starts their workers.
+func (cfg Config) StartJobs() {
+	cfg.Jobs.Register(jobDerivatives, cfg.photoJobHandler(cfg.generateDerivatives))
+	cfg.Jobs.Register(jobMetadata, cfg.photoJobHandler(cfg.extractMetadata))
+	cfg.Jobs.Register(jobPerceptualHash, cfg.photoJobHandler(cfg.hashStoredPhoto))
+	cfg.Jobs.Start()
+}
+
+// photoJobHandler returns the handler of the jobs processing a photo. Jobs processing stored files go on with
+// another photo of the same content when theirs was deleted since they were enqueued, the other photos have nothing
+// left to process.
+func (cfg Config) photoJobHandler(process func(ctx context.Context, photo query.Photo) error) jobs.Handler {
+	return func(ctx context.Context, payload []byte) error {
+		var job photoJob
+		if err := json.Unmarshal(payload, &job); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid payload: %w", err))
+		}
+		photo, err := cfg.DB.GetPhoto(ctx, job.PhotoID)
+		if errors.Is(err, sql.ErrNoRows) && job.PhotoHash != "" {
+			photo, err = cfg.DB.GetPhotoByHash(ctx, job.PhotoHash)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return process(ctx, photo)
+	}
+}
+
+// ServeJobsHandler lists the number of jobs of each status, followed by the latest jobs, optionally of the status
+// of the "status" parameter.
+func (cfg Config) ServeJobsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var status query.NullJobsStatus
+	if value := query.JobsStatus(r.FormValue("status")); value != "" {
+		if _, ok := jobStatusLabels[value]; !ok {
+			RespondWithMessage(w, fmt.Sprintf("Unknown status %q", value), http.StatusBadRequest)
+			return
+		}
+		status = query.NullJobsStatus{JobsStatus: value, Valid: true}
+	}
+	counts, err := cfg.DB.CountJobsByStatus(ctx)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	latest, err := cfg.DB.GetJobs(ctx, query.GetJobsParams{Status: status, Limit: cfg.Jobs.HistoryLength})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "jobs.html", map[string]interface{}{
+		"Counts":       counts,
+		"Jobs":         latest,
+		"Status":       status.JobsStatus,
+		"StatusLabels": jobStatusLabels,
+		"JobsURL":      cfg.Routes.Jobs,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	})
+}
+
+// RequeueJobHandler gives the failed job of job_id a new set of attempts, once the cause of its failure is fixed.
+func (cfg Config) RequeueJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.Atoi(r.FormValue("job_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse job_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.RequeueFailedJob(r.Context(), query.RequeueFailedJobParams{RunAfter: time.Now(), JobID: uint32(jobID)})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cfg.Jobs.Wake()
+	http.Redirect(w, r, cfg.Routes.Jobs, http.StatusSeeOther)
+}
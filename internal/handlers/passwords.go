@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"photos/internal/password"
+	"strconv"
+
+	"github.com/gorilla/csrf"
+)
+
+// Events can be protected by a password, which also protects their sub-events. Users unlock an event by entering
+// its password, and the unlock is remembered in a signed cookie for the time set in the configuration.
+// Admins are never asked for passwords.
+
+// eventUnlock is the content of the cookie remembering that a user unlocked an event.
+type eventUnlock struct {
+	UserID   uint32
+	Password string // Fingerprint of the password hash, so that changing the password locks the event again.
+}
+
+// SetEventPasswordHandler protects an event with a password, or removes its password when "remove" is set.
+func (cfg Config) SetEventPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	eventID, err := strconv.Atoi(r.FormValue("event_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse event_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash sql.NullString
+	if r.FormValue("remove") == "" {
+		if r.FormValue("password") == "" {
+			RespondWithMessage(w, "The password cannot be empty", http.StatusBadRequest)
+			return
+		}
+		passwordHash.String, err = password.Hash(r.FormValue("password"))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Failed to hash password: %s", err), http.StatusInternalServerError)
+			return
+		}
+		passwordHash.Valid = true
+	}
+	err = cfg.DB.UpdateEventPassword(r.Context(), query.UpdateEventPasswordParams{
+		PasswordHash: passwordHash,
+		EventID:      uint32(eventID),
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, eventID), http.StatusSeeOther)
+}
+
+// UnlockEventHandler checks the password entered for an event and remembers the unlock in a cookie.
+// The user is then sent to next_event_id, the event they asked for, which can be a sub-event of the unlocked one.
+func (cfg Config) UnlockEventHandler(w http.ResponseWriter, r *http.Request) {
+	userInfo := r.Context().Value("userInfo").(query.User)
+	eventID, err := strconv.Atoi(r.FormValue("event_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse event_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	nextEventID, err := strconv.Atoi(r.FormValue("next_event_id"))
+	if err != nil {
+		nextEventID = eventID
+	}
+	events, err := cfg.DB.GetEventByID(r.Context(), uint32(eventID))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		RespondWithMessage(w, "event_id does not correspond to any existing event", http.StatusNotFound)
+		return
+	}
+	event := events[0]
+	nextURL := fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, nextEventID)
+	if !event.PasswordHash.Valid {
+		http.Redirect(w, r, nextURL, http.StatusSeeOther)
+		return
+	}
+
+	ok, err := password.Verify(r.FormValue("password"), event.PasswordHash.String)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to check password of event %d: %s", eventID, err), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		cfg.renderUnlock(w, r, event, uint32(nextEventID), "Mot de passe incorrect.", http.StatusForbidden)
+		return
+	}
+
+	name := unlockCookieName(cfg.Security.EventUnlock.CookieName, event.EventID)
+	encoded, err := cfg.Security.EventUnlock.SecureCookie.Encode(name, eventUnlock{
+		UserID:   userInfo.UserID,
+		Password: passwordFingerprint(event.PasswordHash.String),
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to unlock event: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		MaxAge:   int(cfg.Security.EventUnlock.CookieMaxAge.Seconds()),
+		Secure:   cfg.Security.EventUnlock.CookieSecure,
+		HttpOnly: cfg.Security.EventUnlock.CookieHTTPOnly,
+		SameSite: cfg.Security.EventUnlock.CookieSameSite,
+		Value:    encoded,
+		Path:     "/",
+	})
+	http.Redirect(w, r, nextURL, http.StatusSeeOther)
+}
+
+// renderUnlock prompts for the password of a protected event before showing nextEventID.
+func (cfg Config) renderUnlock(w http.ResponseWriter, r *http.Request, event query.Event, nextEventID uint32, message string, status int) {
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	err := cfg.Templates.ExecuteTemplate(w, "unlock.html", map[string]interface{}{
+		"Event":        event,
+		"NextEventID":  nextEventID,
+		"Message":      message,
+		"UnlockURL":    cfg.Routes.EventUnlock,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	})
+	if err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// lockedEvent returns the protected event whose password the user must enter before accessing eventID:
+// the event itself or one of its ancestors, outermost first. ok is false when nothing is left to unlock.
+func (cfg Config) lockedEvent(r *http.Request, eventID uint32) (locked query.Event, ok bool, err error) {
+	userInfo, _ := r.Context().Value("userInfo").(query.User)
+	if userInfo.IsAdmin {
+		return query.Event{}, false, nil
+	}
+
+	events, err := cfg.DB.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		return query.Event{}, false, err
+	}
+	ancestors, err := cfg.DB.GetEventAncestors(r.Context(), eventID)
+	if err != nil {
+		return query.Event{}, false, err
+	}
+	for _, event := range append(ancestors, events...) {
+		if event.PasswordHash.Valid && !cfg.isUnlocked(r, event, userInfo.UserID) {
+			return event, true, nil
+		}
+	}
+	return query.Event{}, false, nil
+}
+
+// respondWithLockError answers requests for a protected event that was not unlocked, or whose check failed.
+func respondWithLockError(w http.ResponseWriter, err error) {
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	RespondWithMessage(w, "The event is protected by a password", http.StatusForbidden)
+}
+
+// isUnlocked reports whether the request carries a valid unlock cookie of the user for the current password of event.
+func (cfg Config) isUnlocked(r *http.Request, event query.Event, userID uint32) bool {
+	name := unlockCookieName(cfg.Security.EventUnlock.CookieName, event.EventID)
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	var unlock eventUnlock
+	if err = cfg.Security.EventUnlock.SecureCookie.Decode(name, cookie.Value, &unlock); err != nil {
+		return false
+	}
+	return unlock.UserID == userID && unlock.Password == passwordFingerprint(event.PasswordHash.String)
+}
+
+// unlockCookieName returns the name of the cookie remembering the unlock of an event.
+func unlockCookieName(prefix string, eventID uint32) string {
+	return fmt.Sprintf("%s_%d", prefix, eventID)
+}
+
+// passwordFingerprint identifies a password hash without revealing it in cookies.
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:16])
+}
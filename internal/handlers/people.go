@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"photos/internal/tags"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/csrf"
+)
+
+// Users mark the registered users appearing in the photos they can see, optionally with the box around them.
+// Boxes are stored as fractions of the width and height of the image, so that they fit every size of the photo.
+// Anyone can remove a mark of themselves, as can the user who made it and admins.
+
+// PhotoPeopleHandler lists the users appearing in a photo, with a form to add one.
+func (cfg Config) PhotoPeopleHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	cfg.renderPhotoPeople(w, r, photo)
+}
+
+// TagPersonHandler marks the user of user_id as appearing in a photo. The box_x, box_y, box_width and box_height
+// fields optionally locate them in the image. Marking the same user again replaces their box.
+func (cfg Config) TagPersonHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse user_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	if _, err = cfg.DB.GetUser(ctx, uint32(userID)); err != nil {
+		RespondWithMessage(w, "user_id does not correspond to any existing user", http.StatusNotFound)
+		return
+	}
+	box, err := parseBox(r)
+	if err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.TagUserInPhoto(ctx, query.TagUserInPhotoParams{
+		BoxX:      box[0],
+		BoxY:      box[1],
+		BoxWidth:  box[2],
+		BoxHeight: box[3],
+		UserID:    uint32(userID),
+		PhotoID:   photo.PhotoID,
+		TaggedBy:  userInfo.UserID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cfg.respondWithPhotoPeople(w, r, photo)
+}
+
+// UntagPersonHandler removes the mark of the user of user_id from a photo. Users can remove the marks of
+// themselves and the ones they made, admins any of them.
+func (cfg Config) UntagPersonHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse user_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	people, err := cfg.DB.GetRecognizedUsersByPhotoID(ctx, photo.PhotoID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	for _, person := range people {
+		if person.UserID != uint32(userID) {
+			continue
+		}
+		if !userInfo.IsAdmin && person.UserID != userInfo.UserID && person.TaggedBy != userInfo.UserID {
+			RespondWithMessage(w, "Only the user, the user who marked them and admins can remove a mark", http.StatusForbidden)
+			return
+		}
+		err = cfg.DB.RemoveRecognizedUser(ctx, query.RemoveRecognizedUserParams{PhotoID: photo.PhotoID, UserID: person.UserID})
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if r.FormValue("next") == "me" {
+		http.Redirect(w, r, cfg.Routes.MyPhotos, http.StatusSeeOther)
+		return
+	}
+	cfg.respondWithPhotoPeople(w, r, photo)
+}
+
+// UserSuggestionsHandler suggests the users whose name or email address contain the "q" parameter.
+func (cfg Config) UserSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var users []query.User
+	if search := strings.TrimSpace(r.FormValue("q")); search != "" {
+		var err error
+		users, err = cfg.DB.SearchUsers(r.Context(), "%"+tags.LikePrefix(search))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	renderTemplate(w, cfg.Templates, "user_suggestions.html", map[string]interface{}{"Users": users})
+}
+
+// ServeMyPhotosHandler lists the photos the user appears in, across every event they can see.
+func (cfg Config) ServeMyPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photos, err := cfg.DB.GetPhotosOfUser(ctx, query.GetPhotosOfUserParams{UserID: userInfo.UserID, IncludeHidden: userInfo.IsAdmin})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if photos, err = cfg.unlockedPhotos(r, photos); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "my_photos.html", map[string]interface{}{
+		"Photos":         photos,
+		"UserInfo":       userInfo,
+		"PhotoPeopleURL": cfg.Routes.PhotoPeople,
+		"EventURL":       cfg.Routes.Event,
+		"DashboardURL":   cfg.Routes.Dashboard,
+		"CSRF_TOKEN":     csrf.Token(r),
+	})
+}
+
+// respondWithPhotoPeople answers a change of the users appearing in a photo: htmx requests get the updated list,
+// others are sent back to the event of the photo.
+func (cfg Config) respondWithPhotoPeople(w http.ResponseWriter, r *http.Request, photo query.Photo) {
+	if r.Header.Get("HX-Request") == "" {
+		http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+		return
+	}
+	cfg.renderPhotoPeople(w, r, photo)
+}
+
+// renderPhotoPeople renders the users appearing in a photo.
+func (cfg Config) renderPhotoPeople(w http.ResponseWriter, r *http.Request, photo query.Photo) {
+	people, err := cfg.DB.GetRecognizedUsersByPhotoID(r.Context(), photo.PhotoID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "photo_people.html", map[string]interface{}{
+		"Photo":              photo,
+		"People":             people,
+		"UserInfo":           r.Context().Value("userInfo").(query.User),
+		"PhotoPeopleURL":     cfg.Routes.PhotoPeople,
+		"UserSuggestionsURL": cfg.Routes.UserSuggestions,
+		"CSRF_TOKEN":         csrf.Token(r),
+	})
+}
+
+// parseBox reads the optional box of a mark from the box_x, box_y, box_width and box_height fields.
+// Either all of them are set, to fractions of the image that keep the box inside it, or none is.
+func parseBox(r *http.Request) ([4]sql.NullFloat64, error) {
+	var box [4]sql.NullFloat64
+	fields := [4]string{"box_x", "box_y", "box_width", "box_height"}
+	set := 0
+	for i, field := range fields {
+		value := r.FormValue(field)
+		if value == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || f > 1 {
+			return box, fmt.Errorf("%s must be a fraction of the image between 0 and 1", field)
+		}
+		box[i] = sql.NullFloat64{Float64: f, Valid: true}
+		set++
+	}
+	if set != 0 && set != len(fields) {
+		return box, fmt.Errorf("a box needs all of %s", strings.Join(fields[:], ", "))
+	}
+	if set != 0 && (box[0].Float64+box[2].Float64 > 1 || box[1].Float64+box[3].Float64 > 1) {
+		return box, fmt.Errorf("the box must be inside the image")
+	}
+	return box, nil
+}
@@ -1,17 +1,41 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 	"photos/internal/db/query"
+	"photos/internal/filename"
+	"photos/internal/imaging"
+	"photos/internal/jobs"
+	"photos/internal/metadata"
+	"photos/internal/storage"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	thumbnailsDir = "thumbnails" // Prefix of the storage keys of thumbnails.
+	previewsDir   = "previews"   // Prefix of the storage keys of previews.
+)
+
+// Statuses of the files of an upload.
+const (
+	resultAdded     = "ajoutée"
+	resultDuplicate = "doublon"
+	resultRejected  = "refusée"
+)
+
 func (cfg Config) ServePhotosPage(w http.ResponseWriter, r *http.Request) {
 	eventID, err := strconv.Atoi(r.URL.Query().Get("event_id"))
 	if err != nil {
@@ -32,10 +56,17 @@ func (cfg Config) ServePhotosPage(w http.ResponseWriter, r *http.Request) {
 		limit = 20
 	}
 
+	if _, isLocked, err := cfg.lockedEvent(r, uint32(eventID)); err != nil || isLocked {
+		respondWithLockError(w, err)
+		return
+	}
+
+	userInfo := r.Context().Value("userInfo").(query.User)
 	photos, err := cfg.DB.DB.GetPhotosByEventIDWithPagination(context.Background(), query.GetPhotosByEventIDWithPaginationParams{
-		EventID: uint32(eventID),
-		Limit:   int32(limit),
-		Offset:  int32(offset),
+		EventID:       uint32(eventID),
+		IncludeHidden: userInfo.IsAdmin,
+		Limit:         int32(limit),
+		Offset:        int32(offset),
 	})
 	if err != nil {
 		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
@@ -51,6 +82,7 @@ func (cfg Config) ServePhotosPage(w http.ResponseWriter, r *http.Request) {
 		"EventID":    eventID,
 		"NextOffset": offset + limit, // Calculate the next offset
 		"Limit":      limit,          // Keep the same limit
+		"IsAdmin":    userInfo.IsAdmin,
 	}
 
 	err = cfg.Templates.ExecuteTemplate(w, "photos.html", data)
@@ -59,26 +91,156 @@ func (cfg Config) ServePhotosPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// PhotoHandler serves one of the image files of a photo. The "size" query parameter selects
+// the thumbnail, the preview or the original, and "download" asks the browser to save the file.
+// Originals are stripped of the metadata selected by the policy of their event.
+// Hidden and deleted photos are only served to admins. Requests without a session must use
+// a signed URL that has not expired, as built by the photoURL function of the templates.
+// The event of the photo must have been unlocked by the session if it is protected by a password.
 func (cfg Config) PhotoHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the "path" query parameter
-	photoPath := r.URL.Path[len("/photos_dir/"):]
-	if photoPath == "" {
-		http.Error(w, "Missing 'path' query parameter", http.StatusBadRequest)
+	cfg.servePhoto(w, r, false)
+}
+
+// OriginalPhotoHandler serves the original file of a photo exactly as it was uploaded, metadata included.
+// It is restricted to admins.
+func (cfg Config) OriginalPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.servePhoto(w, r, true)
+}
+
+// servePhoto looks up the photo requested by the query parameters and writes the selected file.
+// When raw is set the original is always served, untouched.
+func (cfg Config) servePhoto(w http.ResponseWriter, r *http.Request, raw bool) {
+	ctx := r.Context()
+	userInfo, authenticated := ctx.Value("userInfo").(query.User)
+	if !authenticated {
+		if err := cfg.Security.PhotoURL.Verify(r.URL, time.Now()); err != nil {
+			RespondWithMessage(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	photoID, err := strconv.Atoi(r.URL.Query().Get("photo_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse photo_id param: %s", err), http.StatusBadRequest)
 		return
 	}
-	// Build the full path to the photo
-	fullPath := filepath.Join(cfg.PhotosDir, photoPath)
+	variant := imaging.VariantOriginal
+	if !raw {
+		variant, err = imaging.ParseVariant(r.URL.Query().Get("size"))
+		if err != nil {
+			RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	// Check if the file exists and is not a directory
-	info, err := os.Stat(fullPath)
-	if os.IsNotExist(err) || info.IsDir() {
-		RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
+	photo, err := cfg.DB.GetPhoto(ctx, uint32(photoID))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !userInfo.IsAdmin && (photo.IsHidden || photo.DeletionDate.Valid)) {
+		RespondWithMessage(w, "photo_id does not correspond to any existing photo", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	// Unlocks are bound to sessions, so signed URLs forwarded to others never serve the photos of protected events
+	if _, isLocked, err := cfg.lockedEvent(r, photo.EventID); err != nil || isLocked {
+		respondWithLockError(w, err)
 		return
 	}
 
-	// Serve the file
-	http.ServeFile(w, r, fullPath)
+	var key string
+	switch variant {
+	case imaging.VariantThumbnail:
+		key = photo.PathToThumbnail
+	case imaging.VariantPreview:
+		key = photo.PathToPreview
+	default:
+		key = photo.PathToPhoto
+	}
+
+	// Thumbnails and previews are encoded without metadata
+	policy := metadata.StripNone
+	if variant == imaging.VariantOriginal && !raw {
+		policy, err = cfg.eventMetadataPolicy(ctx, photo.EventID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Files are named after the hash of the photo, so the hash identifies the content sent. URLs versioned with it
+	// never change, except for stripped originals whose event policy can, which are revalidated with their ETag.
+	etag := fmt.Sprintf(`"%s-%s-%s"`, photo.PhotoHash, variant, policy)
+	w.Header().Set("ETag", etag)
+	if r.URL.Query().Get("v") == photo.PhotoHash && (variant != imaging.VariantOriginal || raw) {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	info, err := cfg.Storage.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotExist) && variant != imaging.VariantOriginal {
+		// Derivatives are generated by a background job shortly after the upload, this answer must not be cached
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Retry-After", "5")
+		RespondWithMessage(w, "The photo is still being processed", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("photo file %s is missing: %s", key, err), http.StatusInternalServerError)
+		return
+	}
+	file, err := cfg.Storage.Get(ctx, key)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to open photo file: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	if raw || r.URL.Query().Get("download") != "" {
+		// Originals are downloaded under the name they were uploaded with, which was sanitized on upload
+		name := path.Base(key)
+		if variant == imaging.VariantOriginal && photo.OriginalFilename != "" {
+			name = photo.OriginalFilename
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+
+	// ServeContent answers Range and If-Range requests from the ETag
+	if policy == metadata.StripNone {
+		http.ServeContent(w, r, key, info.ModTime, file)
+		return
+	}
+
+	// The stored original is left untouched, a sanitized copy is built for this response
+	var sanitized bytes.Buffer
+	err = metadata.Strip(&sanitized, file, policy)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to strip photo metadata: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, key, info.ModTime, bytes.NewReader(sanitized.Bytes()))
 }
+
+// etagMatches reports whether an If-None-Match header lists etag, with the weak comparison it requires.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func (cfg Config) UploadPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	if err := r.ParseMultipartForm(cfg.Server.MaxBodySize); err != nil { // 100 MB limit
@@ -99,6 +261,10 @@ func (cfg Config) UploadPhotosHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid Event ID", http.StatusBadRequest)
 		return
 	}
+	if _, isLocked, err := cfg.lockedEvent(r, uint32(eventID)); err != nil || isLocked {
+		respondWithLockError(w, err)
+		return
+	}
 
 	// Get the uploaded files
 	files := r.MultipartForm.File["photos"]
@@ -108,62 +274,294 @@ func (cfg Config) UploadPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Start a transaction
-	tx, err := cfg.DB.Begin()
+	tx, err := cfg.DB.BeginTx(ctx, nil)
 	if err != nil {
 		http.Error(w, "Failed to start database transaction", http.StatusInternalServerError)
 		return
 	}
+	qtx := cfg.DB.WithTx(tx)
 
 	// Rollback on failure
 	defer func() {
 		if p := recover(); p != nil {
-			tx.Rollback()
+			_ = tx.Rollback()
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 		}
 	}()
 
 	// Process each uploaded file
+	results := make([]fileResult, 0, len(files))
 	for _, fileHeader := range files {
-		// Open the uploaded file
-		file, err := fileHeader.Open()
+		result, err := cfg.storeMultipartPhoto(ctx, qtx, uint32(eventID), fileHeader)
 		if err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to open uploaded file", http.StatusInternalServerError)
+			_ = tx.Rollback()
+			RespondWithMessage(w, fmt.Sprintf("Failed to save %s: %v", fileHeader.Filename, err), http.StatusInternalServerError)
 			return
 		}
-		defer file.Close()
+		results = append(results, result)
+	}
 
-		// Generate a unique file name
-		fileName := fmt.Sprintf("%d_%s", time.Now().UnixNano(), fileHeader.Filename)
-		filePath := filepath.Join(cfg.PhotosDir, fileName)
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit database transaction", http.StatusInternalServerError)
+		return
+	}
+	cfg.Jobs.Wake()
 
-		// Save the file to the configured directory
-		outFile, err := os.Create(filePath)
-		if err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to save file", http.StatusInternalServerError)
-			return
+	renderTemplate(w, cfg.Templates, "results.html", map[string]interface{}{
+		"Title":   "Résultat de l'envoi",
+		"BackURL": fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, eventID),
+		"Results": results,
+	})
+}
+
+// storeMultipartPhoto adds a file of a multipart form to an event.
+func (cfg Config) storeMultipartPhoto(ctx context.Context, qtx *query.Queries, eventID uint32, fileHeader *multipart.FileHeader) (fileResult, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return fileResult{}, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+	return cfg.storeUploadedPhoto(ctx, qtx, eventID, filename.Sanitize(fileHeader.Filename), file, fileHeader.Size)
+}
+
+// ImportPhoto adds a photo read from a file to an event in its own transaction, like an upload of the browser form.
+// It reports whether the photo was added, and otherwise the reason why it was not: duplicates and files that are
+// not valid photos. It is used by the importer of directory trees.
+func (cfg Config) ImportPhoto(ctx context.Context, eventID uint32, name string, file io.ReadSeeker, size int64) (bool, string, error) {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, "", err
+	}
+	defer tx.Rollback()
+	result, err := cfg.storeUploadedPhoto(ctx, cfg.DB.WithTx(tx), eventID, filename.Sanitize(name), file, size)
+	if err != nil {
+		return false, "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, "", err
+	}
+	if result.Status != resultAdded {
+		return false, fmt.Sprintf("%s: %s", result.Status, result.Reason), nil
+	}
+	return true, result.Reason, nil
+}
+
+// storeUploadedPhoto adds an uploaded file to an event. Files are stored by the SHA-256 digest of their content:
+// a file already present in the event is reported as a duplicate, and a file already present in another
+// event gets a new row reusing the stored files. Files that are not valid photos are rejected with the reason
+// in the result, only failures of the server return an error. The rest of the processing is left to jobs enqueued
+// in qtx, callers should wake the workers up once it is committed.
+func (cfg Config) storeUploadedPhoto(ctx context.Context, qtx *query.Queries, eventID uint32, name string, file io.ReadSeeker, size int64) (fileResult, error) {
+	if size > cfg.Uploads.MaxSize {
+		return rejected(name, fmt.Sprintf("fichier trop volumineux (maximum %d Mo)", cfg.Uploads.MaxSize>>20)), nil
+	}
+	hash, err := hashFile(file)
+	if err != nil {
+		return fileResult{}, err
+	}
+	duplicate, err := qtx.GetPhotoByEventIDAndHash(ctx, query.GetPhotoByEventIDAndHashParams{EventID: eventID, PhotoHash: hash})
+	if err == nil && duplicate.DeletionDate.Valid {
+		// Uploading a deleted photo again takes it out of the trash
+		if err = qtx.RestorePhoto(ctx, duplicate.PhotoID); err != nil {
+			return fileResult{}, err
 		}
-		defer outFile.Close()
+		return fileResult{Name: name, Status: resultAdded, Reason: "restaurée depuis la corbeille"}, nil
+	}
+	if err == nil {
+		return fileResult{Name: name, Status: resultDuplicate, Reason: fmt.Sprintf("identique à la photo %d", duplicate.PhotoID)}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fileResult{}, err
+	}
+
+	// The file is decoded whatever its name claims, so that files that are not photos, or truncated ones, are
+	// rejected right away rather than failing the job generating the derivatives
+	_, format, err := imaging.DecodeLimited(file, cfg.Uploads.MaxPixels)
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return rejected(name, "format non autorisé (JPEG, PNG, GIF ou WebP uniquement)"), nil
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		return rejected(name, fmt.Sprintf("image trop grande (maximum %d mégapixels)", cfg.Uploads.MaxPixels/1_000_000)), nil
+	case err != nil:
+		return rejected(name, "image illisible ou corrompue"), nil
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return fileResult{}, fmt.Errorf("failed to rewind photo file: %w", err)
+	}
+
+	// The photo reusing the stored files is locked until the commit, so that purging it waits for the new photo
+	params := query.CreatePhotoParams{PhotoHash: hash, OriginalFilename: name, EventID: eventID}
+	existing, err := qtx.GetPhotoByHash(ctx, hash)
+	switch {
+	case err == nil:
+		params.PathToPhoto = existing.PathToPhoto
+		params.PathToThumbnail = existing.PathToThumbnail
+		params.PathToPreview = existing.PathToPreview
+	case errors.Is(err, sql.ErrNoRows):
+		params.PathToPhoto = contentKey("", hash, imaging.Extension(format))
+		params.PathToThumbnail = contentKey(thumbnailsDir, hash, ".jpg")
+		params.PathToPreview = contentKey(previewsDir, hash, ".jpg")
+		if err = cfg.storeFile(ctx, params.PathToPhoto, file, size); err != nil {
+			return fileResult{}, err
+		}
+	default:
+		return fileResult{}, err
+	}
+
+	photoID, err := qtx.CreatePhoto(ctx, params)
+	if err != nil {
+		return fileResult{}, err
+	}
+	// The jobs are enqueued in the transaction of the photo, so that they only run once it is committed.
+	// Files already stored for another photo already have their derivatives, or a job generating them, which
+	// goes on with the photos of the same content if that photo is deleted.
+	if err = jobs.Enqueue(ctx, qtx, jobMetadata, photoJob{PhotoID: uint32(photoID)}); err != nil {
+		return fileResult{}, err
+	}
+	if existing.PhotoID == 0 {
+		if err = jobs.Enqueue(ctx, qtx, jobDerivatives, photoJob{PhotoID: uint32(photoID), PhotoHash: hash}); err != nil {
+			return fileResult{}, err
+		}
+	}
+	return fileResult{Name: name, Status: resultAdded}, nil
+}
+
+// rejected returns the result of a file that is not accepted as a photo.
+func rejected(name, reason string) fileResult {
+	return fileResult{Name: name, Status: resultRejected, Reason: reason}
+}
 
-		_, err = io.Copy(outFile, file)
+// hashFile returns the hex-encoded SHA-256 digest of a file and rewinds it.
+func hashFile(file io.ReadSeeker) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to rewind file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// contentKey returns the storage key of a file named after the digest of its content. Files are sharded
+// into two levels of subdirectories so that no directory grows too large.
+func contentKey(prefix, hash, ext string) string {
+	return path.Join(prefix, hash[:2], hash[2:4], hash+ext)
+}
+
+// generateDerivatives is the job generating the thumbnail and the preview of an uploaded photo from its original,
+// then enqueuing the computation of its perceptual hash. Originals are decoded on upload, so the ones that cannot be
+// decoded here were damaged in the storage: their photos are hidden, since they would be displayed broken.
+func (cfg Config) generateDerivatives(ctx context.Context, photo query.Photo) error {
+	file, err := cfg.Storage.Get(ctx, photo.PathToPhoto)
+	if errors.Is(err, storage.ErrNotExist) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := imaging.DecodeLimited(file, cfg.Uploads.MaxPixels)
+	if err != nil {
+		if hideErr := cfg.DB.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: true, PhotoID: photo.PhotoID}); hideErr != nil {
+			return hideErr
+		}
+		return jobs.Permanent(err)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind photo file: %w", err)
+	}
+	// The orientation defaults to upright when the metadata cannot be read
+	md, _ := metadata.Extract(file)
+
+	for _, derivative := range []struct {
+		key     string
+		maxSide int
+	}{
+		{photo.PathToThumbnail, cfg.Derivatives.ThumbnailSize},
+		{photo.PathToPreview, cfg.Derivatives.PreviewSize},
+	} {
+		var encoded bytes.Buffer
+		err = imaging.EncodeJPEG(&encoded, imaging.Orient(imaging.Resize(img, derivative.maxSide), md.Orientation), cfg.Derivatives.JPEGQuality)
 		if err != nil {
-			tx.Rollback()
-			http.Error(w, "Failed to write file to disk", http.StatusInternalServerError)
-			return
+			return err
 		}
+		err = cfg.storeFile(ctx, derivative.key, &encoded, int64(encoded.Len()))
+		if err != nil {
+			return err
+		}
+	}
+	return jobs.Enqueue(ctx, cfg.DB.Queries, jobPerceptualHash, photoJob{PhotoID: photo.PhotoID, PhotoHash: photo.PhotoHash})
+}
 
-		err = cfg.DB.DB.CreatePhoto(ctx, query.CreatePhotoParams{
-			PathToPhoto: filePath,
-			EventID:     uint32(eventID),
-		})
+// extractMetadata is the job extracting the metadata of an uploaded photo from its original. Corrupted metadata
+// does not fail the job, the photo is only left without the fields that could not be read.
+func (cfg Config) extractMetadata(ctx context.Context, photo query.Photo) error {
+	_, err := cfg.DB.GetPhotoMetadata(ctx, photo.PhotoID)
+	if err == nil {
+		return nil
 	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	file, err := cfg.Storage.Get(ctx, photo.PathToPhoto)
+	if errors.Is(err, storage.ErrNotExist) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	config, _, err := imaging.Inspect(file, cfg.Uploads.MaxPixels)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	md, err := metadata.Extract(file)
+	if err != nil {
+		cfg.Logger.Warn().Err(err).Uint32("photo_id", photo.PhotoID).Msg("could not read the metadata of the photo")
+	}
+	// The dimensions stored are the ones of the photo displayed upright
+	md.Width, md.Height = config.Width, config.Height
+	if md.Orientation >= 5 {
+		md.Width, md.Height = md.Height, md.Width
+	}
+	return cfg.DB.CreatePhotoMetadata(ctx, photoMetadataParams(photo.PhotoID, md))
+}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		http.Error(w, "Failed to commit database transaction", http.StatusInternalServerError)
-		return
+// storeFile puts a file in the storage unless an object already exists under its key.
+func (cfg Config) storeFile(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := cfg.Storage.Stat(ctx, key)
+	if err == nil {
+		return nil
 	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+	return cfg.Storage.Put(ctx, key, r, size)
+}
 
-	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, eventID), http.StatusSeeOther)
+// photoMetadataParams converts the metadata extracted from a photo into the parameters of its photo_metadata row.
+// Missing values are stored as NULL rather than as zeros.
+func photoMetadataParams(photoID uint32, md metadata.Metadata) query.CreatePhotoMetadataParams {
+	params := query.CreatePhotoMetadataParams{
+		PhotoID:      photoID,
+		CaptureDate:  sql.NullTime{Time: md.CaptureDate, Valid: !md.CaptureDate.IsZero()},
+		CameraMake:   sql.NullString{String: md.CameraMake, Valid: md.CameraMake != ""},
+		CameraModel:  sql.NullString{String: md.CameraModel, Valid: md.CameraModel != ""},
+		LensModel:    sql.NullString{String: md.LensModel, Valid: md.LensModel != ""},
+		Width:        uint32(md.Width),
+		Height:       uint32(md.Height),
+		Orientation:  uint16(max(md.Orientation, 1)),
+		ExposureTime: sql.NullString{String: md.ExposureTime, Valid: md.ExposureTime != ""},
+		FNumber:      sql.NullFloat64{Float64: md.FNumber, Valid: md.FNumber > 0},
+		Iso:          sql.NullInt32{Int32: int32(md.ISO), Valid: md.ISO > 0},
+		FocalLength:  sql.NullFloat64{Float64: md.FocalLength, Valid: md.FocalLength > 0},
+	}
+	if md.HasGPS {
+		params.GpsLatitude = sql.NullFloat64{Float64: md.Latitude, Valid: true}
+		params.GpsLongitude = sql.NullFloat64{Float64: md.Longitude, Valid: true}
+		params.GpsAltitude = sql.NullFloat64{Float64: md.Altitude, Valid: true}
+	}
+	return params
 }
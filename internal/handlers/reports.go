@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"photos/internal/db/query"
+	"strings"
+
+	"github.com/gorilla/csrf"
+)
+
+// Users report the photos they find problematic, and admins moderate the reports from a queue. A photo reported by
+// enough different users is hidden until an admin moderates it.
+
+// Actions of the moderation of the reports of a photo.
+const (
+	moderationDismiss = "dismiss"
+	moderationHide    = "hide"
+	moderationDelete  = "delete"
+)
+
+// reportReasonLabels are the labels of the reasons for which a photo can be reported.
+var reportReasonLabels = map[query.PhotoReportsReason]string{
+	query.PhotoReportsReasonInappropriate: "Contenu inapproprié",
+	query.PhotoReportsReasonPrivacy:       "Atteinte à la vie privée",
+	query.PhotoReportsReasonCopyright:     "Droits d'auteur",
+	query.PhotoReportsReasonOther:         "Autre",
+}
+
+// ReportPhotoHandler records the report of a photo, with the reason and the comment of the form.
+// The photo is hidden once the number of users reporting it reaches the threshold of the configuration.
+func (cfg Config) ReportPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	reason := query.PhotoReportsReason(r.FormValue("reason"))
+	if _, ok := reportReasonLabels[reason]; !ok {
+		RespondWithMessage(w, fmt.Sprintf("Unknown reason %q", reason), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+	err = qtx.CreatePhotoReport(ctx, query.CreatePhotoReportParams{
+		Reason:  reason,
+		Comment: strings.TrimSpace(r.FormValue("comment")),
+		PhotoID: photo.PhotoID,
+		UserID:  userInfo.UserID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if !photo.IsHidden && cfg.Reports.AutoHideThreshold > 0 {
+		reporters, err := qtx.CountPhotoReporters(ctx, photo.PhotoID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if reporters >= cfg.Reports.AutoHideThreshold {
+			if err = qtx.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: true, PhotoID: photo.PhotoID}); err != nil {
+				RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+				return
+			}
+			if err = qtx.MarkPhotoHiddenByReports(ctx, photo.PhotoID); err != nil {
+				RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+				return
+			}
+			cfg.Logger.Info().Uint32("photo_id", photo.PhotoID).Int64("reporters", reporters).Msg("hid reported photo")
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+}
+
+// ServeReportsHandler lists the open reports to moderate, followed by the history of the moderated ones.
+func (cfg Config) ServeReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	open, err := cfg.DB.GetPhotoReports(ctx, query.GetPhotoReportsParams{Open: true, Limit: math.MaxInt32})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	history, err := cfg.DB.GetPhotoReports(ctx, query.GetPhotoReportsParams{Open: false, Limit: cfg.Reports.HistoryLength})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "reports.html", map[string]interface{}{
+		"Open":         open,
+		"History":      history,
+		"ReasonLabels": reportReasonLabels,
+		"ReportsURL":   cfg.Routes.Reports,
+		"EventURL":     cfg.Routes.Event,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	})
+}
+
+// ModerateReportsHandler closes the open reports of a photo. Dismissing them shows the photo again if it was hidden
+// by the reports, photos hidden by an admin stay hidden, while hiding or deleting the photo resolves them.
+func (cfg Config) ModerateReportsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+	status := query.PhotoReportsStatusResolved
+	switch action := r.FormValue("action"); action {
+	case moderationDismiss:
+		status = query.PhotoReportsStatusDismissed
+		var hiddenByReports bool
+		hiddenByReports, err = qtx.IsPhotoHiddenByReports(ctx, photo.PhotoID)
+		if err == nil && hiddenByReports {
+			err = qtx.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: false, PhotoID: photo.PhotoID})
+		}
+	case moderationHide:
+		err = qtx.SetPhotoHidden(ctx, query.SetPhotoHiddenParams{IsHidden: true, PhotoID: photo.PhotoID})
+	case moderationDelete:
+		err = qtx.TrashPhoto(ctx, photo.PhotoID)
+	default:
+		RespondWithMessage(w, fmt.Sprintf("Unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	err = qtx.ClosePhotoReports(ctx, query.ClosePhotoReportsParams{
+		Status:      status,
+		ModeratorID: sql.NullInt32{Int32: int32(userInfo.UserID), Valid: true},
+		PhotoID:     photo.PhotoID,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, cfg.Routes.Reports, http.StatusSeeOther)
+}
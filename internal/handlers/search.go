@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"photos/internal/db/query"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchPageSize is the number of events on a page of search results.
+const searchPageSize = 20
+
+// searchDateLayout is the layout of the dates of the date range filter, as sent by date inputs.
+const searchDateLayout = "2006-01-02"
+
+// searchResult is an event found by a search.
+type searchResult struct {
+	query.Event
+	Locked bool // The user must enter the password of the event, or of an ancestor, to see its photos.
+}
+
+// SearchHandler searches the events whose name or description match the "q" parameter, or that hold photos with
+// matching tags. Results are ranked by relevance and can be restricted to events between the "from" and "to" dates.
+// Tags of hidden photos only count for admins.
+func (cfg Config) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	search := strings.TrimSpace(r.FormValue("q"))
+	offset, err := strconv.Atoi(r.FormValue("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	var fromDate, toDate sql.NullTime
+	if from := r.FormValue("from"); from != "" {
+		fromDate.Time, err = time.ParseInLocation(searchDateLayout, from, time.Local)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse from param: %s", err), http.StatusBadRequest)
+			return
+		}
+		fromDate.Valid = true
+	}
+	if to := r.FormValue("to"); to != "" {
+		toDate.Time, err = time.ParseInLocation(searchDateLayout, to, time.Local)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Could not parse to param: %s", err), http.StatusBadRequest)
+			return
+		}
+		// The range includes the whole last day
+		toDate.Time, toDate.Valid = toDate.Time.AddDate(0, 0, 1), true
+	}
+
+	data := map[string]interface{}{
+		"Query":        search,
+		"From":         r.FormValue("from"),
+		"To":           r.FormValue("to"),
+		"SearchURL":    cfg.Routes.Search,
+		"EventURL":     cfg.Routes.Event,
+		"DashboardURL": cfg.Routes.Dashboard,
+	}
+	if search == "" {
+		renderTemplate(w, cfg.Templates, "search.html", data)
+		return
+	}
+
+	// One more event than shown tells whether there is a next page
+	events, err := cfg.DB.SearchEvents(ctx, query.SearchEventsParams{
+		Search:        search,
+		IncludeHidden: userInfo.IsAdmin,
+		FromDate:      fromDate,
+		ToDate:        toDate,
+		Limit:         searchPageSize + 1,
+		Offset:        int32(offset),
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	hasNext := len(events) > searchPageSize
+	if hasNext {
+		events = events[:searchPageSize]
+	}
+
+	results := make([]searchResult, 0, len(events))
+	for _, event := range events {
+		_, isLocked, err := cfg.lockedEvent(r, event.EventID)
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, searchResult{Event: event, Locked: isLocked})
+	}
+
+	pageURL := func(offset int) string {
+		params := url.Values{"q": {search}, "offset": {strconv.Itoa(offset)}}
+		if fromDate.Valid {
+			params.Set("from", r.FormValue("from"))
+		}
+		if toDate.Valid {
+			params.Set("to", r.FormValue("to"))
+		}
+		return cfg.Routes.Search + "?" + params.Encode()
+	}
+	data["Results"] = results
+	if offset > 0 {
+		data["PreviousURL"] = pageURL(max(offset-searchPageSize, 0))
+	}
+	if hasNext {
+		data["NextURL"] = pageURL(offset + searchPageSize)
+	}
+	renderTemplate(w, cfg.Templates, "search.html", data)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"photos/internal/imaging"
+	"photos/internal/storage"
+	"strconv"
+
+	"github.com/gorilla/csrf"
+)
+
+// Every photo gets a perceptual hash computed from its thumbnail by a background job, stored by the digest of its
+// content like its files. Unlike the digest, the hash barely changes when a photo is resized, re-encoded or slightly
+// edited, so that the number of bits by which two hashes differ tells how alike the photos look.
+
+// hashBatchSize is the number of photos whose missing hashes are computed by a request, so that it ends before
+// the timeout of the server. The page of the near-duplicates offers to compute the rest.
+const hashBatchSize = 200
+
+// SimilarPhotosHandler lists the photos that look like the photo of photo_id, across every event the user can see,
+// the most alike first.
+func (cfg Config) SimilarPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+
+	data := map[string]interface{}{
+		"Photo":        photo,
+		"EventURL":     cfg.Routes.Event,
+		"DashboardURL": cfg.Routes.Dashboard,
+	}
+	dhash, err := cfg.DB.GetPerceptualHash(ctx, photo.PhotoHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The hash is computed shortly after the upload, or by an admin for the photos uploaded before hashing
+		renderTemplate(w, cfg.Templates, "similar.html", data)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	data["Hashed"] = true
+
+	photos, err := cfg.DB.GetSimilarPhotos(ctx, query.GetSimilarPhotosParams{
+		Dhash:         dhash,
+		MaxDistance:   int64(cfg.Similarity.MaxDistance),
+		PhotoID:       photo.PhotoID,
+		IncludeHidden: userInfo.IsAdmin,
+		Limit:         cfg.Similarity.Limit,
+	})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if photos, err = cfg.unlockedPhotos(r, photos); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if data["Photos"], err = cfg.eventPhotos(ctx, photos); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "similar.html", data)
+}
+
+// ServeDuplicatesHandler lists the groups of near-duplicate photos of an event, such as burst shots or copies
+// exported at another size, so that admins can clean them up.
+func (cfg Config) ServeDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, ok := cfg.formEvent(w, r)
+	if !ok {
+		return
+	}
+	photos, err := cfg.DB.GetPhotosByEventID(ctx, event.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	hashes, err := cfg.DB.GetPerceptualHashesByEventID(ctx, event.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	missing, err := cfg.DB.GetPhotosWithoutPerceptualHash(ctx, event.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	photosByID := make(map[uint32]query.Photo, len(photos))
+	for _, photo := range photos {
+		photosByID[photo.PhotoID] = photo
+	}
+	dhashes := make([]uint64, len(hashes))
+	for i, hash := range hashes {
+		dhashes[i] = hash.Dhash
+	}
+	var groups [][]query.Photo
+	for _, indexes := range imaging.GroupSimilar(dhashes, cfg.Similarity.MaxDistance) {
+		group := make([]query.Photo, 0, len(indexes))
+		for _, i := range indexes {
+			group = append(group, photosByID[hashes[i].PhotoID])
+		}
+		groups = append(groups, group)
+	}
+
+	renderTemplate(w, cfg.Templates, "duplicates.html", map[string]interface{}{
+		"Event":         event,
+		"Groups":        groups,
+		"Missing":       len(missing),
+		"DuplicatesURL": cfg.Routes.Duplicates,
+		"BulkPhotosURL": cfg.Routes.BulkPhotos,
+		"EventURL":      cfg.Routes.Event,
+		"CSRF_TOKEN":    csrf.Token(r),
+	})
+}
+
+// HashEventPhotosHandler computes the missing perceptual hashes of the photos of an event, uploaded before the hashes
+// were introduced, from their thumbnails. At most hashBatchSize photos are hashed by a request.
+func (cfg Config) HashEventPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	event, ok := cfg.formEvent(w, r)
+	if !ok {
+		return
+	}
+	missing, err := cfg.DB.GetPhotosWithoutPerceptualHash(ctx, event.EventID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	for _, photo := range missing[:min(len(missing), hashBatchSize)] {
+		if err = cfg.hashStoredPhoto(ctx, photo); err != nil {
+			RespondWithMessage(w, fmt.Sprintf("Failed to hash photo %d: %s", photo.PhotoID, err), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Duplicates, event.EventID), http.StatusSeeOther)
+}
+
+// formEvent looks up the event of the event_id field of a request, and responds with an error if it does not exist.
+func (cfg Config) formEvent(w http.ResponseWriter, r *http.Request) (query.Event, bool) {
+	eventID, err := strconv.Atoi(r.FormValue("event_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse event_id param: %s", err), http.StatusBadRequest)
+		return query.Event{}, false
+	}
+	events, err := cfg.DB.GetEventByID(r.Context(), uint32(eventID))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return query.Event{}, false
+	}
+	if len(events) == 0 {
+		RespondWithMessage(w, "event_id does not correspond to any existing event", http.StatusNotFound)
+		return query.Event{}, false
+	}
+	return events[0], true
+}
+
+// hashStoredPhoto computes the perceptual hash of a photo from its stored thumbnail, which is displayed upright.
+// Photos whose thumbnail is missing from the storage are skipped.
+func (cfg Config) hashStoredPhoto(ctx context.Context, photo query.Photo) error {
+	file, err := cfg.Storage.Get(ctx, photo.PathToThumbnail)
+	if errors.Is(err, storage.ErrNotExist) {
+		cfg.Logger.Warn().Uint32("photo_id", photo.PhotoID).Msg("thumbnail missing from the storage, photo not hashed")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := imaging.Decode(file)
+	if err != nil {
+		return err
+	}
+	return cfg.DB.CreatePerceptualHash(ctx, query.CreatePerceptualHashParams{PhotoHash: photo.PhotoHash, Dhash: imaging.DHash(img)})
+}
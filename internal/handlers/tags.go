@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"photos/internal/tags"
+	"strconv"
+
+	"github.com/gorilla/csrf"
+)
+
+// Tags are free-form labels that any user can add to the photos they can see. Tags created by admins are curated:
+// they are listed on the dashboard and suggested first. Names are normalized, so different spellings are one tag.
+
+// eventPhoto is a photo listed outside of its event, along with the name of the event.
+type eventPhoto struct {
+	query.Photo
+	EventName string
+}
+
+// TagPhotoHandler adds a tag to a photo, creating the tag if it does not exist yet.
+// htmx requests get the updated tags of the photo, others are sent back to its event.
+func (cfg Config) TagPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	tag, err := findOrCreateTag(ctx, cfg.DB.Queries, r.FormValue("tag"), userInfo.IsAdmin)
+	if errors.Is(err, tags.ErrEmpty) {
+		RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	err = cfg.DB.AddPhotoTag(ctx, query.AddPhotoTagParams{PhotoID: photo.PhotoID, TagID: tag.TagID, UserID: userInfo.UserID})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cfg.respondWithPhotoTags(w, r, photo)
+}
+
+// UntagPhotoHandler removes a tag from a photo.
+func (cfg Config) UntagPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+	tagID, err := strconv.Atoi(r.FormValue("tag_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse tag_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.RemovePhotoTag(r.Context(), query.RemovePhotoTagParams{PhotoID: photo.PhotoID, TagID: uint32(tagID)})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	cfg.respondWithPhotoTags(w, r, photo)
+}
+
+// PhotoTagsHandler lists the tags of a photo, with a form to add one.
+func (cfg Config) PhotoTagsHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.visiblePhoto(w, r)
+	if !ok {
+		return
+	}
+	cfg.renderPhotoTags(w, r, photo)
+}
+
+// TagSuggestionsHandler suggests the existing tags starting with the name being typed in the "tag" field.
+func (cfg Config) TagSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var suggestions []query.Tag
+	if prefix, err := tags.Normalize(r.FormValue("tag")); err == nil {
+		suggestions, err = cfg.DB.SearchTags(r.Context(), tags.LikePrefix(prefix))
+		if err != nil {
+			RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	renderTemplate(w, cfg.Templates, "tag_suggestions.html", map[string]interface{}{"Tags": suggestions})
+}
+
+// ServeTagHandler lists the photos carrying a tag, selected by tag_id or by name, across every event.
+// Photos of events the user has not unlocked are left out.
+func (cfg Config) ServeTagHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userInfo := ctx.Value("userInfo").(query.User)
+	var tag query.Tag
+	var err error
+	if tagID, parseErr := strconv.Atoi(r.FormValue("tag_id")); parseErr == nil {
+		tag, err = cfg.DB.GetTag(ctx, uint32(tagID))
+	} else {
+		name, _ := tags.Normalize(r.FormValue("name"))
+		tag, err = cfg.DB.GetTagByName(ctx, name)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		RespondWithMessage(w, "The tag does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	photos, err := cfg.DB.GetPhotosByTagID(ctx, query.GetPhotosByTagIDParams{TagID: tag.TagID, IncludeHidden: userInfo.IsAdmin})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	photos, err = cfg.unlockedPhotos(r, photos)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	tagged, err := cfg.eventPhotos(ctx, photos)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	renderTemplate(w, cfg.Templates, "tag.html", map[string]interface{}{
+		"Tag":          tag,
+		"Photos":       tagged,
+		"UserInfo":     userInfo,
+		"EventURL":     cfg.Routes.Event,
+		"TagURL":       cfg.Routes.Tag,
+		"DashboardURL": cfg.Routes.Dashboard,
+		"CSRF_TOKEN":   csrf.Token(r),
+	})
+}
+
+// CurateTagHandler marks a tag as curated, or as free-form again.
+func (cfg Config) CurateTagHandler(w http.ResponseWriter, r *http.Request) {
+	tagID, err := strconv.Atoi(r.FormValue("tag_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse tag_id param: %s", err), http.StatusBadRequest)
+		return
+	}
+	curated, err := strconv.ParseBool(r.FormValue("curated"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse curated param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.SetTagCurated(r.Context(), query.SetTagCuratedParams{IsCurated: curated, TagID: uint32(tagID)})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?tag_id=%d", cfg.Routes.Tag, tagID), http.StatusSeeOther)
+}
+
+// visiblePhoto looks up the photo of the photo_id field like formPhoto, but only if the user can see it:
+// hidden and deleted photos are reserved to admins, and the event of the photo must be unlocked.
+func (cfg Config) visiblePhoto(w http.ResponseWriter, r *http.Request) (query.Photo, bool) {
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return query.Photo{}, false
+	}
+	userInfo := r.Context().Value("userInfo").(query.User)
+	if !userInfo.IsAdmin && (photo.IsHidden || photo.DeletionDate.Valid) {
+		RespondWithMessage(w, "photo_id does not correspond to any existing photo", http.StatusNotFound)
+		return query.Photo{}, false
+	}
+	if _, isLocked, err := cfg.lockedEvent(r, photo.EventID); err != nil || isLocked {
+		respondWithLockError(w, err)
+		return query.Photo{}, false
+	}
+	return photo, true
+}
+
+// unlockedPhotos returns the photos whose event the user does not have to unlock first.
+func (cfg Config) unlockedPhotos(r *http.Request, photos []query.Photo) ([]query.Photo, error) {
+	unlocked := make([]query.Photo, 0, len(photos))
+	lockedEvents := make(map[uint32]bool)
+	for _, photo := range photos {
+		isLocked, checked := lockedEvents[photo.EventID]
+		if !checked {
+			var err error
+			if _, isLocked, err = cfg.lockedEvent(r, photo.EventID); err != nil {
+				return nil, err
+			}
+			lockedEvents[photo.EventID] = isLocked
+		}
+		if !isLocked {
+			unlocked = append(unlocked, photo)
+		}
+	}
+	return unlocked, nil
+}
+
+// eventPhotos adds the names of their events to photos listed outside of them.
+func (cfg Config) eventPhotos(ctx context.Context, photos []query.Photo) ([]eventPhoto, error) {
+	events, err := cfg.DB.GetEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	eventNames := make(map[uint32]string, len(events))
+	for _, e := range events {
+		eventNames[e.EventID] = e.Name
+	}
+	listed := make([]eventPhoto, 0, len(photos))
+	for _, photo := range photos {
+		listed = append(listed, eventPhoto{Photo: photo, EventName: eventNames[photo.EventID]})
+	}
+	return listed, nil
+}
+
+// respondWithPhotoTags answers a change of the tags of a photo: htmx requests get the updated tags,
+// others are sent back to the event of the photo.
+func (cfg Config) respondWithPhotoTags(w http.ResponseWriter, r *http.Request, photo query.Photo) {
+	if r.Header.Get("HX-Request") == "" {
+		http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+		return
+	}
+	cfg.renderPhotoTags(w, r, photo)
+}
+
+// renderPhotoTags renders the tags of a photo.
+func (cfg Config) renderPhotoTags(w http.ResponseWriter, r *http.Request, photo query.Photo) {
+	photoTags, err := cfg.DB.GetTagsByPhotoID(r.Context(), photo.PhotoID)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderTemplate(w, cfg.Templates, "photo_tags.html", map[string]interface{}{
+		"Photo":             photo,
+		"Tags":              photoTags,
+		"IsAdmin":           r.Context().Value("userInfo").(query.User).IsAdmin,
+		"TagURL":            cfg.Routes.Tag,
+		"PhotoTagsURL":      cfg.Routes.PhotoTags,
+		"TagSuggestionsURL": cfg.Routes.TagSuggestions,
+		"CSRF_TOKEN":        csrf.Token(r),
+	})
+}
+
+// findOrCreateTag returns the tag of a name typed by a user, creating it if needed.
+// Tags created by admins are curated.
+func findOrCreateTag(ctx context.Context, q *query.Queries, name string, curated bool) (query.Tag, error) {
+	name, err := tags.Normalize(name)
+	if err != nil {
+		return query.Tag{}, err
+	}
+	if err = q.CreateTag(ctx, query.CreateTagParams{Name: name, IsCurated: curated}); err != nil {
+		return query.Tag{}, err
+	}
+	return q.GetTagByName(ctx, name)
+}
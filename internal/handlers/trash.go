@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"photos/internal/db/query"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/csrf"
+)
+
+// Deleted photos go to a trash, from which admins can restore them until the retention of the configuration
+// has passed. They are then purged, along with their files when no other photo shares them.
+
+// trashedPhoto is a deleted photo listed in the trash.
+type trashedPhoto struct {
+	query.Photo
+	EventName string
+	PurgeDate time.Time
+}
+
+// HidePhotoHandler hides a photo from the students, or shows it again, without deleting it.
+func (cfg Config) HidePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+	hidden, err := strconv.ParseBool(r.FormValue("hidden"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse hidden param: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = cfg.DB.SetPhotoHidden(r.Context(), query.SetPhotoHiddenParams{IsHidden: hidden, PhotoID: photo.PhotoID})
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+}
+
+// DeletePhotoHandler moves a photo to the trash.
+func (cfg Config) DeletePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.TrashPhoto(r.Context(), photo.PhotoID); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s?event_id=%d", cfg.Routes.Event, photo.EventID), http.StatusSeeOther)
+}
+
+// RestorePhotoHandler takes a photo out of the trash and puts it back in its event.
+func (cfg Config) RestorePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photo, ok := cfg.formPhoto(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.RestorePhoto(r.Context(), photo.PhotoID); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, cfg.Routes.Trash, http.StatusSeeOther)
+}
+
+// ServeTrashHandler lists the deleted photos with the date at which they will be purged.
+func (cfg Config) ServeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	photos, err := cfg.DB.GetTrashedPhotos(ctx)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	events, err := cfg.DB.GetEvents(ctx)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	eventNames := make(map[uint32]string, len(events))
+	for _, e := range events {
+		eventNames[e.EventID] = e.Name
+	}
+
+	trashed := make([]trashedPhoto, 0, len(photos))
+	for _, photo := range photos {
+		trashed = append(trashed, trashedPhoto{
+			Photo:     photo,
+			EventName: eventNames[photo.EventID],
+			PurgeDate: photo.DeletionDate.Time.Add(cfg.Trash.Retention),
+		})
+	}
+	data := map[string]interface{}{
+		"Photos":          trashed,
+		"DashboardURL":    cfg.Routes.Dashboard,
+		"RestorePhotoURL": cfg.Routes.RestorePhoto,
+		"CSRF_TOKEN":      csrf.Token(r),
+	}
+	err = cfg.Templates.ExecuteTemplate(w, "trash.html", data)
+	if err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// formPhoto looks up the photo whose ID is submitted in the photo_id field of a form.
+func (cfg Config) formPhoto(w http.ResponseWriter, r *http.Request) (query.Photo, bool) {
+	photoID, err := strconv.Atoi(r.FormValue("photo_id"))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Could not parse photo_id param: %s", err), http.StatusBadRequest)
+		return query.Photo{}, false
+	}
+	photo, err := cfg.DB.GetPhoto(r.Context(), uint32(photoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		RespondWithMessage(w, "photo_id does not correspond to any existing photo", http.StatusNotFound)
+		return query.Photo{}, false
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return query.Photo{}, false
+	}
+	return photo, true
+}
+
+// RunTrashPurge purges the expired photos of the trash at the interval of the configuration, until ctx is cancelled.
+func (cfg Config) RunTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(cfg.Trash.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		if err := cfg.purgeTrash(ctx); err != nil {
+			cfg.Logger.Error().Err(err).Msg("failed to purge the trash")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes the photos that have been in the trash for longer than the retention. Their files are
+// deleted too, unless another photo with the same content still uses them. A photo that fails to be purged stays
+// in the trash until the next run.
+func (cfg Config) purgeTrash(ctx context.Context) error {
+	deletionDate := sql.NullTime{Time: time.Now().Add(-cfg.Trash.Retention), Valid: true}
+	photos, err := cfg.DB.GetExpiredTrashedPhotos(ctx, deletionDate)
+	if err != nil {
+		return err
+	}
+	for _, photo := range photos {
+		purged, err := cfg.purgePhoto(ctx, photo)
+		if err != nil {
+			cfg.Logger.Error().Err(err).Uint32("photo_id", photo.PhotoID).Msg("failed to purge photo from the trash")
+			continue
+		}
+		if purged {
+			cfg.Logger.Info().Uint32("photo_id", photo.PhotoID).Msg("purged photo from the trash")
+		}
+	}
+	return nil
+}
+
+// purgePhoto deletes a photo and its unused files in a transaction, which is only committed once the files are
+// deleted. It reports whether the files were deleted.
+func (cfg Config) purgePhoto(ctx context.Context, photo query.Photo) (bool, error) {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+	if err = qtx.DeletePhoto(ctx, photo.PhotoID); err != nil {
+		return false, err
+	}
+	purged, err := cfg.deleteUnusedFiles(ctx, qtx, photo)
+	if err != nil {
+		return false, err
+	}
+	return purged, tx.Commit()
+}
+
+// deleteUnusedFiles deletes the stored files of a photo deleted in qtx, unless another photo with the same content
+// still uses them. It reports whether the files were deleted.
+//
+// The photos with the same content are counted with a locking read, and uploads look for them with one too: an
+// upload reusing the files makes the deletion of the photo wait for it and is counted, and an upload starting after
+// the deletion waits for the transaction to end, so the transaction must only be committed after the files are
+// deleted.
+func (cfg Config) deleteUnusedFiles(ctx context.Context, qtx *query.Queries, photo query.Photo) (bool, error) {
+	count, err := qtx.CountPhotosByHash(ctx, photo.PhotoHash)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	for _, key := range []string{photo.PathToPhoto, photo.PathToThumbnail, photo.PathToPreview} {
+		if err = cfg.Storage.Delete(ctx, key); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
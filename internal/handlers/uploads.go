@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"photos/internal/db/query"
+	"photos/internal/filename"
+	"photos/internal/tus"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Resumable uploads follow the tus protocol: the client creates an upload with a POST, sends the file in chunks
+// with PATCH requests and asks for the offset to resume from with a HEAD request after a disconnection.
+// The file is added to its event once its last chunk is received.
+
+// TusOptionsHandler advertises the version and the extensions of the tus protocol supported by the server.
+func (cfg Config) TusOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tus.Version)
+	w.Header().Set("Tus-Version", tus.Version)
+	w.Header().Set("Tus-Extension", tus.Extensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(cfg.Uploads.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUploadHandler creates an upload from its length and its metadata, which must hold
+// the name of the file and the ID of the event it is added to.
+func (cfg Config) CreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !checkTusResumable(w, r) {
+		return
+	}
+	userInfo := ctx.Value("userInfo").(query.User)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		RespondWithMessage(w, "Upload-Length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if length > cfg.Uploads.MaxSize {
+		RespondWithMessage(w, fmt.Sprintf("Files cannot be larger than %d bytes", cfg.Uploads.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	uploadMetadata, err := tus.ParseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if uploadMetadata["filename"] == "" {
+		RespondWithMessage(w, "The filename is required in Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	name := filename.Sanitize(uploadMetadata["filename"])
+	eventID, err := strconv.Atoi(uploadMetadata["event_id"])
+	if err != nil || eventID <= 0 {
+		RespondWithMessage(w, "Invalid Event ID in Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+	events, err := cfg.DB.GetEventByID(ctx, uint32(eventID))
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		RespondWithMessage(w, "event_id does not correspond to any existing event", http.StatusNotFound)
+		return
+	}
+	if _, isLocked, err := cfg.lockedEvent(r, uint32(eventID)); err != nil || isLocked {
+		respondWithLockError(w, err)
+		return
+	}
+
+	// Abandoned uploads are cleaned up as new ones come in
+	if err = cfg.purgeExpiredUploads(ctx); err != nil {
+		cfg.Logger.Error().Err(err).Msg("could not purge expired uploads")
+	}
+
+	uploadID, err := tus.NewID()
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to generate upload ID: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if err = cfg.Uploads.Create(uploadID); err != nil {
+		RespondWithMessage(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = cfg.DB.CreateUpload(ctx, query.CreateUploadParams{
+		UploadID:     uploadID,
+		Filename:     name,
+		UploadLength: uint64(length),
+		UserID:       userInfo.UserID,
+		EventID:      uint32(eventID),
+	})
+	if err != nil {
+		_ = cfg.Uploads.Remove(uploadID)
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", cfg.Routes.Uploads+"/"+uploadID)
+	w.Header().Set("Upload-Expires", time.Now().Add(cfg.Uploads.Expiration).UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HeadUploadHandler returns the offset from which the client must resume an upload.
+func (cfg Config) HeadUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.userUpload(w, r)
+	if !ok {
+		return
+	}
+	offset, err := cfg.Uploads.Offset(upload.UploadID)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatUint(upload.UploadLength, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUploadHandler appends a chunk to an upload. When the last chunk is received, the file is added to its event
+// and the outcome is returned in the Upload-Result header. If that fails, the upload is kept so that the client can
+// try again by sending an empty chunk at the final offset.
+func (cfg Config) PatchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tus.ContentType {
+		RespondWithMessage(w, fmt.Sprintf("Content-Type must be %s", tus.ContentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		RespondWithMessage(w, "Upload-Offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	upload, ok := cfg.userUpload(w, r)
+	if !ok {
+		return
+	}
+
+	// Chunks from slow connections take longer to receive than the timeouts of the server
+	rc := http.NewResponseController(w)
+	if err = rc.SetReadDeadline(time.Time{}); err != nil {
+		cfg.Logger.Warn().Err(err).Str("upload_id", upload.UploadID).Msg("could not clear the read deadline of an upload")
+	}
+	if err = rc.SetWriteDeadline(time.Time{}); err != nil {
+		cfg.Logger.Warn().Err(err).Str("upload_id", upload.UploadID).Msg("could not clear the write deadline of an upload")
+	}
+	length := int64(upload.UploadLength)
+	offset, err = cfg.Uploads.Append(upload.UploadID, offset, length, r.Body)
+	if err != nil {
+		respondWithUploadError(w, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if offset < length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	result, err := cfg.commitUpload(ctx, upload)
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to save %s: %v", upload.Filename, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Result", url.PathEscape(result.Status)+";"+url.PathEscape(result.Reason))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUploadHandler cancels an upload and discards the data received so far.
+func (cfg Config) DeleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	upload, ok := cfg.userUpload(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.removeUpload(r.Context(), upload.UploadID); err != nil {
+		RespondWithMessage(w, fmt.Sprintf("Failed to delete upload: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkTusResumable rejects requests sent for another version of the tus protocol.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tus.Version)
+	if r.Header.Get("Tus-Resumable") != tus.Version {
+		w.Header().Set("Tus-Version", tus.Version)
+		RespondWithMessage(w, fmt.Sprintf("Only version %s of the tus protocol is supported", tus.Version), http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// userUpload looks up the upload of the URL, which must have been created by the current user.
+func (cfg Config) userUpload(w http.ResponseWriter, r *http.Request) (query.Upload, bool) {
+	userInfo := r.Context().Value("userInfo").(query.User)
+	upload, err := cfg.DB.GetUpload(r.Context(), chi.URLParam(r, "upload_id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && upload.UserID != userInfo.UserID) {
+		RespondWithMessage(w, "upload_id does not correspond to any existing upload", http.StatusNotFound)
+		return query.Upload{}, false
+	}
+	if err != nil {
+		RespondWithMessage(w, fmt.Sprintf("DB Failure: %s", err), http.StatusInternalServerError)
+		return query.Upload{}, false
+	}
+	return upload, true
+}
+
+// respondWithUploadError maps the errors of the staging area to the status codes of the tus protocol.
+func respondWithUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tus.ErrNotFound):
+		RespondWithMessage(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, tus.ErrOffsetMismatch):
+		RespondWithMessage(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, tus.ErrLocked):
+		RespondWithMessage(w, err.Error(), http.StatusLocked)
+	case errors.Is(err, tus.ErrTooLarge):
+		RespondWithMessage(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		RespondWithMessage(w, fmt.Sprintf("Failed to write upload: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// commitUpload adds a complete upload to its event and discards it.
+func (cfg Config) commitUpload(ctx context.Context, upload query.Upload) (fileResult, error) {
+	file, err := cfg.Uploads.Open(upload.UploadID)
+	if err != nil {
+		return fileResult{}, err
+	}
+	defer file.Close()
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fileResult{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	result, err := cfg.storeUploadedPhoto(ctx, qtx, upload.EventID, upload.Filename, file, int64(upload.UploadLength))
+	if err != nil {
+		return fileResult{}, err
+	}
+	if err = qtx.DeleteUpload(ctx, upload.UploadID); err != nil {
+		return fileResult{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return fileResult{}, err
+	}
+	cfg.Jobs.Wake()
+	if err = cfg.Uploads.Remove(upload.UploadID); err != nil {
+		cfg.Logger.Warn().Err(err).Str("upload_id", upload.UploadID).Msg("could not remove a staged upload")
+	}
+	return result, nil
+}
+
+// removeUpload discards the data and the row of an upload.
+func (cfg Config) removeUpload(ctx context.Context, uploadID string) error {
+	if err := cfg.Uploads.Remove(uploadID); err != nil {
+		return err
+	}
+	return cfg.DB.DeleteUpload(ctx, uploadID)
+}
+
+// purgeExpiredUploads discards the uploads that were not completed in time.
+func (cfg Config) purgeExpiredUploads(ctx context.Context) error {
+	uploads, err := cfg.DB.GetExpiredUploads(ctx, time.Now().Add(-cfg.Uploads.Expiration))
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		if err = cfg.removeUpload(ctx, upload.UploadID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
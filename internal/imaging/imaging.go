@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Register the decoders for the image formats accepted on upload.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// Variant identifies one of the renditions stored for every uploaded photo.
+// Thumbnails are used in galleries, previews when a photo is zoomed and originals for downloads.
+type Variant string
+
+const (
+	VariantThumbnail Variant = "thumb"    // Small rendition displayed in photo grids.
+	VariantPreview   Variant = "preview"  // Web-sized rendition displayed when a photo is opened.
+	VariantOriginal  Variant = "original" // The untouched uploaded file.
+)
+
+// ParseVariant converts a query parameter into a Variant.
+// An empty value defaults to the thumbnail so that listings never fetch originals by accident.
+func ParseVariant(s string) (Variant, error) {
+	switch Variant(s) {
+	case "", VariantThumbnail:
+		return VariantThumbnail, nil
+	case VariantPreview:
+		return VariantPreview, nil
+	case VariantOriginal:
+		return VariantOriginal, nil
+	default:
+		return "", fmt.Errorf("unknown photo size %q", s)
+	}
+}
+
+// Decode reads an image in any of the registered formats and returns it along with the format name.
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// Resize scales the image so that its longest side is at most maxSide pixels, preserving the aspect ratio.
+// Images that are already small enough are never upscaled. Transparent areas are flattened onto
+// a white background since derivatives are always encoded as JPEG.
+func Resize(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			height = max(1, height*maxSide/width)
+			width = maxSide
+		} else {
+			width = max(1, width*maxSide/height)
+			height = maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// Orient rotates and flips the image according to its EXIF orientation (1-8) so that it is displayed upright.
+// Derivatives are encoded without metadata, so the orientation has to be applied to the pixels.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// Orientations 5 to 8 are rotated by a quarter turn, which swaps the dimensions.
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally.
+				dx, dy = width-1-x, y
+			case 3: // Rotated by 180°.
+				dx, dy = width-1-x, height-1-y
+			case 4: // Mirrored vertically.
+				dx, dy = x, height-1-y
+			case 5: // Mirrored along the top-left diagonal.
+				dx, dy = y, x
+			case 6: // Rotated by 90° clockwise.
+				dx, dy = height-1-y, x
+			case 7: // Mirrored along the top-right diagonal.
+				dx, dy = height-1-y, width-1-x
+			case 8: // Rotated by 90° counterclockwise.
+				dx, dy = y, width-1-x
+			}
+			dst.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes the image as a JPEG with the given quality (1-100).
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	err := jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+	return nil
+}
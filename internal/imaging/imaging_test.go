@@ -0,0 +1,112 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseVariant ensures that size parameters are mapped to the right variant.
+func TestParseVariant(t *testing.T) {
+	variant, err := ParseVariant("")
+	assert.NoError(t, err, "An empty size should not return an error")
+	assert.Equal(t, VariantThumbnail, variant, "An empty size should default to the thumbnail")
+
+	variant, err = ParseVariant("original")
+	assert.NoError(t, err, "ParseVariant should accept the original size")
+	assert.Equal(t, VariantOriginal, variant, "original should map to VariantOriginal")
+
+	_, err = ParseVariant("huge")
+	assert.Error(t, err, "ParseVariant should reject unknown sizes")
+}
+
+// TestResize ensures that images are downscaled to fit the requested size while keeping their aspect ratio.
+func TestResize(t *testing.T) {
+	landscape := Resize(image.NewRGBA(image.Rect(0, 0, 4000, 2000)), 400)
+	assert.Equal(t, image.Rect(0, 0, 400, 200), landscape.Bounds(), "Landscape images should be limited by their width")
+
+	portrait := Resize(image.NewRGBA(image.Rect(0, 0, 1000, 3000)), 300)
+	assert.Equal(t, image.Rect(0, 0, 100, 300), portrait.Bounds(), "Portrait images should be limited by their height")
+
+	small := Resize(image.NewRGBA(image.Rect(0, 0, 50, 20)), 400)
+	assert.Equal(t, image.Rect(0, 0, 50, 20), small.Bounds(), "Small images should not be upscaled")
+}
+
+// TestEncodeJPEGRoundTrip ensures that encoded derivatives can be decoded back.
+func TestEncodeJPEGRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeJPEG(&buf, Resize(image.NewRGBA(image.Rect(0, 0, 64, 32)), 32), 80)
+	assert.NoError(t, err, "EncodeJPEG should not return an error")
+
+	img, format, err := Decode(&buf)
+	assert.NoError(t, err, "Decode should read back the encoded JPEG")
+	assert.Equal(t, "jpeg", format, "Derivatives should be encoded as JPEG")
+	assert.Equal(t, image.Rect(0, 0, 32, 16), img.Bounds(), "Decoded image should keep the resized dimensions")
+}
+
+// TestOrient ensures that EXIF orientations move pixels to the right place.
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, color.White)
+
+	rotated := Orient(src, 6)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), rotated.Bounds(), "A quarter turn should swap the dimensions")
+	assert.Equal(t, color.RGBAModel.Convert(color.White), rotated.At(1, 0), "Orientation 6 should rotate clockwise")
+
+	assert.Same(t, src, Orient(src, 1).(*image.RGBA), "Orientation 1 should leave the image untouched")
+}
+
+// TestSniff ensures that formats are identified from their content rather than from their name.
+func TestSniff(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeJPEG(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), 80), "EncodeJPEG should not return an error")
+	format, err := Sniff(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err, "Sniff should recognize JPEG files")
+	assert.Equal(t, "jpeg", format, "JPEG files should be identified")
+	assert.Equal(t, ".jpg", Extension(format), "JPEG files should be stored with the .jpg extension")
+
+	_, err = Sniff(strings.NewReader("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat, "Sniff should reject formats outside of the allowlist")
+
+	_, err = Sniff(strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat, "Sniff should reject empty files")
+}
+
+// TestInspect ensures that the dimensions are read from the header, leaving the reader rewound.
+func TestInspect(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 50))), "Encoding the test PNG should not fail")
+
+	r := bytes.NewReader(buf.Bytes())
+	config, format, err := Inspect(r, 5000)
+	assert.NoError(t, err, "Images within the limit should be inspected")
+	assert.Equal(t, "png", format, "The format should be returned")
+	assert.Equal(t, 100, config.Width, "The width should be read from the header")
+	assert.Equal(t, 50, config.Height, "The height should be read from the header")
+	assert.Equal(t, int64(buf.Len()), int64(r.Len()), "The reader should be rewound")
+
+	_, _, err = Inspect(bytes.NewReader(buf.Bytes()), 4999)
+	assert.ErrorIs(t, err, ErrTooManyPixels, "Images over the pixel limit should be rejected")
+}
+
+// TestDecodeLimited ensures that oversized and truncated images are rejected.
+func TestDecodeLimited(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 100, 50))), "Encoding the test PNG should not fail")
+
+	img, format, err := DecodeLimited(bytes.NewReader(buf.Bytes()), 5000)
+	assert.NoError(t, err, "Images within the limit should be decoded")
+	assert.Equal(t, "png", format, "The format should be returned")
+	assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds(), "The image should be decoded entirely")
+
+	_, _, err = DecodeLimited(bytes.NewReader(buf.Bytes()), 4999)
+	assert.ErrorIs(t, err, ErrTooManyPixels, "Images over the pixel limit should be rejected")
+
+	_, _, err = DecodeLimited(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), 5000)
+	assert.Error(t, err, "Truncated images should be rejected")
+}
@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+
+	"golang.org/x/image/draw"
+)
+
+// DHash returns the difference hash of an image: the image is shrunk to 9x8 grayscale pixels and every bit tells
+// whether a pixel is brighter than its right neighbour. Resized, re-encoded or slightly edited copies of a photo
+// get hashes only a few bits apart, unlike cryptographic digests.
+func DHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.CatmullRom.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashDistance returns the Hamming distance between two perceptual hashes, the number of bits that differ.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// GroupSimilar groups the indexes of the hashes that are within maxDistance of each other, directly or through
+// other hashes of the group. Only groups of at least two hashes are returned, in the order of their first index.
+func GroupSimilar(hashes []uint64, maxDistance int) [][]int {
+	parents := make([]int, len(hashes))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if HashDistance(hashes[i], hashes[j]) <= maxDistance {
+				parents[root(j)] = root(i)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var roots []int
+	for i := range hashes {
+		r := root(i)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], i)
+	}
+	var groups [][]int
+	for _, r := range roots {
+		if len(members[r]) > 1 {
+			groups = append(groups, members[r])
+		}
+	}
+	return groups
+}
@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gradient returns a grayscale image whose brightness decreases from left to right, or increases if reversed.
+func gradient(width, height int, reversed bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		v := uint8(255 - x*255/(width-1))
+		if reversed {
+			v = 255 - v
+		}
+		for y := 0; y < height; y++ {
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	return img
+}
+
+// TestDHash ensures that resized copies of an image get close hashes while different images do not.
+func TestDHash(t *testing.T) {
+	original := DHash(gradient(900, 600, false))
+	assert.Equal(t, ^uint64(0), original, "Every pixel of a darkening gradient should be brighter than its right neighbour")
+
+	resized := DHash(Resize(gradient(900, 600, false), 120))
+	assert.LessOrEqual(t, HashDistance(original, resized), 2, "A resized copy should get a close hash")
+
+	reversed := DHash(gradient(900, 600, true))
+	assert.Equal(t, 64, HashDistance(original, reversed), "A mirrored gradient should get the opposite hash")
+}
+
+// TestHashDistance ensures that the distance counts the bits that differ.
+func TestHashDistance(t *testing.T) {
+	assert.Equal(t, 0, HashDistance(0xF0F0, 0xF0F0), "Identical hashes should be at distance 0")
+	assert.Equal(t, 3, HashDistance(0b1011, 0b0000), "The distance should count the differing bits")
+	assert.Equal(t, 64, HashDistance(0, ^uint64(0)), "Opposite hashes should be at distance 64")
+}
+
+// TestGroupSimilar ensures that hashes are grouped transitively and that isolated hashes are left out.
+func TestGroupSimilar(t *testing.T) {
+	hashes := []uint64{0b0000, 0xFFFF0000, 0b0011, 0b0111, 0xFFFF0001, ^uint64(0)}
+	groups := GroupSimilar(hashes, 2)
+	assert.Equal(t, [][]int{{0, 2, 3}, {1, 4}}, groups, "Close hashes should be grouped, through their neighbours too")
+
+	assert.Empty(t, GroupSimilar(hashes, -1), "No hash should be grouped with a negative distance")
+	assert.Empty(t, GroupSimilar(nil, 10), "No group should be returned without hashes")
+}
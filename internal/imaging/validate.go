@@ -0,0 +1,102 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	// WebP photos are accepted on upload, their derivatives are encoded as JPEG.
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooManyPixels     = errors.New("image has too many pixels")
+)
+
+// signatures maps the magic bytes starting the files of the accepted formats to the name of the format.
+var signatures = []struct {
+	format string
+	match  func(header []byte) bool
+}{
+	{"jpeg", func(h []byte) bool { return bytes.HasPrefix(h, []byte{0xFF, 0xD8, 0xFF}) }},
+	{"png", func(h []byte) bool { return bytes.HasPrefix(h, []byte("\x89PNG\r\n\x1a\n")) }},
+	{"gif", func(h []byte) bool {
+		return bytes.HasPrefix(h, []byte("GIF87a")) || bytes.HasPrefix(h, []byte("GIF89a"))
+	}},
+	{"webp", func(h []byte) bool {
+		return len(h) >= 12 && bytes.Equal(h[:4], []byte("RIFF")) && bytes.Equal(h[8:12], []byte("WEBP"))
+	}},
+}
+
+// extensions maps the accepted formats to the extension of their stored files.
+var extensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"webp": ".webp",
+}
+
+// Sniff identifies the format of an image from its first bytes, whatever its name claims,
+// and rewinds it. Formats outside of the allowlist return ErrUnsupportedFormat.
+func Sniff(r io.ReadSeeker) (string, error) {
+	header := make([]byte, 12)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	for _, s := range signatures {
+		if s.match(header[:n]) {
+			return s.format, nil
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Extension returns the extension of the files of a format returned by Sniff, dot included.
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// Inspect sniffs the format of an image and reads its dimensions from its header, without decoding its pixels.
+// Images of more than maxPixels pixels return ErrTooManyPixels, which protects the server from decompression bombs.
+// The reader is rewound.
+func Inspect(r io.ReadSeeker, maxPixels int) (image.Config, string, error) {
+	format, err := Sniff(r)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return image.Config{}, "", fmt.Errorf("failed to decode image header: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+		return image.Config{}, "", fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return image.Config{}, "", err
+	}
+	return config, format, nil
+}
+
+// DecodeLimited inspects an image like Inspect and decodes it entirely, so that truncated or corrupted files are
+// rejected. The reader is left at an unspecified position.
+func DecodeLimited(r io.ReadSeeker, maxPixels int) (image.Image, string, error) {
+	_, format, err := Inspect(r, maxPixels)
+	if err != nil {
+		return nil, "", err
+	}
+	img, decodedFormat, err := Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if decodedFormat != format {
+		return nil, "", fmt.Errorf("%w: %s content in a %s file", ErrUnsupportedFormat, decodedFormat, format)
+	}
+	return img, format, nil
+}
@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"photos/internal/db"
+	"photos/internal/db/query"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Jobs are units of background work stored in the jobs table, so that they survive restarts of the server.
+// Workers claim the jobs that are due and hold a lease on them: the run_after date of a running job is the end of
+// its lease, after which the job is claimed again, in case its worker stopped without finishing it.
+// Failed jobs are retried with an exponential backoff until their attempts are exhausted.
+
+// Handler processes the payload of a job. Returning an error retries the job later, unless the error is permanent.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Options configure the workers of a Queue.
+type Options struct {
+	Workers      int           // Number of jobs processed concurrently.
+	PollInterval time.Duration // Interval at which idle workers look for due jobs.
+	Timeout      time.Duration // Maximum duration of a job, which is also the length of the lease of its worker.
+	MaxAttempts  uint32        // Number of attempts after which a failing job is given up.
+	Backoff      time.Duration // Delay before the first retry of a failed job, doubled at each attempt.
+	MaxBackoff   time.Duration // Maximum delay between two attempts.
+}
+
+// Queue runs the jobs of the database with a bounded pool of workers.
+type Queue struct {
+	db       *db.DB
+	options  Options
+	logger   zerolog.Logger
+	handlers map[string]Handler
+
+	wake    chan struct{}      // Wakes an idle worker up when jobs are enqueued.
+	stop    chan struct{}      // Closed when the workers must stop claiming jobs.
+	cancel  context.CancelFunc // Cancels the jobs in progress.
+	workers sync.WaitGroup
+}
+
+// permanentError is an error of a job that would fail the same way if retried.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks the error of a job as permanent: the job fails without being retried.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Backoff returns the delay before the next attempt of a job that failed its attempt-th attempt:
+// the base delay doubled at each attempt, up to maxDelay.
+func Backoff(attempt uint32, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := uint32(1); i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Enqueue adds a job of a kind to the queue, with its payload encoded as JSON. It takes the queries of the caller
+// so that jobs can be enqueued in the transaction creating the rows they process.
+func Enqueue(ctx context.Context, q *query.Queries, kind string, payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode the payload of a %s job: %w", kind, err)
+	}
+	return q.CreateJob(ctx, query.CreateJobParams{Kind: kind, Payload: encoded, RunAfter: time.Now()})
+}
+
+// New creates a queue running its jobs against a database. Handlers must be registered before it is started.
+func New(database *db.DB, options Options, logger zerolog.Logger) *Queue {
+	return &Queue{
+		db:       database,
+		options:  options,
+		logger:   logger,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register sets the handler of the jobs of a kind.
+func (q *Queue) Register(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Start launches the workers of the queue.
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < max(q.options.Workers, 1); i++ {
+		q.workers.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Wake tells an idle worker that jobs were enqueued, so that they start without waiting for the next poll.
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Drain stops the workers from claiming new jobs and waits for the jobs in progress to finish. If ctx ends first,
+// the jobs in progress are cancelled and will be retried, and the error of ctx is returned.
+func (q *Queue) Drain(ctx context.Context) error {
+	close(q.stop)
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work processes the due jobs until the queue is drained, polling for new ones when idle.
+func (q *Queue) work(ctx context.Context) {
+	defer q.workers.Done()
+	ticker := time.NewTicker(q.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		job, err := q.claim(ctx)
+		if err == nil {
+			q.run(ctx, job)
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			q.logger.Error().Err(err).Msg("failed to claim a job")
+		}
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim takes the lease of the next due job. It returns sql.ErrNoRows when no job is due.
+func (q *Queue) claim(ctx context.Context) (query.Job, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return query.Job{}, err
+	}
+	defer tx.Rollback()
+	qtx := q.db.WithTx(tx)
+	now := time.Now()
+	job, err := qtx.GetDueJob(ctx, now)
+	if err != nil {
+		return query.Job{}, err
+	}
+	if err = qtx.StartJob(ctx, query.StartJobParams{RunAfter: now.Add(q.options.Timeout), JobID: job.JobID}); err != nil {
+		return query.Job{}, err
+	}
+	job.Attempts++
+	return job, tx.Commit()
+}
+
+// run processes a claimed job and records its outcome. The outcome is recorded even if the job was cancelled
+// by the draining of the queue, so that it is retried by the next server.
+func (q *Queue) run(ctx context.Context, job query.Job) {
+	logger := q.logger.With().Uint32("job_id", job.JobID).Str("kind", job.Kind).Uint32("attempt", job.Attempts).Logger()
+	err := q.process(ctx, job)
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case err == nil:
+		err = q.db.CompleteJob(ctx, job.JobID)
+	case errors.As(err, new(permanentError)) || job.Attempts >= q.options.MaxAttempts:
+		logger.Error().Err(err).Msg("job failed")
+		err = q.db.FailJob(ctx, query.FailJobParams{LastError: sql.NullString{String: err.Error(), Valid: true}, JobID: job.JobID})
+	default:
+		delay := Backoff(job.Attempts, q.options.Backoff, q.options.MaxBackoff)
+		logger.Warn().Err(err).Dur("delay", delay).Msg("job will be retried")
+		err = q.db.RetryJob(ctx, query.RetryJobParams{
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+			RunAfter:  time.Now().Add(delay),
+			JobID:     job.JobID,
+		})
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to record the outcome of a job")
+	}
+}
+
+// process calls the handler of a job within its timeout, turning panics into errors.
+func (q *Queue) process(ctx context.Context, job query.Job) (err error) {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for jobs of kind %q", job.Kind))
+	}
+	ctx, cancel := context.WithTimeout(ctx, q.options.Timeout)
+	defer cancel()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job.Payload)
+}
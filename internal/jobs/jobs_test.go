@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBackoff ensures that the delay doubles at each attempt without exceeding the maximum.
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Backoff(1, 10*time.Second, time.Hour), "The first retry should wait the base delay")
+	assert.Equal(t, 40*time.Second, Backoff(3, 10*time.Second, time.Hour), "The delay should double at each attempt")
+	assert.Equal(t, time.Hour, Backoff(30, 10*time.Second, time.Hour), "The delay should not exceed the maximum")
+	assert.Equal(t, time.Minute, Backoff(1, 10*time.Minute, time.Minute), "A base delay over the maximum should be capped")
+}
+
+// TestPermanent ensures that permanent errors can be told apart while keeping the error they wrap.
+func TestPermanent(t *testing.T) {
+	cause := errors.New("corrupted file")
+	err := fmt.Errorf("photo 3: %w", Permanent(cause))
+	assert.ErrorAs(t, err, new(permanentError), "A wrapped permanent error should still be permanent")
+	assert.ErrorIs(t, err, cause, "A permanent error should wrap its cause")
+	assert.Equal(t, "photo 3: corrupted file", err.Error(), "A permanent error should keep the message of its cause")
+	assert.False(t, errors.As(cause, new(permanentError)), "Other errors should not be permanent")
+}
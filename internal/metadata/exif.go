@@ -0,0 +1,197 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TIFF tags read from the EXIF payload. The pointer tags lead to the Exif and GPS sub-IFDs.
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFDPointer     = 0x8769
+	tagGPSIFDPointer      = 0x8825
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920A
+	tagPixelXDimension    = 0xA002
+	tagPixelYDimension    = 0xA003
+	tagLensModel          = 0xA434
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+	tagGPSAltitudeRef     = 0x0005
+	tagGPSAltitude        = 0x0006
+)
+
+// TIFF field types and the size in bytes of one of their values.
+var typeSizes = map[uint16]uint32{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+var errInvalidTIFF = errors.New("invalid EXIF payload")
+
+// tiff gives access to the fields of an EXIF payload, which is a TIFF structure
+// whose offsets are relative to the start of the payload.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// entry is one field of an IFD. Its value is stored inline in the entry when it fits
+// in four bytes, otherwise valueOffset points to it.
+type entry struct {
+	tag         uint16
+	typ         uint16
+	count       uint32
+	valueOffset uint32 // Offset of the value inside the payload.
+}
+
+// newTIFF validates the header of an EXIF payload.
+func newTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, errInvalidTIFF
+	}
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, errInvalidTIFF
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, errInvalidTIFF
+	}
+	return t, nil
+}
+
+// firstIFD returns the offset of IFD0.
+func (t *tiff) firstIFD() uint32 {
+	return t.order.Uint32(t.data[4:8])
+}
+
+// entries reads the fields of the IFD located at offset.
+func (t *tiff) entries(offset uint32) ([]entry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, errInvalidTIFF
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	if uint64(offset)+2+uint64(count)*12 > uint64(len(t.data)) {
+		return nil, errInvalidTIFF
+	}
+	entries := make([]entry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		pos := offset + 2 + i*12
+		e := entry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+		}
+		size, ok := typeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		if uint64(size)*uint64(e.count) <= 4 {
+			e.valueOffset = pos + 8
+		} else {
+			e.valueOffset = t.order.Uint32(t.data[pos+8:])
+		}
+		if uint64(e.valueOffset)+uint64(size)*uint64(e.count) > uint64(len(t.data)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// uint returns the i-th integer value of a BYTE, SHORT or LONG entry.
+func (t *tiff) uint(e entry, i uint32) (uint32, bool) {
+	if i >= e.count {
+		return 0, false
+	}
+	switch e.typ {
+	case 1, 7:
+		return uint32(t.data[e.valueOffset+i]), true
+	case 3:
+		return uint32(t.order.Uint16(t.data[e.valueOffset+2*i:])), true
+	case 4:
+		return t.order.Uint32(t.data[e.valueOffset+4*i:]), true
+	default:
+		return 0, false
+	}
+}
+
+// rational returns the i-th value of a RATIONAL or SRATIONAL entry as a numerator and denominator.
+func (t *tiff) rational(e entry, i uint32) (int64, int64, bool) {
+	if i >= e.count || (e.typ != 5 && e.typ != 10) {
+		return 0, 0, false
+	}
+	pos := e.valueOffset + 8*i
+	num, den := t.order.Uint32(t.data[pos:]), t.order.Uint32(t.data[pos+4:])
+	if e.typ == 10 {
+		return int64(int32(num)), int64(int32(den)), den != 0
+	}
+	return int64(num), int64(den), den != 0
+}
+
+// float returns the i-th value of a RATIONAL entry as a float.
+func (t *tiff) float(e entry, i uint32) (float64, bool) {
+	num, den, ok := t.rational(e, i)
+	if !ok {
+		return 0, false
+	}
+	return float64(num) / float64(den), true
+}
+
+// string returns the value of an ASCII entry without its trailing NUL bytes and padding.
+func (t *tiff) string(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	value := string(t.data[e.valueOffset : e.valueOffset+e.count])
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+// ifd reads the entries of an IFD into a map indexed by tag.
+func (t *tiff) ifd(offset uint32) (map[uint16]entry, error) {
+	entries, err := t.entries(offset)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[uint16]entry, len(entries))
+	for _, e := range entries {
+		fields[e.tag] = e
+	}
+	return fields, nil
+}
+
+// subIFD follows a pointer tag of IFD0 to the fields of the Exif or GPS sub-IFD.
+// A missing pointer results in an empty map.
+func (t *tiff) subIFD(ifd0 map[uint16]entry, pointerTag uint16) (map[uint16]entry, error) {
+	pointer, ok := ifd0[pointerTag]
+	if !ok {
+		return map[uint16]entry{}, nil
+	}
+	offset, ok := t.uint(pointer, 0)
+	if !ok {
+		return nil, fmt.Errorf("%w: bad sub-IFD pointer %#x", errInvalidTIFF, pointerTag)
+	}
+	return t.ifd(offset)
+}
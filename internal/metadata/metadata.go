@@ -0,0 +1,318 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Metadata holds the EXIF information extracted from a photo.
+// Fields the camera did not record are left to their zero value.
+type Metadata struct {
+	CaptureDate  time.Time // Date the photo was shot, zero if unknown.
+	CameraMake   string    // Manufacturer of the camera.
+	CameraModel  string    // Model of the camera.
+	LensModel    string    // Model of the lens.
+	Width        int       // Width in pixels, as recorded by the camera.
+	Height       int       // Height in pixels, as recorded by the camera.
+	Orientation  int       // EXIF orientation (1-8) to apply to display the photo upright.
+	ExposureTime string    // Exposure time, formatted like "1/250".
+	FNumber      float64   // Aperture f-number.
+	ISO          int       // ISO sensitivity.
+	FocalLength  float64   // Focal length in millimeters.
+	HasGPS       bool      // Indicates if the GPS coordinates below were recorded.
+	Latitude     float64   // Latitude in decimal degrees, negative in the southern hemisphere.
+	Longitude    float64   // Longitude in decimal degrees, negative west of Greenwich.
+	Altitude     float64   // Altitude in meters, negative below sea level.
+}
+
+const (
+	exifDateLayout       = "2006:01:02 15:04:05"
+	exifDateOffsetLayout = "2006:01:02 15:04:05-07:00"
+)
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+)
+
+// Extract reads the EXIF metadata of a JPEG or PNG photo. Files without metadata, or in another
+// format, yield an empty Metadata and no error. An error is only returned when the metadata is corrupted.
+func Extract(r io.Reader) (Metadata, error) {
+	payload, err := findEXIF(bufio.NewReader(r))
+	if err != nil || payload == nil {
+		return Metadata{}, err
+	}
+	return parse(payload)
+}
+
+// findEXIF locates the EXIF payload of a photo and returns it without any container header.
+func findEXIF(r *bufio.Reader) ([]byte, error) {
+	signature, err := r.Peek(len(pngSignature))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(signature, jpegSignature):
+		return findJPEGEXIF(r)
+	case bytes.HasPrefix(signature, pngSignature):
+		return findPNGEXIF(r)
+	default:
+		return nil, nil
+	}
+}
+
+// findJPEGEXIF walks the segments of a JPEG until the image data, looking for the APP1 Exif segment.
+func findJPEGEXIF(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(len(jpegSignature)); err != nil {
+		return nil, err
+	}
+	for {
+		marker, segment, err := readJPEGSegment(r)
+		if err != nil {
+			return nil, err
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return nil, nil
+		}
+		if marker == markerAPP1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):], nil
+		}
+	}
+}
+
+// findPNGEXIF walks the chunks of a PNG until its end, looking for the eXIf chunk.
+func findPNGEXIF(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return nil, err
+	}
+	for {
+		chunkType, data, err := readPNGChunk(r, func(chunkType string) bool { return chunkType == "eXIf" })
+		if err != nil {
+			return nil, err
+		}
+		switch chunkType {
+		case "eXIf":
+			return data, nil
+		case "IEND":
+			return nil, nil
+		}
+	}
+}
+
+// parse decodes the fields of interest from an EXIF payload.
+func parse(payload []byte) (Metadata, error) {
+	t, err := newTIFF(payload)
+	if err != nil {
+		return Metadata{}, err
+	}
+	ifd0, err := t.ifd(t.firstIFD())
+	if err != nil {
+		return Metadata{}, err
+	}
+	exifIFD, err := t.subIFD(ifd0, tagExifIFDPointer)
+	if err != nil {
+		return Metadata{}, err
+	}
+	gpsIFD, err := t.subIFD(ifd0, tagGPSIFDPointer)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	md := Metadata{
+		CameraMake:  t.string(ifd0[tagMake]),
+		CameraModel: t.string(ifd0[tagModel]),
+		LensModel:   t.string(exifIFD[tagLensModel]),
+	}
+	if e, ok := ifd0[tagOrientation]; ok {
+		if orientation, ok := t.uint(e, 0); ok && orientation >= 1 && orientation <= 8 {
+			md.Orientation = int(orientation)
+		}
+	}
+	if e, ok := exifIFD[tagPixelXDimension]; ok {
+		width, _ := t.uint(e, 0)
+		md.Width = int(width)
+	}
+	if e, ok := exifIFD[tagPixelYDimension]; ok {
+		height, _ := t.uint(e, 0)
+		md.Height = int(height)
+	}
+	if e, ok := exifIFD[tagExposureTime]; ok {
+		if num, den, ok := t.rational(e, 0); ok {
+			md.ExposureTime = formatExposureTime(num, den)
+		}
+	}
+	if e, ok := exifIFD[tagFNumber]; ok {
+		md.FNumber, _ = t.float(e, 0)
+	}
+	if e, ok := exifIFD[tagISO]; ok {
+		iso, _ := t.uint(e, 0)
+		md.ISO = int(iso)
+	}
+	if e, ok := exifIFD[tagFocalLength]; ok {
+		md.FocalLength, _ = t.float(e, 0)
+	}
+	md.CaptureDate = captureDate(t, ifd0, exifIFD)
+	md.HasGPS, md.Latitude, md.Longitude, md.Altitude = coordinates(t, gpsIFD)
+	return md, nil
+}
+
+// captureDate returns the date the photo was shot, falling back to the modification date of the file
+// when the original date is missing. Cameras record local times: the offset is used when present,
+// otherwise the date is interpreted as UTC.
+func captureDate(t *tiff, ifd0, exifIFD map[uint16]entry) time.Time {
+	value := t.string(exifIFD[tagDateTimeOriginal])
+	if value == "" {
+		value = t.string(ifd0[tagDateTime])
+	}
+	if value == "" {
+		return time.Time{}
+	}
+	if offset := t.string(exifIFD[tagOffsetTimeOriginal]); offset != "" {
+		if date, err := time.Parse(exifDateOffsetLayout, value+offset); err == nil {
+			return date.UTC()
+		}
+	}
+	date, err := time.Parse(exifDateLayout, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// coordinates converts the degrees, minutes and seconds of the GPS IFD into decimal degrees.
+func coordinates(t *tiff, gpsIFD map[uint16]entry) (bool, float64, float64, float64) {
+	latitude, ok := degrees(t, gpsIFD[tagGPSLatitude])
+	if !ok {
+		return false, 0, 0, 0
+	}
+	longitude, ok := degrees(t, gpsIFD[tagGPSLongitude])
+	if !ok {
+		return false, 0, 0, 0
+	}
+	if t.string(gpsIFD[tagGPSLatitudeRef]) == "S" {
+		latitude = -latitude
+	}
+	if t.string(gpsIFD[tagGPSLongitudeRef]) == "W" {
+		longitude = -longitude
+	}
+
+	var altitude float64
+	if e, ok := gpsIFD[tagGPSAltitude]; ok {
+		altitude, _ = t.float(e, 0)
+		if ref, ok := gpsIFD[tagGPSAltitudeRef]; ok {
+			if below, _ := t.uint(ref, 0); below == 1 {
+				altitude = -altitude
+			}
+		}
+	}
+	return true, latitude, longitude, altitude
+}
+
+// degrees converts a GPS coordinate stored as three rationals into decimal degrees.
+func degrees(t *tiff, e entry) (float64, bool) {
+	if e.count != 3 {
+		return 0, false
+	}
+	var value float64
+	for i, unit := range []float64{1, 60, 3600} {
+		part, ok := t.float(e, uint32(i))
+		if !ok {
+			return 0, false
+		}
+		value += part / unit
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+// formatExposureTime formats an exposure time the way photographers read it: "1/250" or "2".
+func formatExposureTime(num, den int64) string {
+	if num == 0 {
+		return "0"
+	}
+	if num >= den {
+		return fmt.Sprintf("%g", float64(num)/float64(den))
+	}
+	return fmt.Sprintf("1/%d", int64(math.Round(float64(den)/float64(num))))
+}
+
+// JPEG markers used to walk the segments of a file.
+const (
+	markerAPP1 = 0xE1
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+)
+
+// readJPEGSegment reads the next marker of a JPEG and the payload of its segment.
+// Markers without payload, such as EOI, return a nil segment.
+func readJPEGSegment(r *bufio.Reader) (byte, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	if b != 0xFF {
+		return 0, nil, fmt.Errorf("invalid JPEG marker %#x", b)
+	}
+	marker := byte(0xFF)
+	// Markers may be preceded by any number of 0xFF fill bytes.
+	for marker == 0xFF {
+		if marker, err = r.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+	// Standalone markers have no length, and the length of SOS is left for the caller to read
+	// along with the image data.
+	if marker == markerEOI || marker == markerSOS || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+		return marker, nil, nil
+	}
+	var length [2]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint16(length[:]))
+	if size < 2 {
+		return 0, nil, fmt.Errorf("invalid JPEG segment length %d", size)
+	}
+	segment := make([]byte, size-2)
+	if _, err = io.ReadFull(r, segment); err != nil {
+		return 0, nil, err
+	}
+	return marker, segment, nil
+}
+
+// maxKeptChunkSize bounds the size of the PNG chunks loaded in memory. Metadata chunks are only
+// a few kilobytes, anything larger is a corrupted or malicious file.
+const maxKeptChunkSize = 1 << 20
+
+// readPNGChunk reads the next chunk of a PNG. The chunk data is only kept when keep returns true
+// for its type, other chunks are skipped so that image data is never loaded in memory.
+func readPNGChunk(r *bufio.Reader, keep func(chunkType string) bool) (string, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	chunkType := string(header[4:])
+	if !keep(chunkType) {
+		// Skip the data and the CRC.
+		_, err := r.Discard(int(length) + 4)
+		return chunkType, nil, err
+	}
+	if length > maxKeptChunkSize {
+		return "", nil, fmt.Errorf("PNG %s chunk is too large", chunkType)
+	}
+	data := make([]byte, length+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, err
+	}
+	return chunkType, data[:length], nil
+}
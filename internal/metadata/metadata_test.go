@@ -0,0 +1,158 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// field describes an IFD entry used to build test EXIF payloads.
+type field struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // Raw big-endian value.
+}
+
+// buildEXIF builds a big-endian EXIF payload with IFD0, an Exif sub-IFD and a GPS sub-IFD.
+func buildEXIF(ifd0, exifIFD, gpsIFD []field) []byte {
+	// Layout: header (8) | IFD0 | Exif IFD | GPS IFD | values
+	ifdSize := func(fields []field) uint32 { return 2 + uint32(len(fields))*12 + 4 }
+	ifd0 = append(ifd0, field{tag: tagExifIFDPointer, typ: 4, count: 1}, field{tag: tagGPSIFDPointer, typ: 4, count: 1})
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exifIFD)
+	valuesOffset := gpsOffset + ifdSize(gpsIFD)
+
+	buf := new(bytes.Buffer)
+	values := new(bytes.Buffer)
+	buf.WriteString("MM")
+	_ = binary.Write(buf, binary.BigEndian, uint16(42))
+	_ = binary.Write(buf, binary.BigEndian, ifd0Offset)
+	writeIFD := func(fields []field) {
+		_ = binary.Write(buf, binary.BigEndian, uint16(len(fields)))
+		for _, f := range fields {
+			switch f.tag {
+			case tagExifIFDPointer:
+				f.value = binary.BigEndian.AppendUint32(nil, exifOffset)
+			case tagGPSIFDPointer:
+				f.value = binary.BigEndian.AppendUint32(nil, gpsOffset)
+			}
+			_ = binary.Write(buf, binary.BigEndian, f.tag)
+			_ = binary.Write(buf, binary.BigEndian, f.typ)
+			_ = binary.Write(buf, binary.BigEndian, f.count)
+			if len(f.value) <= 4 {
+				inline := make([]byte, 4)
+				copy(inline, f.value)
+				buf.Write(inline)
+			} else {
+				_ = binary.Write(buf, binary.BigEndian, valuesOffset+uint32(values.Len()))
+				values.Write(f.value)
+			}
+		}
+		_ = binary.Write(buf, binary.BigEndian, uint32(0))
+	}
+	writeIFD(ifd0)
+	writeIFD(exifIFD)
+	writeIFD(gpsIFD)
+	buf.Write(values.Bytes())
+	return buf.Bytes()
+}
+
+func ascii(s string) field {
+	return field{typ: 2, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func rationals(values ...uint32) field {
+	var raw []byte
+	for _, v := range values {
+		raw = binary.BigEndian.AppendUint32(raw, v)
+	}
+	return field{typ: 5, count: uint32(len(values) / 2), value: raw}
+}
+
+func withTag(tag uint16, f field) field {
+	f.tag = tag
+	return f
+}
+
+// testEXIF returns a payload recorded by a fictional camera in Saint-Étienne.
+func testEXIF() []byte {
+	return buildEXIF(
+		[]field{
+			withTag(tagModel, ascii("EOS 5D")),
+			{tag: tagOrientation, typ: 3, count: 1, value: []byte{0, 6}},
+		},
+		[]field{
+			withTag(tagExposureTime, rationals(1, 250)),
+			withTag(tagFNumber, rationals(28, 10)),
+			{tag: tagISO, typ: 3, count: 1, value: []byte{0x01, 0x90}},
+			withTag(tagDateTimeOriginal, ascii("2023:11:25 21:30:00")),
+		},
+		[]field{
+			withTag(tagGPSLatitudeRef, ascii("N")),
+			withTag(tagGPSLatitude, rationals(45, 1, 26, 1, 0, 1)),
+			withTag(tagGPSLongitudeRef, ascii("E")),
+			withTag(tagGPSLongitude, rationals(4, 1, 23, 1, 24, 1)),
+		},
+	)
+}
+
+// testJPEG encodes a small JPEG and inserts an APP1 segment holding the EXIF payload right after SOI.
+func testJPEG(t *testing.T, payload []byte) []byte {
+	var encoded bytes.Buffer
+	err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+	assert.NoError(t, err, "Encoding the test JPEG should not fail")
+
+	segment := append(append([]byte{}, exifHeader...), payload...)
+	var out bytes.Buffer
+	out.Write(encoded.Bytes()[:2])
+	out.Write([]byte{0xFF, markerAPP1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
+
+// TestExtractJPEG ensures that the EXIF fields of a JPEG are decoded.
+func TestExtractJPEG(t *testing.T) {
+	md, err := Extract(bytes.NewReader(testJPEG(t, testEXIF())))
+	assert.NoError(t, err, "Extract should not return an error")
+
+	assert.Equal(t, "EOS 5D", md.CameraModel, "Camera model should be read from IFD0")
+	assert.Equal(t, 6, md.Orientation, "Orientation should be read from IFD0")
+	assert.Equal(t, "1/250", md.ExposureTime, "Exposure time should be formatted as a fraction")
+	assert.InDelta(t, 2.8, md.FNumber, 0.001, "F-number should be read from the Exif IFD")
+	assert.Equal(t, 400, md.ISO, "ISO should be read from the Exif IFD")
+	assert.Equal(t, time.Date(2023, 11, 25, 21, 30, 0, 0, time.UTC), md.CaptureDate, "Capture date should be read from DateTimeOriginal")
+	assert.True(t, md.HasGPS, "GPS coordinates should be detected")
+	assert.InDelta(t, 45.4333, md.Latitude, 0.001, "Latitude should be converted to decimal degrees")
+	assert.InDelta(t, 4.39, md.Longitude, 0.001, "Longitude should be converted to decimal degrees")
+}
+
+// TestExtractWithoutEXIF ensures that photos without metadata yield an empty result.
+func TestExtractWithoutEXIF(t *testing.T) {
+	var encoded bytes.Buffer
+	err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil)
+	assert.NoError(t, err, "Encoding the test JPEG should not fail")
+
+	md, err := Extract(&encoded)
+	assert.NoError(t, err, "Extract should not return an error for photos without EXIF")
+	assert.Equal(t, Metadata{}, md, "Photos without EXIF should yield empty metadata")
+
+	md, err = Extract(bytes.NewReader([]byte("not a photo")))
+	assert.NoError(t, err, "Extract should ignore unknown formats")
+	assert.Equal(t, Metadata{}, md, "Unknown formats should yield empty metadata")
+}
+
+// TestExtractCorrupted ensures that a truncated EXIF payload returns an error instead of panicking.
+func TestExtractCorrupted(t *testing.T) {
+	payload := testEXIF()
+	_, err := Extract(bytes.NewReader(testJPEG(t, payload[:12])))
+	assert.Error(t, err, "Extract should report truncated EXIF payloads")
+}
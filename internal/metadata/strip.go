@@ -0,0 +1,508 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Policy controls which metadata is removed from photos before they are served.
+type Policy string
+
+const (
+	StripAll  Policy = "all"  // Remove every metadata segment, only the orientation is kept.
+	StripGPS  Policy = "gps"  // Remove the GPS coordinates and the XMP packets that may hold them, keep the rest of the EXIF data.
+	StripNone Policy = "none" // Serve photos untouched.
+)
+
+// ParsePolicy validates a policy read from a form or from the configuration.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case StripAll, StripGPS, StripNone:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown metadata policy %q", s)
+	}
+}
+
+// JPEG application markers kept when all metadata is stripped: JFIF, the ICC color profile
+// and the Adobe segment are required to display the photo correctly.
+const (
+	markerAPP0  = 0xE0
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerCOM   = 0xFE
+)
+
+// Headers of the XMP packets stored in JPEG APP1 segments, the extended ones hold the rest of large packets.
+var (
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// PNG chunks holding metadata that are dropped when all metadata is stripped.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// PNG text chunks holding XMP packets, or EXIF data written as text by ImageMagick, keyed by their keyword.
+var pngLocationKeywords = map[string]bool{
+	"XML:com.adobe.xmp":     true,
+	"Raw profile type exif": true,
+	"Raw profile type APP1": true,
+	"Raw profile type xmp":  true,
+}
+
+// Strip copies a JPEG, PNG, WebP or GIF photo from src to dst, removing the metadata selected by the policy.
+// Pixel data is copied byte for byte. Other formats are copied untouched.
+func Strip(dst io.Writer, src io.Reader, policy Policy) error {
+	r := bufio.NewReader(src)
+	if policy == StripNone {
+		_, err := io.Copy(dst, r)
+		return err
+	}
+	signature, err := r.Peek(len(webpSignature))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	switch {
+	case bytes.HasPrefix(signature, jpegSignature):
+		return stripJPEG(dst, r, policy)
+	case bytes.HasPrefix(signature, pngSignature):
+		return stripPNG(dst, r, policy)
+	case len(signature) == len(webpSignature) && bytes.Equal(signature[:4], webpSignature[:4]) && bytes.Equal(signature[8:], webpSignature[8:]):
+		return stripWebP(dst, r, policy)
+	case bytes.HasPrefix(signature, gifSignature):
+		return stripGIF(dst, r, policy)
+	default:
+		_, err := io.Copy(dst, r)
+		return err
+	}
+}
+
+// stripJPEG copies the segments of a JPEG preceding the image data, rewriting or dropping
+// the metadata ones, then copies the rest of the file as is.
+func stripJPEG(dst io.Writer, r *bufio.Reader, policy Policy) error {
+	if _, err := r.Discard(len(jpegSignature)); err != nil {
+		return err
+	}
+	if _, err := dst.Write(jpegSignature); err != nil {
+		return err
+	}
+	for {
+		marker, segment, err := readJPEGSegment(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case marker == markerSOS:
+			if _, err := dst.Write([]byte{0xFF, markerSOS}); err != nil {
+				return err
+			}
+			_, err := io.Copy(dst, r)
+			return err
+		case marker == markerEOI || segment == nil:
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			if marker == markerEOI {
+				return nil
+			}
+			continue
+		case marker == markerAPP1 && bytes.HasPrefix(segment, exifHeader):
+			payload, err := sanitizeEXIF(segment[len(exifHeader):], policy)
+			if err != nil {
+				return err
+			}
+			if payload == nil {
+				continue
+			}
+			segment = append(append([]byte{}, exifHeader...), payload...)
+		case policy == StripAll && isJPEGMetadataMarker(marker):
+			continue
+		case marker == markerAPP1 && (bytes.HasPrefix(segment, xmpHeader) || bytes.HasPrefix(segment, xmpExtendedHeader)):
+			// XMP packets may repeat the coordinates of the EXIF data
+			continue
+		}
+		if err := writeJPEGSegment(dst, marker, segment); err != nil {
+			return err
+		}
+	}
+}
+
+// isJPEGMetadataMarker reports if a segment only holds metadata (EXIF, XMP, IPTC, comments, maker notes...).
+func isJPEGMetadataMarker(marker byte) bool {
+	isApp := marker >= markerAPP0 && marker <= markerAPP0+15
+	return marker == markerCOM || (isApp && marker != markerAPP0 && marker != markerAPP2 && marker != markerAPP14)
+}
+
+// writeJPEGSegment writes a marker followed by the length and the payload of its segment.
+func writeJPEGSegment(dst io.Writer, marker byte, segment []byte) error {
+	if len(segment)+2 > 0xFFFF {
+		return fmt.Errorf("JPEG segment %#x is too large", marker)
+	}
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	_, err := dst.Write(segment)
+	return err
+}
+
+// stripPNG copies the chunks of a PNG, rewriting or dropping the metadata ones.
+func stripPNG(dst io.Writer, r *bufio.Reader, policy Policy) error {
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return err
+	}
+	if _, err := dst.Write(pngSignature); err != nil {
+		return err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		chunkType := string(header[4:])
+
+		if chunkType == "eXIf" {
+			if length > maxKeptChunkSize {
+				return fmt.Errorf("PNG %s chunk is too large", chunkType)
+			}
+			data := make([]byte, length+4)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			payload, err := sanitizeEXIF(data[:length], policy)
+			if err != nil {
+				return err
+			}
+			if payload != nil {
+				if err := writePNGChunk(dst, chunkType, payload); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		drop := policy == StripAll && pngMetadataChunks[chunkType]
+		if policy == StripGPS && (chunkType == "tEXt" || chunkType == "zTXt" || chunkType == "iTXt") {
+			// Keywords are at most 79 bytes long and end with a null byte
+			keyword, _ := r.Peek(min(int(length), 80))
+			if end := bytes.IndexByte(keyword, 0); end >= 0 {
+				drop = pngLocationKeywords[string(keyword[:end])]
+			}
+		}
+		if drop {
+			if _, err := r.Discard(int(length) + 4); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Copy the chunk, its data and its CRC untouched.
+		if _, err := dst.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, r, int64(length)+4); err != nil {
+			return err
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// writePNGChunk writes a chunk along with its length and CRC.
+func writePNGChunk(dst io.Writer, chunkType string, data []byte) error {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[:4], uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := dst.Write(chunk)
+	return err
+}
+
+// Signatures of the WebP and GIF containers. The 4 bytes following RIFF hold the size of the file.
+var (
+	webpSignature = []byte("RIFF\x00\x00\x00\x00WEBP")
+	gifSignature  = []byte("GIF8")
+)
+
+// Flags of the VP8X chunk of WebP telling which metadata chunks follow.
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+// stripWebP copies the chunks of a WebP, rewriting the EXIF chunk and blanking the XMP ones. The size of every
+// chunk is kept so that the size of the file, written before them, stays right: XMP chunks become JUNK chunks,
+// which readers skip, and the sanitized EXIF data is padded with zeros.
+func stripWebP(dst io.Writer, r *bufio.Reader, policy Policy) error {
+	if _, err := io.CopyN(dst, r, int64(len(webpSignature))); err != nil {
+		return err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		chunkType := string(header[:4])
+		// Chunks are padded to an even size
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		size += size & 1
+
+		switch chunkType {
+		case "VP8X", "EXIF":
+			if size > maxKeptChunkSize {
+				return fmt.Errorf("WebP %s chunk is too large", chunkType)
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			if chunkType == "VP8X" && len(data) > 0 {
+				data[0] &^= webpFlagXMP
+			} else if chunkType == "EXIF" {
+				data = sanitizeWebPEXIF(data, policy)
+			}
+			if _, err := dst.Write(header[:]); err != nil {
+				return err
+			}
+			if _, err := dst.Write(data); err != nil {
+				return err
+			}
+		case "XMP ":
+			copy(header[:4], "JUNK")
+			if _, err := dst.Write(header[:]); err != nil {
+				return err
+			}
+			if _, err := r.Discard(int(size)); err != nil {
+				return err
+			}
+			if _, err := dst.Write(make([]byte, size)); err != nil {
+				return err
+			}
+		default:
+			if _, err := dst.Write(header[:]); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(dst, r, size); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sanitizeWebPEXIF applies the policy to the data of a WebP EXIF chunk, which some writers start with the
+// header of the JPEG segments, and returns data of the same size. Dropped metadata leaves an empty EXIF structure,
+// as the VP8X chunk announcing it was already written.
+func sanitizeWebPEXIF(data []byte, policy Policy) []byte {
+	prefix := 0
+	if bytes.HasPrefix(data, exifHeader) {
+		prefix = len(exifHeader)
+	}
+	payload, err := sanitizeEXIF(data[prefix:], policy)
+	if err != nil || payload == nil {
+		payload = []byte("MM\x00\x2A\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00") // No entry and no next IFD.
+	}
+	sanitized := make([]byte, len(data))
+	copy(sanitized, data[:prefix])
+	if copy(sanitized[prefix:], payload) < len(payload) {
+		// Too short to hold a valid structure, so it held no readable metadata either
+		clear(sanitized)
+	}
+	return sanitized
+}
+
+// GIF blocks walked by stripGIF.
+const (
+	gifExtension   = 0x21
+	gifImage       = 0x2C
+	gifTrailer     = 0x3B
+	gifComment     = 0xFE
+	gifApplication = 0xFF
+)
+
+// GIF application extensions kept when all metadata is stripped, as they hold the number of loops of animations.
+var gifLoopApplications = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+// stripGIF copies the blocks of a GIF, dropping the comments and application extensions selected by the policy:
+// every one but the loop count when all metadata is stripped, and the XMP packets when GPS data is.
+func stripGIF(dst io.Writer, r *bufio.Reader, policy Policy) error {
+	// The header is followed by the logical screen descriptor and the global color table
+	var header [13]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	if _, err := dst.Write(header[:]); err != nil {
+		return err
+	}
+	if flags := header[10]; flags&0x80 != 0 {
+		if _, err := io.CopyN(dst, r, 3<<(flags&0x07+1)); err != nil {
+			return err
+		}
+	}
+	for {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch introducer {
+		case gifTrailer:
+			_, err := dst.Write([]byte{introducer})
+			return err
+		case gifImage:
+			// The image descriptor is followed by the local color table and the LZW code size
+			var descriptor [9]byte
+			if _, err := io.ReadFull(r, descriptor[:]); err != nil {
+				return err
+			}
+			if _, err := dst.Write(append([]byte{introducer}, descriptor[:]...)); err != nil {
+				return err
+			}
+			size := int64(1)
+			if flags := descriptor[8]; flags&0x80 != 0 {
+				size += 3 << (flags&0x07 + 1)
+			}
+			if _, err := io.CopyN(dst, r, size); err != nil {
+				return err
+			}
+			if err := copyGIFSubBlocks(dst, r); err != nil {
+				return err
+			}
+		case gifExtension:
+			label, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			block := []byte{introducer, label}
+			drop := label == gifComment && policy == StripAll
+			if label == gifApplication {
+				// The first sub-block holds the identifier and the authentication code of the application
+				size, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				id := make([]byte, size)
+				if _, err := io.ReadFull(r, id); err != nil {
+					return err
+				}
+				block = append(append(block, size), id...)
+				drop = (policy == StripAll && !gifLoopApplications[string(id)]) || string(id) == "XMP DataXMP"
+			}
+			out := dst
+			if drop {
+				out = io.Discard
+			}
+			if _, err := out.Write(block); err != nil {
+				return err
+			}
+			if err := copyGIFSubBlocks(out, r); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid GIF block %#x", introducer)
+		}
+	}
+}
+
+// copyGIFSubBlocks copies the data sub-blocks of a GIF block, up to the empty one ending them.
+func copyGIFSubBlocks(dst io.Writer, r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if _, err := dst.Write([]byte{size}); err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := io.CopyN(dst, r, int64(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// sanitizeEXIF applies the policy to an EXIF payload. A nil payload means the metadata must be dropped.
+func sanitizeEXIF(payload []byte, policy Policy) ([]byte, error) {
+	switch policy {
+	case StripGPS:
+		sanitized, err := removeGPS(payload)
+		if err != nil {
+			// Unreadable metadata may still hold coordinates, it is dropped entirely.
+			return nil, nil
+		}
+		return sanitized, nil
+	case StripAll:
+		md, err := parse(payload)
+		if err != nil || md.Orientation <= 1 {
+			return nil, nil
+		}
+		return orientationOnly(md.Orientation), nil
+	default:
+		return payload, nil
+	}
+}
+
+// removeGPS empties the GPS IFD of an EXIF payload: its entries and the values they point to are zeroed,
+// and its entry count is set to zero so that readers see an empty IFD.
+func removeGPS(payload []byte) ([]byte, error) {
+	t, err := newTIFF(bytes.Clone(payload))
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := t.ifd(t.firstIFD())
+	if err != nil {
+		return nil, err
+	}
+	pointer, ok := ifd0[tagGPSIFDPointer]
+	if !ok {
+		return t.data, nil
+	}
+	offset, ok := t.uint(pointer, 0)
+	if !ok {
+		return nil, errInvalidTIFF
+	}
+	entries, err := t.entries(offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		clear(t.data[e.valueOffset : e.valueOffset+typeSizes[e.typ]*e.count])
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	clear(t.data[offset : offset+2+count*12])
+	return t.data, nil
+}
+
+// orientationOnly builds a minimal big-endian EXIF payload holding only the orientation,
+// so that photos stripped of their metadata are still displayed upright.
+func orientationOnly(orientation int) []byte {
+	payload := []byte("MM\x00\x2A\x00\x00\x00\x08")
+	payload = binary.BigEndian.AppendUint16(payload, 1)              // One entry.
+	payload = binary.BigEndian.AppendUint16(payload, tagOrientation) // Tag.
+	payload = binary.BigEndian.AppendUint16(payload, 3)              // SHORT.
+	payload = binary.BigEndian.AppendUint32(payload, 1)              // One value.
+	payload = binary.BigEndian.AppendUint16(payload, uint16(orientation))
+	payload = append(payload, 0, 0)                  // Padding of the inline value.
+	return binary.BigEndian.AppendUint32(payload, 0) // No next IFD.
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testXMP is an XMP packet repeating the coordinates of testEXIF.
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+	`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="45,26.0N" exif:GPSLongitude="4,23.4E"/>` +
+	`</rdf:RDF></x:xmpmeta>`
+
+// TestStripJPEG ensures that each policy removes the expected metadata while keeping the photo readable.
+func TestStripJPEG(t *testing.T) {
+	encoded := testJPEG(t, testEXIF())
+	var xmp bytes.Buffer
+	assert.NoError(t, writeJPEGSegment(&xmp, markerAPP1, append(append([]byte{}, xmpHeader...), testXMP...)))
+	photo := append(append(append([]byte{}, encoded[:len(jpegSignature)]...), xmp.Bytes()...), encoded[len(jpegSignature):]...)
+
+	var withoutGPS bytes.Buffer
+	err := Strip(&withoutGPS, bytes.NewReader(photo), StripGPS)
+	assert.NoError(t, err, "Stripping GPS data should not return an error")
+	md, err := Extract(bytes.NewReader(withoutGPS.Bytes()))
+	assert.NoError(t, err, "Metadata stripped of GPS data should still be readable")
+	assert.False(t, md.HasGPS, "GPS coordinates should be removed")
+	assert.Equal(t, "EOS 5D", md.CameraModel, "Other metadata should be kept")
+	assert.NotContains(t, withoutGPS.String(), "GPSLatitude", "XMP packets should be removed")
+	_, err = jpeg.Decode(bytes.NewReader(withoutGPS.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+
+	var withoutAll bytes.Buffer
+	err = Strip(&withoutAll, bytes.NewReader(photo), StripAll)
+	assert.NoError(t, err, "Stripping all metadata should not return an error")
+	md, err = Extract(bytes.NewReader(withoutAll.Bytes()))
+	assert.NoError(t, err, "The minimal metadata should be readable")
+	assert.Equal(t, Metadata{Orientation: 6}, md, "Only the orientation should be kept")
+	_, err = jpeg.Decode(bytes.NewReader(withoutAll.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+
+	var untouched bytes.Buffer
+	err = Strip(&untouched, bytes.NewReader(photo), StripNone)
+	assert.NoError(t, err, "Keeping metadata should not return an error")
+	assert.Equal(t, photo, untouched.Bytes(), "The photo should be copied untouched")
+}
+
+// TestStripPNG ensures that text chunks and EXIF are removed from PNG photos.
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	assert.NoError(t, err, "Encoding the test PNG should not fail")
+
+	// Insert the metadata chunks right after IHDR, which is 8+4+4+13+4 bytes long with the signature.
+	ihdrEnd := len(pngSignature) + 25
+	var photo bytes.Buffer
+	photo.Write(encoded.Bytes()[:ihdrEnd])
+	assert.NoError(t, writePNGChunk(&photo, "tEXt", []byte("Author\x00John Doe")))
+	assert.NoError(t, writePNGChunk(&photo, "eXIf", testEXIF()))
+	assert.NoError(t, writePNGChunk(&photo, "iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+testXMP)))
+	photo.Write(encoded.Bytes()[ihdrEnd:])
+
+	md, err := Extract(bytes.NewReader(photo.Bytes()))
+	assert.NoError(t, err, "Extract should read the eXIf chunk")
+	assert.True(t, md.HasGPS, "The test PNG should hold GPS coordinates")
+
+	var withoutGPS bytes.Buffer
+	err = Strip(&withoutGPS, bytes.NewReader(photo.Bytes()), StripGPS)
+	assert.NoError(t, err, "Stripping GPS data should not return an error")
+	md, err = Extract(bytes.NewReader(withoutGPS.Bytes()))
+	assert.NoError(t, err, "The rewritten eXIf chunk should be readable")
+	assert.False(t, md.HasGPS, "GPS coordinates should be removed")
+	assert.Contains(t, withoutGPS.String(), "John Doe", "Text chunks should be kept when only GPS data is stripped")
+	assert.NotContains(t, withoutGPS.String(), "GPSLatitude", "XMP chunks should be removed")
+	_, err = png.Decode(bytes.NewReader(withoutGPS.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+
+	var withoutAll bytes.Buffer
+	err = Strip(&withoutAll, bytes.NewReader(photo.Bytes()), StripAll)
+	assert.NoError(t, err, "Stripping all metadata should not return an error")
+	assert.NotContains(t, withoutAll.String(), "John Doe", "Text chunks should be removed")
+	_, err = png.Decode(bytes.NewReader(withoutAll.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+}
+
+// TestStripWebP ensures that the EXIF chunk of WebP photos is sanitized and their XMP chunks blanked, without
+// changing the size of the file.
+func TestStripWebP(t *testing.T) {
+	chunk := func(chunkType string, data []byte) []byte {
+		c := binary.LittleEndian.AppendUint32([]byte(chunkType), uint32(len(data)))
+		c = append(c, data...)
+		if len(data)%2 == 1 {
+			c = append(c, 0)
+		}
+		return c
+	}
+	var body []byte
+	body = append(body, chunk("VP8X", []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 3, 0, 0, 3, 0, 0})...)
+	body = append(body, chunk("VP8L", []byte("pixels"))...)
+	body = append(body, chunk("EXIF", testEXIF())...)
+	body = append(body, chunk("XMP ", []byte(testXMP))...)
+	photo := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)+4))
+	photo = append(append(photo, "WEBP"...), body...)
+
+	// chunks returns the data of the chunks of a stripped photo by type.
+	chunks := func(photo []byte) map[string][]byte {
+		found := map[string][]byte{}
+		for data := photo[len(webpSignature):]; len(data) >= 8; {
+			size := int(binary.LittleEndian.Uint32(data[4:8]))
+			found[string(data[:4])] = data[8 : 8+size]
+			data = data[8+size+size%2:]
+		}
+		return found
+	}
+
+	var withoutGPS bytes.Buffer
+	err := Strip(&withoutGPS, bytes.NewReader(photo), StripGPS)
+	assert.NoError(t, err, "Stripping GPS data should not return an error")
+	assert.Len(t, withoutGPS.Bytes(), len(photo), "The size of the file should be kept")
+	found := chunks(withoutGPS.Bytes())
+	md, err := parse(found["EXIF"])
+	assert.NoError(t, err, "The rewritten EXIF chunk should be readable")
+	assert.False(t, md.HasGPS, "GPS coordinates should be removed")
+	assert.Equal(t, "EOS 5D", md.CameraModel, "Other metadata should be kept")
+	assert.NotContains(t, found, "XMP ", "XMP chunks should be removed")
+	assert.Contains(t, found, "JUNK", "XMP chunks should be replaced by JUNK chunks")
+	assert.Zero(t, found["VP8X"][0]&webpFlagXMP, "The XMP flag should be cleared")
+	assert.Equal(t, []byte("pixels"), found["VP8L"], "Image data should be copied untouched")
+
+	var withoutAll bytes.Buffer
+	err = Strip(&withoutAll, bytes.NewReader(photo), StripAll)
+	assert.NoError(t, err, "Stripping all metadata should not return an error")
+	assert.Len(t, withoutAll.Bytes(), len(photo), "The size of the file should be kept")
+	md, err = parse(chunks(withoutAll.Bytes())["EXIF"])
+	assert.NoError(t, err, "The minimal EXIF chunk should be readable")
+	assert.Equal(t, Metadata{Orientation: 6}, md, "Only the orientation should be kept")
+}
+
+// TestStripGIF ensures that comments and XMP packets are removed from GIF photos, and that the loop count of
+// animations is kept.
+func TestStripGIF(t *testing.T) {
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White})
+	var encoded bytes.Buffer
+	err := gif.EncodeAll(&encoded, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 0})
+	assert.NoError(t, err, "Encoding the test GIF should not fail")
+
+	// Insert the extensions right after the logical screen descriptor and its global color table, if any.
+	headerEnd := 13
+	if flags := encoded.Bytes()[10]; flags&0x80 != 0 {
+		headerEnd += 3 << (flags&0x07 + 1)
+	}
+	xmp := append([]byte{gifExtension, gifApplication, 11}, "XMP DataXMP"...)
+	xmp = append(append(xmp, testXMP...), 0x01) // Written raw, the packet is read as sub-blocks up to a magic trailer.
+	for i := 0xFF; i >= 0; i-- {
+		xmp = append(xmp, byte(i))
+	}
+	xmp = append(xmp, 0)
+	comment := append([]byte{gifExtension, gifComment, 8}, "John Doe"...)
+	comment = append(comment, 0)
+	var photo bytes.Buffer
+	photo.Write(encoded.Bytes()[:headerEnd])
+	photo.Write(comment)
+	photo.Write(xmp)
+	photo.Write(encoded.Bytes()[headerEnd:])
+	_, err = gif.DecodeAll(bytes.NewReader(photo.Bytes()))
+	assert.NoError(t, err, "The test GIF should decode")
+
+	var withoutGPS bytes.Buffer
+	err = Strip(&withoutGPS, bytes.NewReader(photo.Bytes()), StripGPS)
+	assert.NoError(t, err, "Stripping GPS data should not return an error")
+	assert.NotContains(t, withoutGPS.String(), "GPSLatitude", "XMP packets should be removed")
+	assert.Contains(t, withoutGPS.String(), "John Doe", "Comments should be kept when only GPS data is stripped")
+	_, err = gif.DecodeAll(bytes.NewReader(withoutGPS.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+
+	var withoutAll bytes.Buffer
+	err = Strip(&withoutAll, bytes.NewReader(photo.Bytes()), StripAll)
+	assert.NoError(t, err, "Stripping all metadata should not return an error")
+	assert.NotContains(t, withoutAll.String(), "John Doe", "Comments should be removed")
+	assert.Contains(t, withoutAll.String(), "NETSCAPE2.0", "The loop count should be kept")
+	decoded, err := gif.DecodeAll(bytes.NewReader(withoutAll.Bytes()))
+	assert.NoError(t, err, "The sanitized photo should still decode")
+	assert.Len(t, decoded.Image, 2, "Every frame should be kept")
+}
+
+// TestOrientationOnly ensures that the minimal payload is a valid EXIF structure.
+func TestOrientationOnly(t *testing.T) {
+	md, err := parse(orientationOnly(8))
+	assert.NoError(t, err, "The minimal payload should parse")
+	assert.Equal(t, 8, md.Orientation, "The orientation should be preserved")
+	assert.Equal(t, uint16(1), binary.BigEndian.Uint16(orientationOnly(8)[8:]), "The payload should hold a single entry")
+}
@@ -28,52 +28,69 @@ func MaxBodySize(size int64) func(http.Handler) http.Handler {
 func AuthRestricted(cfg handlers.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie(cfg.Security.Session.CookieName)
-			if err != nil {
+			r, ok := authenticate(cfg, r)
+			if !ok {
 				redirectToLanding(w, r, cfg)
 				return
 			}
-			var data map[string]string
-			err = cfg.Security.Session.SecureCookie.Decode(cfg.Security.Session.CookieName, cookie.Value, &data)
-			if err != nil {
-				redirectToLanding(w, r, cfg)
-				return
-			}
-			sessionToken, ok := data[cfg.Security.Session.CookieName]
-			if !ok || sessionToken == "" {
-				redirectToLanding(w, r, cfg)
-				return
-			}
-			session, err := cfg.DB.GetSessionWithToken(r.Context(), sessionToken)
-			if err != nil {
-				redirectToLanding(w, r, cfg)
-				return
-			}
-			if session.CreationDate.Add(cfg.Security.Session.CookieMaxAge).Before(time.Now()) {
-				redirectToLanding(w, r, cfg)
-				return
-			}
-			userInfo, err := cfg.DB.GetUserWithSession(r.Context(), sessionToken)
-			if err != nil {
-				redirectToLanding(w, r, cfg)
-				return
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OptionalAuth creates a middleware that adds the session and the user to the request context like AuthRestricted
+// when the session cookie is valid, and lets anonymous requests through untouched.
+func OptionalAuth(cfg handlers.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authenticated, ok := authenticate(cfg, r); ok {
+				r = authenticated
 			}
-			ctx := context.WithValue(r.Context(), cfg.Security.Session.CookieName, sessionToken)
-			ctx = context.WithValue(ctx, "userInfo", userInfo)
-			r = r.WithContext(ctx)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// authenticate checks the session cookie of a request. If the session is valid, it returns the request
+// with the session token and the user in its context.
+func authenticate(cfg handlers.Config, r *http.Request) (*http.Request, bool) {
+	cookie, err := r.Cookie(cfg.Security.Session.CookieName)
+	if err != nil {
+		return r, false
+	}
+	var data map[string]string
+	err = cfg.Security.Session.SecureCookie.Decode(cfg.Security.Session.CookieName, cookie.Value, &data)
+	if err != nil {
+		return r, false
+	}
+	sessionToken, ok := data[cfg.Security.Session.CookieName]
+	if !ok || sessionToken == "" {
+		return r, false
+	}
+	session, err := cfg.DB.GetSessionWithToken(r.Context(), sessionToken)
+	if err != nil {
+		return r, false
+	}
+	if session.CreationDate.Add(cfg.Security.Session.CookieMaxAge).Before(time.Now()) {
+		return r, false
+	}
+	userInfo, err := cfg.DB.GetUserWithSession(r.Context(), sessionToken)
+	if err != nil {
+		return r, false
+	}
+	ctx := context.WithValue(r.Context(), cfg.Security.Session.CookieName, sessionToken)
+	ctx = context.WithValue(ctx, "userInfo", userInfo)
+	return r.WithContext(ctx), true
+}
+
 // AdminRestricted creates a middleware that restricts access to administrators only.
 // If the user is not an administrator the request is rejected.
 // AuthRestricted must be applied before this middleware to ensure the session is authenticated.
 func AdminRestricted(cfg handlers.Config) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userInfo := r.Context().Value(cfg.Security.Session.CookieName).(query.User)
-			if !userInfo.IsAdmin {
+			userInfo, ok := r.Context().Value("userInfo").(query.User)
+			if !ok || !userInfo.IsAdmin {
 				handlers.RespondWithMessage(w, "Sorry you're not an admin", http.StatusUnauthorized)
 				return
 			}
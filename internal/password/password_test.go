@@ -0,0 +1,41 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHashVerify ensures that a hash only matches the password it was derived from.
+func TestHashVerify(t *testing.T) {
+	hash, err := Hash("gala2024")
+	assert.NoError(t, err, "Hash should not return an error")
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"), "Hashes should use the PHC format of argon2id")
+
+	ok, err := Verify("gala2024", hash)
+	assert.NoError(t, err, "Verify should accept its own hashes")
+	assert.True(t, ok, "The right password should match")
+
+	ok, err = Verify("gala2025", hash)
+	assert.NoError(t, err, "Verify should accept its own hashes")
+	assert.False(t, ok, "A wrong password should not match")
+
+	other, err := Hash("gala2024")
+	assert.NoError(t, err, "Hash should not return an error")
+	assert.NotEqual(t, hash, other, "Hashes of the same password should be salted differently")
+}
+
+// TestVerifyInvalidHash ensures that malformed hashes are reported rather than treated as a mismatch.
+func TestVerifyInvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"gala2024",
+		"$2a$10$abcdefghijklmnopqrstuv",
+		"$argon2id$v=19$m=65536,t=3,p=2$!!!$abc",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$a2V5",
+	} {
+		_, err := Verify("gala2024", hash)
+		assert.ErrorIs(t, err, ErrInvalidHash, "Verify should reject %q", hash)
+	}
+}
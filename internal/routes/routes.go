@@ -1,10 +1,10 @@
 package routes
 
 import (
-	"fmt"
 	"net/http"
 	"photos/internal/handlers"
 	"photos/internal/middlewares"
+	"photos/internal/tus"
 	"strings"
 	"time"
 
@@ -23,31 +23,119 @@ func Service(cfg handlers.Config) http.Handler {
 	loadGlobalMiddlewares(r, cfg)
 
 	r.NotFound(cfg.ServeNotFoundHandler)
-	r.Get(cfg.Routes.Favicon, handlers.ServeFaviconHandler)
-	r.Get("/htmx.min.js", handlers.ServeHtmxScriptHandler)
-	r.Get(cfg.Routes.Landing, cfg.ServeLandingHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(cfg.Server.RequestContextTimeout))
+		r.Get(cfg.Routes.Favicon, handlers.ServeFaviconHandler)
+		r.Get("/htmx.min.js", handlers.ServeHtmxScriptHandler)
+		r.Get(cfg.Routes.Landing, cfg.ServeLandingHandler)
 
+		r.Group(func(r chi.Router) {
+			r.Use(httprate.Limit(
+				10,
+				time.Minute,
+				httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+				httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				}),
+			))
+			r.Get(cfg.Routes.Login, cfg.LoginHandler)
+			r.Get(cfg.Routes.CasCallback, cfg.CasCallbackHandler)
+		})
+		r.Group(func(r chi.Router) {
+			// Photos are selected by query parameters, which are part of the key so that a gallery
+			// can load its thumbnails while a single photo still cannot be hammered.
+			r.Use(httprate.Limit(
+				10,
+				time.Minute,
+				httprate.WithKeyFuncs(httprate.KeyByIP, func(r *http.Request) (string, error) { return r.URL.RequestURI(), nil }),
+				httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				}),
+			))
+			r.Use(middlewares.OptionalAuth(cfg))
+			r.Get(cfg.Routes.PhotoFile, cfg.PhotoHandler)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.AuthRestricted(cfg))
+			r.Get(cfg.Routes.Dashboard, cfg.ServeDashboardHandler)
+			r.Get(cfg.Routes.Logout, cfg.LogoutHandler)
+			r.Get(cfg.Routes.Event, cfg.ServeEventHandler)
+			r.Get(cfg.Routes.Photos, cfg.ServePhotosPage)
+			r.Post("/create-event", cfg.CreateEventHandler)
+			r.Post("/upload-photos", cfg.UploadPhotosHandler)
+			r.Get(cfg.Routes.Tag, cfg.ServeTagHandler)
+			r.Get(cfg.Routes.TagSuggestions, cfg.TagSuggestionsHandler)
+			r.Get(cfg.Routes.PhotoTags, cfg.PhotoTagsHandler)
+			r.Post(cfg.Routes.PhotoTags, cfg.TagPhotoHandler)
+			r.Get(cfg.Routes.Search, cfg.SearchHandler)
+			r.Post(cfg.Routes.ReportPhoto, cfg.ReportPhotoHandler)
+			r.Get(cfg.Routes.Folders, cfg.ServeFoldersHandler)
+			r.Get(cfg.Routes.Folder, cfg.ServeFolderHandler)
+			r.Post(cfg.Routes.Folder+"/create", cfg.CreateFolderHandler)
+			r.Post(cfg.Routes.Folder+"/update", cfg.UpdateFolderHandler)
+			r.Post(cfg.Routes.Folder+"/delete", cfg.DeleteFolderHandler)
+			r.Post(cfg.Routes.Folder+"/photos", cfg.AddPhotoToFolderHandler)
+			r.Post(cfg.Routes.Folder+"/photos/remove", cfg.RemovePhotoFromFolderHandler)
+			r.Post(cfg.Routes.Folder+"/share", cfg.ShareFolderHandler)
+			r.Post(cfg.Routes.Folder+"/unshare", cfg.UnshareFolderHandler)
+			r.Get(cfg.Routes.PhotoPeople, cfg.PhotoPeopleHandler)
+			r.Post(cfg.Routes.PhotoPeople, cfg.TagPersonHandler)
+			r.Post(cfg.Routes.PhotoPeople+"/remove", cfg.UntagPersonHandler)
+			r.Get(cfg.Routes.UserSuggestions, cfg.UserSuggestionsHandler)
+			r.Get(cfg.Routes.MyPhotos, cfg.ServeMyPhotosHandler)
+			r.Get(cfg.Routes.SimilarPhotos, cfg.SimilarPhotosHandler)
+		})
+		r.Group(func(r chi.Router) {
+			// Event passwords are limited like logins so that they cannot be guessed
+			r.Use(middlewares.AuthRestricted(cfg))
+			r.Use(httprate.Limit(
+				10,
+				time.Minute,
+				httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+				httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				}),
+			))
+			r.Post(cfg.Routes.EventUnlock, cfg.UnlockEventHandler)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.AuthRestricted(cfg), middlewares.AdminRestricted(cfg))
+			r.Get(cfg.Routes.OriginalPhotoFile, cfg.OriginalPhotoHandler)
+			r.Post(cfg.Routes.MetadataPolicy, cfg.UpdateEventMetadataPolicyHandler)
+			r.Post(cfg.Routes.EventPassword, cfg.SetEventPasswordHandler)
+			r.Post(cfg.Routes.Event+"/update", cfg.UpdateEventHandler)
+			r.Post(cfg.Routes.Event+"/delete", cfg.DeleteEventHandler)
+			r.Post(cfg.Routes.Event+"/cover", cfg.SetEventCoverHandler)
+			r.Get(cfg.Routes.Trash, cfg.ServeTrashHandler)
+			r.Get(cfg.Routes.Reports, cfg.ServeReportsHandler)
+			r.Post(cfg.Routes.Reports+"/moderate", cfg.ModerateReportsHandler)
+			r.Post(cfg.Routes.HidePhoto, cfg.HidePhotoHandler)
+			r.Post(cfg.Routes.DeletePhoto, cfg.DeletePhotoHandler)
+			r.Post(cfg.Routes.RestorePhoto, cfg.RestorePhotoHandler)
+			r.Post(cfg.Routes.BulkPhotos, cfg.BulkPhotosHandler)
+			r.Post(cfg.Routes.PhotoTags+"/remove", cfg.UntagPhotoHandler)
+			r.Post(cfg.Routes.Tag+"/curate", cfg.CurateTagHandler)
+			r.Get(cfg.Routes.Duplicates, cfg.ServeDuplicatesHandler)
+			r.Post(cfg.Routes.Duplicates+"/hash", cfg.HashEventPhotosHandler)
+			r.Get(cfg.Routes.Jobs, cfg.ServeJobsHandler)
+			r.Post(cfg.Routes.Jobs+"/requeue", cfg.RequeueJobHandler)
+			r.Get(cfg.Routes.StorageCheck, cfg.ServeStorageCheckHandler)
+			r.Post(cfg.Routes.StorageCheck+"/repair", cfg.RepairStorageHandler)
+		})
+	})
 	r.Group(func(r chi.Router) {
-		r.Use(httprate.Limit(
-			10,
-			time.Minute,
-			httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
-			httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
-			}),
-		))
-		r.Get(cfg.Routes.Login, cfg.LoginHandler)
-		r.Get(cfg.Routes.CasCallback, cfg.CasCallbackHandler)
-		r.Get(fmt.Sprintf("%s/{}", strings.TrimPrefix(cfg.PhotosDir, ".")), cfg.PhotoHandler)
+		// Archives are streamed for as long as the download takes, so they are not subject to the request timeout
+		r.Use(middlewares.AuthRestricted(cfg))
+		r.Get(cfg.Routes.EventArchive, cfg.EventArchiveHandler)
 	})
 	r.Group(func(r chi.Router) {
+		// Upload chunks are received for as long as the connection of the client takes
 		r.Use(middlewares.AuthRestricted(cfg))
-		r.Get(cfg.Routes.Dashboard, cfg.ServeDashboardHandler)
-		r.Get(cfg.Routes.Logout, cfg.LogoutHandler)
-		r.Get(cfg.Routes.Event, cfg.ServeEventHandler)
-		r.Get(cfg.Routes.Photos, cfg.ServePhotosPage)
-		r.Post("/create-event", cfg.CreateEventHandler)
-		r.Post("/upload-photos", cfg.UploadPhotosHandler)
+		r.Options(cfg.Routes.Uploads, cfg.TusOptionsHandler)
+		r.Post(cfg.Routes.Uploads, cfg.CreateUploadHandler)
+		r.Head(cfg.Routes.Uploads+"/{upload_id}", cfg.HeadUploadHandler)
+		r.Patch(cfg.Routes.Uploads+"/{upload_id}", cfg.PatchUploadHandler)
+		r.Delete(cfg.Routes.Uploads+"/{upload_id}", cfg.DeleteUploadHandler)
 	})
 	return r
 }
@@ -69,16 +157,15 @@ func loadGlobalMiddlewares(r *chi.Mux, cfg handlers.Config) {
 	}))
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 	r.Use(middleware.AllowContentEncoding("gzip", "deflate", "gzip/deflate", "deflate/gzip"))
-	r.Use(middleware.AllowContentType("application/json", "application/x-www-form-urlencoded", "multipart/form-data"))
+	r.Use(middleware.AllowContentType("application/json", "application/x-www-form-urlencoded", "multipart/form-data", tus.ContentType))
 	r.Use(middleware.CleanPath, middleware.RedirectSlashes)
 	r.Use(middleware.Compress(4, "application/json", "application/x-www-form-urlencoded"))
-	r.Use(middleware.Timeout(cfg.Server.RequestContextTimeout))
 	// r.Use(csrf.Protect(
 	// 	cfg.Security.Csrf.Secret,
 	// 	csrf.MaxAge(int(cfg.Security.Csrf.CookieMaxAge.Seconds())),
@@ -89,12 +176,24 @@ func loadGlobalMiddlewares(r *chi.Mux, cfg handlers.Config) {
 	// 	csrf.FieldName(cfg.Security.Csrf.FieldName),
 	// 	csrf.CookieName(cfg.Security.Csrf.CookieName),
 	// ))
-	r.Use(httprate.Limit(
+	limiter := httprate.Limit(
 		60,
 		time.Minute,
 		httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
 		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
 		}),
-	))
+	)
+	r.Use(func(next http.Handler) http.Handler {
+		limited := limiter(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A page loads the files of dozens of photos from the same path, they have their own limiter keyed by photo.
+			// A batch upload creates every file with a request to the same path, which only authenticated users reach.
+			if r.URL.Path == cfg.Routes.PhotoFile || r.URL.Path == cfg.Routes.Uploads || strings.HasPrefix(r.URL.Path, cfg.Routes.Uploads+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	})
 }
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempPrefix starts the names of the files being written, which are hidden from listings.
+const tempPrefix = ".upload-"
+
+// Local stores the objects as files in a directory of the local filesystem, keys being their relative paths.
+type Local struct {
+	dir string // Root directory of the storage.
+}
+
+// NewLocal creates the directory if needed and returns a storage keeping its objects in it.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+// path returns the location on disk of the object stored under key.
+func (l *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file renamed once complete, so that a failed write
+// never leaves a truncated file behind a key.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	written, err := io.Copy(tmpFile, r)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file to disk: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("wrote %d bytes to %s, expected %d", written, key, size)
+	}
+	if err = os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to move file in place: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) (File, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (l *Local) Stat(ctx context.Context, key string) (Info, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && fileInfo.IsDir()) {
+		return Info{}, ErrNotExist
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the deepest directory containing every key starting with prefix.
+func (l *Local) List(ctx context.Context, prefix string, fn func(Info) error) error {
+	root := l.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		path, err := l.path(prefix[:i])
+		if err != nil {
+			return err
+		}
+		root = path
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(Info{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()})
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
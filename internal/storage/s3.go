@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores the objects in a bucket of an S3-compatible object storage (AWS S3, MinIO, Garage...).
+type S3 struct {
+	client *minio.Client
+	bucket string // Name of the bucket holding the objects.
+}
+
+// NewS3 returns a storage keeping its objects in the given bucket. The bucket must already exist.
+// Buckets are addressed by path, which is supported by every S3-compatible server.
+func NewS3(endpoint, region, bucket, accessKey, secretKey string, useSSL bool) (*S3, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure:       useSSL,
+		Region:       region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &S3{client: client, bucket: bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get checks that the object exists before returning it, since objects are fetched lazily.
+func (s *S3) Get(ctx context.Context, key string) (File, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.translateError(err)
+	}
+	if _, err = object.Stat(); err != nil {
+		object.Close()
+		return nil, s.translateError(err)
+	}
+	return object, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (Info, error) {
+	if err := validateKey(key); err != nil {
+		return Info{}, err
+	}
+	objectInfo, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, s.translateError(err)
+	}
+	return Info{Key: key, Size: objectInfo.Size, ModTime: objectInfo.LastModified}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return s.translateError(err)
+	}
+	return nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string, fn func(Info) error) error {
+	// Cancelling the context stops the listing goroutine when fn returns early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for objectInfo := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if objectInfo.Err != nil {
+			return s.translateError(objectInfo.Err)
+		}
+		err := fn(Info{Key: objectInfo.Key, Size: objectInfo.Size, ModTime: objectInfo.LastModified})
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// translateError maps the "not found" responses of the server to ErrNotExist.
+func (s *S3) translateError(err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || (response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket") {
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ErrNotExist is returned when no object is stored under the requested key.
+var ErrNotExist = errors.New("object does not exist")
+
+// Storage keeps the files of the photos. Objects are identified by slash-separated keys
+// such as "thumbnails/ab/cd/<hash>.jpg", whatever the backend.
+type Storage interface {
+	// Put stores the content of r under key, replacing any existing object.
+	// size is the number of bytes read from r. Readers never see a partially written object.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the object stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (File, error)
+	// Stat returns the description of the object stored under key.
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete removes the object stored under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object whose key starts with prefix, and stops at the first error.
+	List(ctx context.Context, prefix string, fn func(Info) error) error
+}
+
+// File is an object opened for reading. It can be seeked so that it can serve range requests.
+type File interface {
+	io.ReadSeekCloser
+}
+
+// Info describes a stored object.
+type Info struct {
+	Key     string    // Key of the object.
+	Size    int64     // Size of the object in bytes.
+	ModTime time.Time // Time at which the object was last written.
+}
+
+// validateKey rejects keys that could escape the storage root, such as absolute paths or keys containing "..".
+func validateKey(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
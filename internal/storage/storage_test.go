@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible server, handling the requests sent by Storage:
+// single part uploads, downloads with ranges, HEAD, DELETE and ListObjectsV2 on a single bucket.
+type fakeS3 struct {
+	bucket  string
+	mux     sync.Mutex
+	objects map[string][]byte
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []listedObject
+}
+
+type listedObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	if key == "" && r.Method == http.MethodGet {
+		f.list(w, r.URL.Query().Get("prefix"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readPayload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(object))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix string) {
+	result := listBucketResult{Name: f.bucket, Prefix: prefix, MaxKeys: 1000}
+	for key, object := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, listedObject{Key: key, LastModified: "2024-01-01T00:00:00.000Z", ETag: `"etag"`, Size: len(object), StorageClass: "STANDARD"})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// readPayload reads the body of an upload, decoding the aws-chunked encoding used by signed streaming uploads.
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var payload bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return payload.Bytes(), nil
+		}
+		if _, err = io.CopyN(&payload, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err = reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newTestS3 starts a fake S3 server and returns a storage using it.
+func newTestS3(t *testing.T) *S3 {
+	fake := &fakeS3{bucket: "photos", objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	endpoint, err := url.Parse(server.URL)
+	assert.NoError(t, err, "Parsing the fake server URL should not fail")
+
+	s, err := NewS3(endpoint.Host, "us-east-1", "photos", "access", "secret", false)
+	assert.NoError(t, err, "NewS3 should not return an error")
+	return s
+}
+
+// testStorage checks the behavior shared by every backend.
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	content := []byte("some photo bytes")
+
+	err := s.Put(ctx, "ab/cd/photo.jpg", bytes.NewReader(content), int64(len(content)))
+	assert.NoError(t, err, "Put should not return an error")
+	err = s.Put(ctx, "thumbnails/ab/cd/photo.jpg", strings.NewReader("thumb"), 5)
+	assert.NoError(t, err, "Put should not return an error")
+
+	info, err := s.Stat(ctx, "ab/cd/photo.jpg")
+	assert.NoError(t, err, "Stat should find a stored object")
+	assert.Equal(t, int64(len(content)), info.Size, "Stat should report the size of the object")
+
+	file, err := s.Get(ctx, "ab/cd/photo.jpg")
+	assert.NoError(t, err, "Get should open a stored object")
+	_, err = file.Seek(5, io.SeekStart)
+	assert.NoError(t, err, "Stored objects should be seekable")
+	rest, err := io.ReadAll(file)
+	assert.NoError(t, err, "Reading a stored object should not fail")
+	assert.Equal(t, content[5:], rest, "Get should return the stored bytes")
+	assert.NoError(t, file.Close(), "Closing a stored object should not fail")
+
+	var keys []string
+	err = s.List(ctx, "thumbnails/", func(info Info) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	assert.NoError(t, err, "List should not return an error")
+	assert.Equal(t, []string{"thumbnails/ab/cd/photo.jpg"}, keys, "List should only return keys starting with the prefix")
+
+	assert.NoError(t, s.Delete(ctx, "ab/cd/photo.jpg"), "Delete should not return an error")
+	assert.NoError(t, s.Delete(ctx, "ab/cd/photo.jpg"), "Deleting a missing object should not return an error")
+	_, err = s.Stat(ctx, "ab/cd/photo.jpg")
+	assert.ErrorIs(t, err, ErrNotExist, "Stat should report deleted objects as missing")
+	_, err = s.Get(ctx, "ab/cd/photo.jpg")
+	assert.ErrorIs(t, err, ErrNotExist, "Get should report deleted objects as missing")
+
+	err = s.Put(ctx, "../outside.jpg", bytes.NewReader(content), int64(len(content)))
+	assert.Error(t, err, "Keys escaping the storage root should be rejected")
+}
+
+// TestLocal ensures that the local backend stores objects on disk.
+func TestLocal(t *testing.T) {
+	s, err := NewLocal(t.TempDir())
+	assert.NoError(t, err, "NewLocal should not return an error")
+	testStorage(t, s)
+}
+
+// TestS3 ensures that the S3 backend talks correctly to an S3-compatible server.
+func TestS3(t *testing.T) {
+	testStorage(t, newTestS3(t))
+}
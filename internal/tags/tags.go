@@ -0,0 +1,40 @@
+package tags
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the maximum length of a tag name, in characters.
+const MaxLength = 64
+
+var ErrEmpty = errors.New("tag name is empty")
+
+// Normalize returns the canonical form of a tag name typed by a user, so that "#Gala  2024" and
+// "gala 2024" are the same tag: the leading hashes are dropped, spaces are collapsed and letters
+// are lowercased. Names longer than MaxLength are truncated.
+func Normalize(name string) (string, error) {
+	name = strings.TrimLeft(strings.TrimSpace(name), "#")
+	name = strings.ToLower(strings.Join(strings.FieldsFunc(name, unicode.IsSpace), " "))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if utf8.RuneCountInString(name) > MaxLength {
+		name = strings.TrimSpace(string([]rune(name)[:MaxLength]))
+	}
+	if name == "" {
+		return "", ErrEmpty
+	}
+	return name, nil
+}
+
+// LikePrefix returns the pattern of a LIKE clause matching the names starting with prefix.
+func LikePrefix(prefix string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(prefix) + "%"
+}
@@ -0,0 +1,37 @@
+package tags
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalize ensures that the different spellings of a tag are reduced to the same name.
+func TestNormalize(t *testing.T) {
+	for input, expected := range map[string]string{
+		"gala":            "gala",
+		"  #Gala  2024 ":  "gala 2024",
+		"##WEI":           "wei",
+		"Soirée\tde Noël": "soirée de noël",
+		"a\x00b":          "ab",
+	} {
+		name, err := Normalize(input)
+		assert.NoError(t, err, "Normalize should accept %q", input)
+		assert.Equal(t, expected, name, "Normalize should canonicalize %q", input)
+	}
+
+	_, err := Normalize("  # ")
+	assert.ErrorIs(t, err, ErrEmpty, "Empty names should be rejected")
+
+	long, err := Normalize(strings.Repeat("é", 100))
+	assert.NoError(t, err, "Long names should be accepted")
+	assert.Equal(t, MaxLength, utf8.RuneCountInString(long), "Long names should be truncated to whole characters")
+}
+
+// TestLikePrefix ensures that the wildcards of LIKE typed by users are matched literally.
+func TestLikePrefix(t *testing.T) {
+	assert.Equal(t, "gala%", LikePrefix("gala"), "Prefixes should be followed by a wildcard")
+	assert.Equal(t, `100\%\_sure\\%`, LikePrefix(`100%_sure\`), "Wildcards and escapes should be escaped")
+}
@@ -0,0 +1,189 @@
+package tus
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Server side of the tus resumable upload protocol (https://tus.io/protocols/resumable-upload).
+const (
+	Version     = "1.0.0"                           // Version of the protocol implemented.
+	Extensions  = "creation,termination"            // Extensions of the protocol supported.
+	ContentType = "application/offset+octet-stream" // Content type of PATCH requests.
+)
+
+var (
+	ErrNotFound       = errors.New("upload does not exist")
+	ErrOffsetMismatch = errors.New("upload offset does not match the size of the staged data")
+	ErrTooLarge       = errors.New("upload is larger than its declared length")
+	ErrLocked         = errors.New("upload is already being written")
+)
+
+// ParseMetadata decodes an Upload-Metadata header: comma-separated pairs of a key and an optional base64-encoded value.
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty key in upload metadata")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for upload metadata %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// NewID returns a random identifier for a new upload.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Staging keeps the data of the uploads in progress, one file per upload.
+// The offset of an upload is the size of its file, so that data written before a crash is not lost.
+type Staging struct {
+	dir     string
+	mux     sync.Mutex
+	writing map[string]bool // Uploads currently being appended to.
+}
+
+// NewStaging creates the staging directory if needed.
+func NewStaging(dir string) (*Staging, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return &Staging{dir: dir, writing: map[string]bool{}}, nil
+}
+
+// path returns the location of the file of an upload. Identifiers are generated by NewID,
+// anything else is rejected so that a crafted identifier cannot point outside the directory.
+func (s *Staging) path(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+".part"), nil
+}
+
+// Create creates the empty file of a new upload.
+func (s *Staging) Create(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create staging file: %w", err)
+	}
+	return file.Close()
+}
+
+// Offset returns the number of bytes received for an upload.
+func (s *Staging) Offset(id string) (int64, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Append writes the data read from r at the end of an upload, after checking that the client resumes from
+// the right offset. At most length bytes can be staged for the upload. It returns the new offset, which
+// includes the bytes received before a read error so that the client can resume from there.
+func (s *Staging) Append(id string, offset, length int64, r io.Reader) (int64, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return 0, err
+	}
+	s.mux.Lock()
+	if s.writing[id] {
+		s.mux.Unlock()
+		return 0, ErrLocked
+	}
+	s.writing[id] = true
+	s.mux.Unlock()
+	defer func() {
+		s.mux.Lock()
+		delete(s.writing, id)
+		s.mux.Unlock()
+	}()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return info.Size(), ErrOffsetMismatch
+	}
+
+	// One extra byte is read to detect clients sending more than the declared length
+	written, err := io.Copy(file, io.LimitReader(r, length-offset+1))
+	if written > length-offset {
+		if truncateErr := file.Truncate(length); truncateErr != nil {
+			return 0, truncateErr
+		}
+		return length, ErrTooLarge
+	}
+	if err != nil {
+		return offset + written, fmt.Errorf("failed to write staging file: %w", err)
+	}
+	return offset + written, nil
+}
+
+// Open opens the staged data of an upload for reading.
+func (s *Staging) Open(id string) (*os.File, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Remove deletes the staged data of an upload. Removing a missing upload is not an error.
+func (s *Staging) Remove(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package tus
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseMetadata ensures that Upload-Metadata headers are decoded.
+func TestParseMetadata(t *testing.T) {
+	metadata, err := ParseMetadata("filename cGhvdG8uanBn,event_id NDI=,is_confidential")
+	assert.NoError(t, err, "ParseMetadata should not return an error")
+	assert.Equal(t, map[string]string{"filename": "photo.jpg", "event_id": "42", "is_confidential": ""}, metadata, "Values should be base64 decoded")
+
+	metadata, err = ParseMetadata("")
+	assert.NoError(t, err, "An empty header should not return an error")
+	assert.Empty(t, metadata, "An empty header should yield no metadata")
+
+	_, err = ParseMetadata("filename not-base64!")
+	assert.Error(t, err, "ParseMetadata should reject invalid base64 values")
+}
+
+// TestStagingResume ensures that an upload can be appended in several chunks and resumed from its offset.
+func TestStagingResume(t *testing.T) {
+	s, err := NewStaging(t.TempDir())
+	assert.NoError(t, err, "NewStaging should not return an error")
+	id, err := NewID()
+	assert.NoError(t, err, "NewID should not return an error")
+	assert.NoError(t, s.Create(id), "Create should not return an error")
+
+	offset, err := s.Append(id, 0, 10, strings.NewReader("hello"))
+	assert.NoError(t, err, "Appending the first chunk should not fail")
+	assert.Equal(t, int64(5), offset, "The offset should move past the first chunk")
+
+	_, err = s.Append(id, 2, 10, strings.NewReader("world"))
+	assert.ErrorIs(t, err, ErrOffsetMismatch, "Append should reject chunks sent at the wrong offset")
+
+	offset, err = s.Offset(id)
+	assert.NoError(t, err, "Offset should not return an error")
+	assert.Equal(t, int64(5), offset, "Offset should report the staged size")
+
+	offset, err = s.Append(id, offset, 10, strings.NewReader("world"))
+	assert.NoError(t, err, "Appending the last chunk should not fail")
+	assert.Equal(t, int64(10), offset, "The upload should be complete")
+
+	file, err := s.Open(id)
+	assert.NoError(t, err, "Open should not return an error")
+	data, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, []byte("helloworld"), data, "The staged data should be the concatenation of the chunks")
+
+	assert.NoError(t, s.Remove(id), "Remove should not return an error")
+	_, err = s.Offset(id)
+	assert.ErrorIs(t, err, ErrNotFound, "Removed uploads should not exist")
+}
+
+// TestStagingTooLarge ensures that data past the declared length is refused and not kept.
+func TestStagingTooLarge(t *testing.T) {
+	s, err := NewStaging(t.TempDir())
+	assert.NoError(t, err, "NewStaging should not return an error")
+	assert.NoError(t, s.Create("abcd"), "Create should not return an error")
+
+	_, err = s.Append("abcd", 0, 4, bytes.NewReader([]byte("too long")))
+	assert.ErrorIs(t, err, ErrTooLarge, "Append should reject data past the declared length")
+	offset, _ := s.Offset("abcd")
+	assert.Equal(t, int64(4), offset, "The staged data should be truncated to the declared length")
+
+	assert.ErrorIs(t, s.Create("../escape"), ErrNotFound, "Identifiers that are not generated should be rejected")
+}
@@ -0,0 +1,79 @@
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Signed URLs carry their expiry and an HMAC of their path and query, so that they can be
+// checked without any state on the server and cannot be altered or reused once expired.
+const (
+	ExpiresParam   = "expires"   // Query parameter holding the expiry, in seconds since the epoch.
+	SignatureParam = "signature" // Query parameter holding the signature.
+)
+
+var (
+	ErrMissingSignature = errors.New("url is not signed")
+	ErrInvalidSignature = errors.New("url signature is invalid")
+	ErrExpired          = errors.New("url has expired")
+)
+
+// Signer signs and verifies URLs with a secret key.
+type Signer struct {
+	key []byte
+}
+
+// New returns a Signer using key, which must be kept secret.
+func New(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// Sign returns the URL of path with the query params, valid until expires.
+func (s *Signer) Sign(path string, params url.Values, expires time.Time) string {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(SignatureParam, s.signature(path, query))
+	return path + "?" + query.Encode()
+}
+
+// Verify checks that u was signed by Sign and has not expired at now.
+func (s *Signer) Verify(u *url.URL, now time.Time) error {
+	query := u.Query()
+	signature := query.Get(SignatureParam)
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(u.Path, query))) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// signature computes the signature of path and of the query without its signature parameter.
+// The parameters are sorted by Encode, so their order in the URL does not matter.
+func (s *Signer) signature(path string, query url.Values) string {
+	unsigned := url.Values{}
+	for key, values := range query {
+		if key != SignatureParam {
+			unsigned[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(path + "?" + unsigned.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
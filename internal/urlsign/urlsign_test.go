@@ -0,0 +1,56 @@
+package urlsign
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSignVerify ensures that signed URLs are accepted until they expire, whatever the order of their parameters.
+func TestSignVerify(t *testing.T) {
+	s := New([]byte("secret"))
+	now := time.Unix(1_700_000_000, 0)
+	signed := s.Sign("/photo", url.Values{"photo_id": {"42"}, "size": {"thumb"}}, now.Add(time.Hour))
+
+	u, err := url.Parse(signed)
+	assert.NoError(t, err, "Signed URLs should be valid URLs")
+	assert.Equal(t, "/photo", u.Path, "The path should be kept")
+	assert.Equal(t, "42", u.Query().Get("photo_id"), "The parameters should be kept")
+	assert.NoError(t, s.Verify(u, now), "Signed URLs should be accepted")
+	assert.NoError(t, s.Verify(u, now.Add(time.Hour)), "Signed URLs should be accepted until their expiry")
+	assert.ErrorIs(t, s.Verify(u, now.Add(time.Hour+time.Second)), ErrExpired, "Expired URLs should be rejected")
+
+	reordered := *u
+	reordered.RawQuery = "size=thumb&" + ExpiresParam + "=" + u.Query().Get(ExpiresParam) + "&photo_id=42&" + SignatureParam + "=" + u.Query().Get(SignatureParam)
+	assert.NoError(t, s.Verify(&reordered, now), "The order of the parameters should not matter")
+}
+
+// TestVerifyTampered ensures that unsigned, altered or foreign URLs are rejected.
+func TestVerifyTampered(t *testing.T) {
+	s := New([]byte("secret"))
+	now := time.Unix(1_700_000_000, 0)
+	u, _ := url.Parse(s.Sign("/photo", url.Values{"photo_id": {"42"}}, now.Add(time.Hour)))
+
+	unsigned, _ := url.Parse("/photo?photo_id=42")
+	assert.ErrorIs(t, s.Verify(unsigned, now), ErrMissingSignature, "Unsigned URLs should be rejected")
+
+	for name, alter := range map[string]func(q url.Values){
+		"photo":   func(q url.Values) { q.Set("photo_id", "43") },
+		"expiry":  func(q url.Values) { q.Set(ExpiresParam, "9999999999") },
+		"param":   func(q url.Values) { q.Set("size", "original") },
+		"garbage": func(q url.Values) { q.Set(SignatureParam, "garbage") },
+	} {
+		altered := *u
+		q := altered.Query()
+		alter(q)
+		altered.RawQuery = q.Encode()
+		assert.ErrorIs(t, s.Verify(&altered, now), ErrInvalidSignature, "Altering the %s should invalidate the URL", name)
+	}
+
+	moved := *u
+	moved.Path = "/photo/original"
+	assert.ErrorIs(t, s.Verify(&moved, now), ErrInvalidSignature, "Signatures should not be valid for other paths")
+	assert.ErrorIs(t, New([]byte("other")).Verify(u, now), ErrInvalidSignature, "Signatures should not be valid for other keys")
+}
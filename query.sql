@@ -23,6 +23,13 @@ JOIN sessions s
 ON s.user_id = u.user_id
 WHERE s.session_token = ?;
 
+-- name: SearchUsers :many
+SELECT *
+FROM users
+WHERE full_name LIKE sqlc.arg(search) OR email LIKE sqlc.arg(search)
+ORDER BY full_name
+LIMIT 10;
+
 
 
 
@@ -42,8 +49,8 @@ DELETE FROM sessions WHERE session_token = ?;
 
 
 -- name: CreateEvent :exec
-INSERT INTO events (name, description, event_date, parent_event_id)
-VALUES (?, ?, ?, ?);
+INSERT INTO events (name, description, event_date, metadata_policy, parent_event_id)
+VALUES (?, ?, ?, ?, ?);
 
 -- name: GetEvents :many
 SELECT *
@@ -52,25 +59,95 @@ FROM events;
 -- name: GetEventByID :many
 SELECT * FROM events WHERE event_id = ?;
 
+-- name: GetEventByNameAndParentID :one
+SELECT * FROM events
+WHERE name = ? AND parent_event_id <=> ?
+ORDER BY event_id
+LIMIT 1;
+
 -- name: UpdateEvent :exec
 UPDATE events
 SET name = ?, description = ?, event_date = ?, parent_event_id = ?
 WHERE event_id = ?;
 
+-- name: UpdateEventMetadataPolicy :exec
+UPDATE events
+SET metadata_policy = ?
+WHERE event_id = ?;
+
+-- name: UpdateEventPassword :exec
+UPDATE events
+SET password_hash = ?
+WHERE event_id = ?;
+
 -- name: DeleteEvent :exec
 DELETE FROM events WHERE event_id = ?;
 
+-- name: GetEventAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT e.*, 0 AS depth FROM events e WHERE e.event_id = ?
+    UNION ALL
+    SELECT e.*, a.depth + 1
+    FROM events e
+    JOIN ancestors a ON e.event_id = a.parent_event_id
+    WHERE a.depth < 100
+)
+SELECT *
+FROM ancestors
+WHERE depth > 0
+ORDER BY depth DESC;
 
+-- name: GetEventDescendantIDs :many
+WITH RECURSIVE descendants AS (
+    SELECT event_id FROM events WHERE parent_event_id = ?
+    UNION
+    SELECT e.event_id
+    FROM events e
+    JOIN descendants d ON e.parent_event_id = d.event_id
+)
+SELECT event_id FROM descendants;
+
+-- name: GetChildEventsWithPhotoCounts :many
+WITH RECURSIVE subtrees AS (
+    SELECT event_id AS child_id, event_id FROM events WHERE parent_event_id = sqlc.arg(parent_event_id)
+    UNION
+    SELECT s.child_id, e.event_id
+    FROM events e
+    JOIN subtrees s ON e.parent_event_id = s.event_id
+)
+SELECT
+    e.*,
+    COUNT(p.photo_id) AS photo_count,
+    MAX(p.creation_date) AS latest_photo_date
+FROM events e
+JOIN subtrees s ON s.child_id = e.event_id
+LEFT JOIN photos p ON p.event_id = s.event_id
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+GROUP BY e.event_id
+ORDER BY e.event_date ASC, e.event_id ASC;
 
 
--- name: CreatePhoto :exec
-INSERT INTO photos (path_to_photo, event_id)
-VALUES (?, ?);
+
+
+-- name: CreatePhoto :execlastid
+INSERT INTO photos (photo_hash, original_filename, path_to_photo, path_to_thumbnail, path_to_preview, event_id)
+VALUES (?, ?, ?, ?, ?, ?);
 
 -- name: GetPhoto :one
 SELECT * FROM photos WHERE photo_id = ?;
 
+-- name: GetPhotoByHash :one
+SELECT * FROM photos WHERE photo_hash = ? LIMIT 1
+FOR UPDATE;
+
+-- name: GetPhotoByEventIDAndHash :one
+SELECT * FROM photos WHERE event_id = ? AND photo_hash = ?;
+
 -- name: GetPhotosByEventID :many
+SELECT * FROM photos WHERE event_id = ? AND deletion_date IS NULL;
+
+-- name: GetAllPhotosByEventID :many
 SELECT * FROM photos WHERE event_id = ?;
 
 -- name: GetPhotosSortedByDate :many
@@ -81,19 +158,489 @@ UPDATE photos
 SET path_to_photo = ?
 WHERE photo_id = ?;
 
+-- name: UpdatePhotoEvent :exec
+UPDATE photos
+SET event_id = ?
+WHERE photo_id = ?;
+
 -- name: DeletePhoto :exec
 DELETE FROM photos WHERE photo_id = ?;
 
+-- name: CountPhotosByHash :one
+SELECT COUNT(*) FROM photos WHERE photo_hash = ?
+FOR UPDATE;
+
+-- name: SetPhotoHidden :exec
+UPDATE photos
+SET is_hidden = ?
+WHERE photo_id = ?;
+
+-- name: TrashPhoto :exec
+UPDATE photos
+SET deletion_date = CURRENT_TIMESTAMP
+WHERE photo_id = ? AND deletion_date IS NULL;
+
+-- name: RestorePhoto :exec
+UPDATE photos
+SET deletion_date = NULL
+WHERE photo_id = ?;
+
+-- name: GetTrashedPhotos :many
+SELECT * FROM photos WHERE deletion_date IS NOT NULL ORDER BY deletion_date DESC;
+
+-- name: GetExpiredTrashedPhotos :many
+SELECT * FROM photos WHERE deletion_date < ?;
+
 -- name: GetPhotosByEventIDWithPagination :many
 SELECT
-    photo_id,
-    path_to_photo,
-    creation_date,
-    event_id
+    p.photo_id,
+    p.photo_hash,
+    p.path_to_photo,
+    p.path_to_thumbnail,
+    p.path_to_preview,
+    p.creation_date,
+    p.is_hidden,
+    p.event_id,
+    m.capture_date,
+    m.camera_make,
+    m.camera_model,
+    m.lens_model,
+    m.width,
+    m.height,
+    m.exposure_time,
+    m.f_number,
+    m.iso,
+    m.focal_length
 FROM
-    photos
+    photos p
+LEFT JOIN
+    photo_metadata m ON m.photo_id = p.photo_id
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+ORDER BY
+    COALESCE(m.capture_date, p.creation_date) ASC,
+    p.photo_id ASC
+LIMIT ? OFFSET ?;
+
+
+
+
+-- name: CreatePhotoMetadata :exec
+INSERT INTO photo_metadata (
+    photo_id, capture_date, camera_make, camera_model, lens_model, width, height, orientation,
+    exposure_time, f_number, iso, focal_length, gps_latitude, gps_longitude, gps_altitude
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetPhotoMetadata :one
+SELECT * FROM photo_metadata WHERE photo_id = ?;
+
+
+
+
+-- name: CreateUpload :exec
+INSERT INTO uploads (upload_id, filename, upload_length, user_id, event_id)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: GetUpload :one
+SELECT * FROM uploads WHERE upload_id = ?;
+
+-- name: GetExpiredUploads :many
+SELECT * FROM uploads WHERE creation_date < ?;
+
+-- name: DeleteUpload :exec
+DELETE FROM uploads WHERE upload_id = ?;
+
+
+
+
+-- name: CreateTag :exec
+INSERT IGNORE INTO tags (name, is_curated)
+VALUES (?, ?);
+
+-- name: GetTag :one
+SELECT * FROM tags WHERE tag_id = ?;
+
+-- name: GetTagByName :one
+SELECT * FROM tags WHERE name = ?;
+
+-- name: GetCuratedTags :many
+SELECT * FROM tags WHERE is_curated = true ORDER BY name;
+
+-- name: SearchTags :many
+SELECT * FROM tags WHERE name LIKE ? ORDER BY is_curated DESC, name LIMIT 10;
+
+-- name: SetTagCurated :exec
+UPDATE tags
+SET is_curated = ?
+WHERE tag_id = ?;
+
+-- name: AddPhotoTag :exec
+INSERT IGNORE INTO photo_tags (photo_id, tag_id, user_id)
+VALUES (?, ?, ?);
+
+-- name: CopyPhotoTags :exec
+INSERT IGNORE INTO photo_tags (photo_id, tag_id, user_id)
+SELECT p.photo_id, pt.tag_id, pt.user_id
+FROM photo_tags pt
+JOIN photos p ON p.photo_id = sqlc.arg(new_photo_id)
+WHERE pt.photo_id = sqlc.arg(photo_id);
+
+-- name: RemovePhotoTag :exec
+DELETE FROM photo_tags WHERE photo_id = ? AND tag_id = ?;
+
+-- name: GetTagsByPhotoID :many
+SELECT t.*
+FROM tags t
+JOIN photo_tags pt ON pt.tag_id = t.tag_id
+WHERE pt.photo_id = ?
+ORDER BY t.name;
+
+-- name: GetPhotosByTagID :many
+SELECT p.*
+FROM photos p
+JOIN photo_tags pt ON pt.photo_id = p.photo_id
+WHERE
+    pt.tag_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+ORDER BY p.creation_date DESC;
+
+-- name: SearchEvents :many
+SELECT e.*
+FROM events e
+LEFT JOIN (
+    SELECT p.event_id, MAX(MATCH(t.name) AGAINST (sqlc.arg(search) IN NATURAL LANGUAGE MODE)) AS score
+    FROM tags t
+    JOIN photo_tags pt ON pt.tag_id = t.tag_id
+    JOIN photos p ON p.photo_id = pt.photo_id
+    WHERE
+        MATCH(t.name) AGAINST (sqlc.arg(search) IN NATURAL LANGUAGE MODE)
+        AND p.deletion_date IS NULL
+        AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+    GROUP BY p.event_id
+) tm ON tm.event_id = e.event_id
 WHERE
-    event_id = ?
+    (MATCH(e.name, e.description) AGAINST (sqlc.arg(search) IN NATURAL LANGUAGE MODE) OR tm.score IS NOT NULL)
+    AND (sqlc.narg(from_date) IS NULL OR e.event_date >= sqlc.narg(from_date))
+    AND (sqlc.narg(to_date) IS NULL OR e.event_date < sqlc.narg(to_date))
 ORDER BY
-    creation_date ASC
+    MATCH(e.name, e.description) AGAINST (sqlc.arg(search) IN NATURAL LANGUAGE MODE) + COALESCE(tm.score, 0) DESC,
+    e.event_date DESC
 LIMIT ? OFFSET ?;
+
+
+
+
+-- name: CreatePhotoReport :exec
+INSERT INTO photo_reports (reason, comment, photo_id, user_id)
+VALUES (?, ?, ?, ?);
+
+-- name: CountPhotoReporters :one
+SELECT COUNT(DISTINCT user_id) FROM photo_reports WHERE photo_id = ? AND status = 'open';
+
+-- name: MarkPhotoHiddenByReports :exec
+UPDATE photo_reports SET hid_photo = true WHERE photo_id = ? AND status = 'open';
+
+-- name: IsPhotoHiddenByReports :one
+SELECT EXISTS(SELECT 1 FROM photo_reports WHERE photo_id = ? AND status = 'open' AND hid_photo);
+
+-- name: GetPhotoReports :many
+SELECT
+    r.report_id,
+    r.reason,
+    r.comment,
+    r.status,
+    r.creation_date,
+    r.resolution_date,
+    r.photo_id,
+    p.photo_hash,
+    p.is_hidden,
+    EXISTS(SELECT 1 FROM photo_reports h WHERE h.photo_id = r.photo_id AND h.status = 'open' AND h.hid_photo) AS hidden_by_reports,
+    p.deletion_date,
+    p.event_id,
+    u.full_name AS reporter_name,
+    m.full_name AS moderator_name
+FROM
+    photo_reports r
+JOIN
+    photos p ON p.photo_id = r.photo_id
+JOIN
+    users u ON u.user_id = r.user_id
+LEFT JOIN
+    users m ON m.user_id = r.moderator_id
+WHERE
+    (r.status = 'open') = sqlc.arg(open)
+ORDER BY
+    r.creation_date DESC
+LIMIT ?;
+
+-- name: ClosePhotoReports :exec
+UPDATE photo_reports
+SET status = ?, resolution_date = CURRENT_TIMESTAMP, moderator_id = ?
+WHERE photo_id = ? AND status = 'open';
+
+
+
+
+-- name: CreateUserFolder :execlastid
+INSERT INTO user_folders (is_sub_folder, name, description, user_id, parent_folder_id)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: GetUserFolder :one
+SELECT * FROM user_folders WHERE user_folder_id = ?;
+
+-- name: GetUserFoldersByUserID :many
+SELECT * FROM user_folders WHERE user_id = ? ORDER BY name;
+
+-- name: GetSubFolders :many
+SELECT * FROM user_folders WHERE parent_folder_id = ? ORDER BY name;
+
+-- name: UpdateUserFolder :exec
+UPDATE user_folders
+SET is_sub_folder = ?, name = ?, description = ?, parent_folder_id = ?
+WHERE user_folder_id = ?;
+
+-- name: DeleteUserFolder :exec
+DELETE FROM user_folders WHERE user_folder_id = ?;
+
+-- name: AddPhotoToUserFolder :exec
+INSERT IGNORE INTO user_folder_photos (user_folder_id, photo_id)
+VALUES (?, ?);
+
+-- name: RemovePhotoFromUserFolder :exec
+DELETE FROM user_folder_photos WHERE user_folder_id = ? AND photo_id = ?;
+
+-- name: CopyPhotoUserFolders :exec
+INSERT IGNORE INTO user_folder_photos (user_folder_id, photo_id, creation_date)
+SELECT fp.user_folder_id, p.photo_id, fp.creation_date
+FROM user_folder_photos fp
+JOIN photos p ON p.photo_id = sqlc.arg(new_photo_id)
+WHERE fp.photo_id = sqlc.arg(photo_id);
+
+-- name: GetPhotosByUserFolderID :many
+SELECT p.*
+FROM photos p
+JOIN user_folder_photos fp ON fp.photo_id = p.photo_id
+WHERE
+    fp.user_folder_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+ORDER BY fp.creation_date ASC;
+
+-- name: ShareUserFolder :exec
+INSERT IGNORE INTO user_folder_shares (user_folder_id, user_id)
+VALUES (?, ?);
+
+-- name: UnshareUserFolder :exec
+DELETE FROM user_folder_shares WHERE user_folder_id = ? AND user_id = ?;
+
+-- name: CountUserFolderShares :one
+SELECT COUNT(*) FROM user_folder_shares WHERE user_folder_id = ? AND user_id = ?;
+
+-- name: GetUserFolderShares :many
+SELECT u.*
+FROM users u
+JOIN user_folder_shares s ON s.user_id = u.user_id
+WHERE s.user_folder_id = ?
+ORDER BY u.full_name;
+
+-- name: GetSharedUserFolders :many
+SELECT f.*
+FROM user_folders f
+JOIN user_folder_shares s ON s.user_folder_id = f.user_folder_id
+WHERE s.user_id = ?
+ORDER BY f.name;
+
+
+
+
+-- name: TagUserInPhoto :exec
+INSERT INTO recognized_users (box_x, box_y, box_width, box_height, user_id, photo_id, tagged_by)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+    box_x = VALUES(box_x),
+    box_y = VALUES(box_y),
+    box_width = VALUES(box_width),
+    box_height = VALUES(box_height),
+    tagged_by = VALUES(tagged_by);
+
+-- name: RemoveRecognizedUser :exec
+DELETE FROM recognized_users WHERE photo_id = ? AND user_id = ?;
+
+-- name: CopyRecognizedUsers :exec
+INSERT IGNORE INTO recognized_users (box_x, box_y, box_width, box_height, creation_date, user_id, photo_id, tagged_by)
+SELECT r.box_x, r.box_y, r.box_width, r.box_height, r.creation_date, r.user_id, p.photo_id, r.tagged_by
+FROM recognized_users r
+JOIN photos p ON p.photo_id = sqlc.arg(new_photo_id)
+WHERE r.photo_id = sqlc.arg(photo_id);
+
+-- name: GetRecognizedUsersByPhotoID :many
+SELECT
+    r.recognized_user_id,
+    r.box_x,
+    r.box_y,
+    r.box_width,
+    r.box_height,
+    r.user_id,
+    r.tagged_by,
+    u.full_name
+FROM
+    recognized_users r
+JOIN
+    users u ON u.user_id = r.user_id
+WHERE
+    r.photo_id = ?
+ORDER BY
+    u.full_name;
+
+-- name: GetPhotosOfUser :many
+SELECT p.*
+FROM photos p
+JOIN recognized_users r ON r.photo_id = p.photo_id
+WHERE
+    r.user_id = ?
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+ORDER BY p.creation_date DESC;
+
+
+
+
+-- name: CreatePerceptualHash :exec
+INSERT IGNORE INTO perceptual_hashes (photo_hash, dhash)
+VALUES (?, ?);
+
+-- name: GetPerceptualHash :one
+SELECT dhash FROM perceptual_hashes WHERE photo_hash = ?;
+
+-- name: GetPerceptualHashesByEventID :many
+SELECT p.photo_id, h.dhash
+FROM photos p
+JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+ORDER BY p.photo_id;
+
+-- name: GetPhotosWithoutPerceptualHash :many
+SELECT p.*
+FROM photos p
+LEFT JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    p.event_id = ?
+    AND p.deletion_date IS NULL
+    AND h.photo_hash IS NULL;
+
+-- name: GetSimilarPhotos :many
+SELECT p.*
+FROM photos p
+JOIN perceptual_hashes h ON h.photo_hash = p.photo_hash
+WHERE
+    BIT_COUNT(h.dhash ^ sqlc.arg(dhash)) <= sqlc.arg(max_distance)
+    AND p.photo_id != sqlc.arg(photo_id)
+    AND p.deletion_date IS NULL
+    AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+ORDER BY BIT_COUNT(h.dhash ^ sqlc.arg(dhash)), p.photo_id
+LIMIT ?;
+
+
+
+
+-- name: CreateJob :exec
+INSERT INTO jobs (kind, payload, run_after)
+VALUES (?, ?, ?);
+
+-- name: GetDueJob :one
+SELECT * FROM jobs
+WHERE
+    status IN ('pending', 'running')
+    AND run_after <= ?
+ORDER BY run_after, job_id
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: StartJob :exec
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, run_after = ?
+WHERE job_id = ?;
+
+-- name: CompleteJob :exec
+UPDATE jobs
+SET status = 'succeeded', finish_date = CURRENT_TIMESTAMP
+WHERE job_id = ?;
+
+-- name: RetryJob :exec
+UPDATE jobs
+SET status = 'pending', last_error = ?, run_after = ?
+WHERE job_id = ?;
+
+-- name: FailJob :exec
+UPDATE jobs
+SET status = 'failed', last_error = ?, finish_date = CURRENT_TIMESTAMP
+WHERE job_id = ?;
+
+-- name: RequeueFailedJob :exec
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_after = ?, finish_date = NULL
+WHERE job_id = ? AND status = 'failed';
+
+-- name: CountJobsByStatus :many
+SELECT status, COUNT(*) AS count
+FROM jobs
+GROUP BY status;
+
+-- name: GetJobs :many
+SELECT * FROM jobs
+WHERE sqlc.narg(status) IS NULL OR status = sqlc.narg(status)
+ORDER BY job_id DESC
+LIMIT ?;
+
+
+
+
+-- name: SetEventCover :exec
+INSERT INTO event_covers (event_id, photo_id)
+VALUES (?, ?)
+ON DUPLICATE KEY UPDATE
+    photo_id = VALUES(photo_id),
+    creation_date = CURRENT_TIMESTAMP;
+
+-- name: DeleteEventCover :exec
+DELETE FROM event_covers WHERE event_id = ?;
+
+-- name: GetEventCover :one
+SELECT * FROM event_covers WHERE event_id = ?;
+
+-- name: GetEventCoversByParentID :many
+WITH RECURSIVE subtrees AS (
+    SELECT event_id AS child_id, event_id, 0 AS depth, false AS locked FROM events WHERE parent_event_id <=> sqlc.arg(parent_event_id)
+    UNION ALL
+    SELECT s.child_id, e.event_id, s.depth + 1, s.locked OR e.password_hash IS NOT NULL
+    FROM events e
+    JOIN subtrees s ON e.parent_event_id = s.event_id
+    WHERE s.depth < 100
+), ranked AS (
+    SELECT
+        s.child_id,
+        p.photo_id,
+        ROW_NUMBER() OVER (
+            PARTITION BY s.child_id
+            ORDER BY c.photo_id IS NULL, s.depth, COALESCE(m.capture_date, p.creation_date), p.photo_id
+        ) AS cover_rank
+    FROM subtrees s
+    JOIN photos p ON p.event_id = s.event_id
+    LEFT JOIN event_covers c ON c.event_id = s.child_id AND c.photo_id = p.photo_id
+    LEFT JOIN photo_metadata m ON m.photo_id = p.photo_id
+    WHERE
+        p.deletion_date IS NULL
+        AND (p.is_hidden = false OR p.is_hidden = sqlc.arg(include_hidden))
+        AND NOT s.locked
+)
+SELECT e.event_id, e.password_hash, p.photo_id, p.photo_hash
+FROM ranked r
+JOIN events e ON e.event_id = r.child_id
+JOIN photos p ON p.photo_id = r.photo_id
+WHERE r.cover_rank = 1;
@@ -34,25 +34,121 @@ CREATE TABLE events (
     description TEXT NOT NULL,
     event_date DATETIME NOT NULL,
     creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    metadata_policy ENUM('all', 'gps', 'none'),
+    password_hash VARCHAR(255),
 
     parent_event_id INT UNSIGNED,
 
     PRIMARY KEY (event_id),
+    FULLTEXT KEY (name, description),
     FOREIGN KEY (parent_event_id) REFERENCES events(event_id) ON DELETE CASCADE
 );
 
 CREATE TABLE photos (
     photo_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
 
+    photo_hash CHAR(64) NOT NULL,
+    original_filename VARCHAR(255) NOT NULL,
     path_to_photo VARCHAR(255) NOT NULL,
+    path_to_thumbnail VARCHAR(255) NOT NULL,
+    path_to_preview VARCHAR(255) NOT NULL,
     creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    is_hidden BOOL NOT NULL DEFAULT false,
+    deletion_date DATETIME,
 
     event_id INT UNSIGNED NOT NULL,
 
     PRIMARY KEY (photo_id),
+    UNIQUE KEY (event_id, photo_hash),
+    INDEX (photo_hash),
     FOREIGN KEY (event_id) REFERENCES events(event_id)
 );
 
+CREATE TABLE photo_metadata (
+    photo_id INT UNSIGNED NOT NULL,
+
+    capture_date DATETIME,
+    camera_make VARCHAR(255),
+    camera_model VARCHAR(255),
+    lens_model VARCHAR(255),
+    width INT UNSIGNED NOT NULL,
+    height INT UNSIGNED NOT NULL,
+    orientation SMALLINT UNSIGNED NOT NULL DEFAULT 1,
+    exposure_time VARCHAR(32),
+    f_number DOUBLE,
+    iso INT UNSIGNED,
+    focal_length DOUBLE,
+    gps_latitude DOUBLE,
+    gps_longitude DOUBLE,
+    gps_altitude DOUBLE,
+
+    PRIMARY KEY (photo_id),
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE
+);
+
+CREATE TABLE uploads (
+    upload_id CHAR(32) NOT NULL,
+
+    filename VARCHAR(255) NOT NULL,
+    upload_length BIGINT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id INT UNSIGNED NOT NULL,
+    event_id INT UNSIGNED NOT NULL,
+
+    PRIMARY KEY (upload_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (event_id) REFERENCES events(event_id) ON DELETE CASCADE
+);
+
+CREATE TABLE tags (
+    tag_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+
+    name VARCHAR(64) NOT NULL,
+    is_curated BOOL NOT NULL DEFAULT false,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (tag_id),
+    UNIQUE KEY (name),
+    FULLTEXT KEY (name)
+);
+
+CREATE TABLE photo_tags (
+    photo_id INT UNSIGNED NOT NULL,
+    tag_id INT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    user_id INT UNSIGNED NOT NULL,
+
+    PRIMARY KEY (photo_id, tag_id),
+    INDEX (tag_id),
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(tag_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE TABLE photo_reports (
+    report_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+
+    reason ENUM('inappropriate', 'privacy', 'copyright', 'other') NOT NULL,
+    comment TEXT NOT NULL,
+    status ENUM('open', 'dismissed', 'resolved') NOT NULL DEFAULT 'open',
+    hid_photo BOOL NOT NULL DEFAULT false,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolution_date DATETIME,
+
+    photo_id INT UNSIGNED NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    moderator_id INT UNSIGNED,
+
+    PRIMARY KEY (report_id),
+    INDEX (photo_id, status),
+    INDEX (status, creation_date),
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (moderator_id) REFERENCES users(user_id)
+);
+
 CREATE TABLE user_folders (
     user_folder_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
 
@@ -64,18 +160,86 @@ CREATE TABLE user_folders (
     user_id INT UNSIGNED NOT NULL,
     parent_folder_id INT UNSIGNED,
 
-    PRIMARY KEY (folder_id),
+    PRIMARY KEY (user_folder_id),
     FOREIGN KEY (user_id) REFERENCES users(user_id),
-    FOREIGN KEY (parent_folder_id) REFERENCES user_folders(folder_id)
+    FOREIGN KEY (parent_folder_id) REFERENCES user_folders(user_folder_id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_folder_photos (
+    user_folder_id INT UNSIGNED NOT NULL,
+    photo_id INT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (user_folder_id, photo_id),
+    INDEX (photo_id),
+    FOREIGN KEY (user_folder_id) REFERENCES user_folders(user_folder_id) ON DELETE CASCADE,
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_folder_shares (
+    user_folder_id INT UNSIGNED NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (user_folder_id, user_id),
+    INDEX (user_id),
+    FOREIGN KEY (user_folder_id) REFERENCES user_folders(user_folder_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
 );
 
 CREATE TABLE recognized_users (
     recognized_user_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
 
+    box_x DOUBLE,
+    box_y DOUBLE,
+    box_width DOUBLE,
+    box_height DOUBLE,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
     user_id INT UNSIGNED NOT NULL,
     photo_id INT UNSIGNED NOT NULL,
+    tagged_by INT UNSIGNED NOT NULL,
 
-    PRIMARY KEY (id),
+    PRIMARY KEY (recognized_user_id),
+    UNIQUE KEY (photo_id, user_id),
+    INDEX (user_id),
     FOREIGN KEY (user_id) REFERENCES users(user_id),
-    FOREIGN KEY (photo_id) REFERENCES photos(photo_id)
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE,
+    FOREIGN KEY (tagged_by) REFERENCES users(user_id)
+);
+
+CREATE TABLE perceptual_hashes (
+    photo_hash CHAR(64) NOT NULL,
+
+    dhash BIGINT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (photo_hash)
+);
+
+CREATE TABLE jobs (
+    job_id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+
+    kind VARCHAR(32) NOT NULL,
+    payload JSON NOT NULL,
+    status ENUM('pending', 'running', 'succeeded', 'failed') NOT NULL DEFAULT 'pending',
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    last_error TEXT,
+    run_after DATETIME NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finish_date DATETIME,
+
+    PRIMARY KEY (job_id),
+    INDEX (status, run_after)
+);
+
+CREATE TABLE event_covers (
+    event_id INT UNSIGNED NOT NULL,
+
+    photo_id INT UNSIGNED NOT NULL,
+    creation_date DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (event_id),
+    FOREIGN KEY (event_id) REFERENCES events(event_id) ON DELETE CASCADE,
+    FOREIGN KEY (photo_id) REFERENCES photos(photo_id) ON DELETE CASCADE
 );